@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	cli "github.com/jawher/mow.cli"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic/smartlogictest"
+)
+
+const appDescription = "Fake Smartlogic Semaphore server, serving a model held in memory, to run the smartlogic-notifier against locally"
+
+func main() {
+
+	app := cli.App("fake-smartlogic", appDescription)
+
+	port := app.String(cli.StringOpt{
+		Name:   "port",
+		Value:  "8081",
+		Desc:   "Port to listen on",
+		EnvVar: "APP_PORT",
+	})
+
+	model := app.String(cli.StringOpt{
+		Name:   "model",
+		Value:  smartlogictest.DefaultModel,
+		Desc:   "Name of the model served",
+		EnvVar: "SMARTLOGIC_MODEL",
+	})
+
+	conceptURIPrefix := app.String(cli.StringOpt{
+		Name:   "conceptUriPrefix",
+		Value:  smartlogictest.DefaultConceptURIPrefix,
+		Desc:   "The URI prefix of the concepts created via the admin endpoints",
+		EnvVar: "CONCEPT_URI_PREFIX",
+	})
+
+	apiKey := app.String(cli.StringOpt{
+		Name:   "apiKey",
+		Desc:   "API key accepted by the token endpoint, any key is accepted if empty",
+		EnvVar: "SMARTLOGIC_API_KEY",
+	})
+
+	clientID := app.String(cli.StringOpt{
+		Name:   "clientID",
+		Desc:   "OAuth2 client id accepted by the token endpoint, any client credentials are accepted if empty",
+		EnvVar: "SMARTLOGIC_CLIENT_ID",
+	})
+
+	clientSecret := app.String(cli.StringOpt{
+		Name:   "clientSecret",
+		Desc:   "OAuth2 client secret accepted by the token endpoint",
+		EnvVar: "SMARTLOGIC_CLIENT_SECRET",
+	})
+
+	noAuth := app.Bool(cli.BoolOpt{
+		Name:   "noAuth",
+		Value:  false,
+		Desc:   "Whether to accept the requests without an access token",
+		EnvVar: "NO_AUTH",
+	})
+
+	tokenTTL := app.String(cli.StringOpt{
+		Name:   "tokenTTL",
+		Value:  smartlogictest.DefaultTokenTTL.String(),
+		Desc:   "How long the access tokens are valid for",
+		EnvVar: "TOKEN_TTL",
+	})
+
+	seedFile := app.String(cli.StringOpt{
+		Name:   "seedFile",
+		Desc:   "JSON-LD file with the concepts the model is seeded with, a few FT concepts are used if empty",
+		EnvVar: "SEED_FILE",
+	})
+
+	notifyURL := app.String(cli.StringOpt{
+		Name:   "notifyURL",
+		Desc:   "URL of the /notify endpoint of the smartlogic-notifier, called after each change of the model",
+		EnvVar: "NOTIFY_URL",
+	})
+
+	logLevel := app.String(cli.StringOpt{
+		Name:   "logLevel",
+		Value:  "info",
+		Desc:   "Level of logging to be shown",
+		EnvVar: "LOG_LEVEL",
+	})
+
+	app.Action = func() {
+		lvl, err := log.ParseLevel(*logLevel)
+		if err != nil {
+			log.Warnf("Log level %s could not be parsed, defaulting to info", *logLevel)
+			lvl = log.InfoLevel
+		}
+		log.SetLevel(lvl)
+		log.SetFormatter(&log.JSONFormatter{})
+
+		ttl, err := time.ParseDuration(*tokenTTL)
+		if err != nil {
+			log.WithError(err).Fatalf("Token TTL %s could not be parsed", *tokenTTL)
+		}
+
+		seed := smartlogictest.DefaultSeed()
+		if *seedFile != "" {
+			data, err := ioutil.ReadFile(*seedFile)
+			if err != nil {
+				log.WithError(err).Fatalf("Failed to read the seed file %s", *seedFile)
+			}
+			seed, err = smartlogictest.ParseSeed(data)
+			if err != nil {
+				log.WithError(err).Fatalf("Failed to start the server, invalid seed file %s", *seedFile)
+			}
+		}
+
+		opts := []func(*smartlogictest.Server){
+			smartlogictest.WithModel(*model),
+			smartlogictest.WithConceptURIPrefix(*conceptURIPrefix),
+			smartlogictest.WithAPIKey(*apiKey),
+			smartlogictest.WithClientCredentials(*clientID, *clientSecret),
+			smartlogictest.WithTokenTTL(ttl),
+			smartlogictest.WithNotifyURL(*notifyURL),
+			smartlogictest.WithSeed(seed...),
+		}
+		if *noAuth {
+			opts = append(opts, smartlogictest.WithoutAuth())
+		}
+
+		log.WithField("model", *model).WithField("concepts", len(seed)).Infof("Fake Smartlogic listening on port %s", *port)
+		if err := http.ListenAndServe(":"+*port, smartlogictest.NewServer(opts...)); err != nil {
+			log.WithError(err).Fatal("Fake Smartlogic server stopped")
+		}
+	}
+
+	err := app.Run(os.Args)
+	if err != nil {
+		log.Errorf("App could not start, error=[%s]\n", err)
+		return
+	}
+}
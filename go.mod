@@ -9,7 +9,7 @@ require (
 	github.com/Financial-Times/kafka-client-go v0.0.0-20181214120216-c3a1941e42a4
 	github.com/Financial-Times/service-status-go v0.0.0-20160323111542-3f5199736a3d
 	github.com/Financial-Times/transactionid-utils-go v0.2.0
-	github.com/Shopify/sarama v1.23.1 // indirect
+	github.com/Shopify/sarama v1.23.1
 	github.com/gorilla/context v1.1.1 // indirect
 	github.com/gorilla/handlers v1.3.0
 	github.com/gorilla/mux v1.4.1-0.20170524010104-043ee6597c29
@@ -24,7 +24,7 @@ require (
 	github.com/sirupsen/logrus v1.0.4-0.20170822132746-89742aefa4b2
 	github.com/stretchr/testify v1.3.0
 	github.com/wvanbergen/kazoo-go v0.0.0-20160930072434-968957352185 // indirect
-	golang.org/x/time v0.0.0-20190921001708-c4c64cad1fd0 // indirect
+	golang.org/x/time v0.0.0-20190921001708-c4c64cad1fd0
 	gopkg.in/airbrake/gobrake.v2 v2.0.9 // indirect
 	gopkg.in/gemnasium/logrus-airbrake-hook.v2 v2.1.2 // indirect
 	gopkg.in/jcmturner/goidentity.v3 v3.0.0 // indirect
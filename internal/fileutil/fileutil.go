@@ -0,0 +1,67 @@
+// Package fileutil holds the file helpers shared by the stores of the notifier.
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic replaces the file at path with the data. The data is written to a temporary file in the same
+// directory, synced to disk and renamed over the file, then the directory is synced too. A crash thus leaves either
+// the previous file or the new one, never a truncated file which would be trusted when it is read back.
+// The temporary file starts with a dot, so that it is skipped when listing the files of a store.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	return replaceFile(path, data, perm, true)
+}
+
+// ReplaceFile replaces the file at path with the data like WriteFileAtomic, without syncing it to disk. A crash of the
+// process still leaves either the previous file or the new one, while a crash of the host may lose the latest writes.
+// It suits the files rewritten on every message, where two syncs per write would be too slow.
+func ReplaceFile(path string, data []byte, perm os.FileMode) error {
+	return replaceFile(path, data, perm, false)
+}
+
+func replaceFile(path string, data []byte, perm os.FileMode, sync bool) error {
+	dir := filepath.Dir(path)
+	tmp, err := ioutil.TempFile(dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	// once renamed, the temporary file doesn't exist anymore and removing it is a no-op
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if sync {
+		if err := tmp.Sync(); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	if !sync {
+		return nil
+	}
+	return syncDir(dir)
+}
+
+// syncDir syncs the directory, so that the files renamed in it survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
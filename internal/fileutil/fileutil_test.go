@@ -0,0 +1,49 @@
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fileutil")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "file.json")
+
+	assert.NoError(t, WriteFileAtomic(path, []byte("first"), 0644))
+	assert.NoError(t, WriteFileAtomic(path, []byte("second"), 0644))
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1, "no temporary file should be left behind")
+
+	assert.Error(t, WriteFileAtomic(filepath.Join(dir, "missing", "file.json"), []byte("data"), 0644))
+}
+
+func TestReplaceFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fileutil")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "file")
+
+	assert.NoError(t, ReplaceFile(path, []byte("first"), 0644))
+	assert.NoError(t, ReplaceFile(path, []byte("second"), 0644))
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1, "no temporary file should be left behind")
+}
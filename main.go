@@ -1,14 +1,18 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	cli "github.com/jawher/mow.cli"
+	metrics "github.com/rcrowley/go-metrics"
 	"github.com/sethgrid/pester"
 	log "github.com/sirupsen/logrus"
 
@@ -51,6 +55,13 @@ func main() {
 		EnvVar: "KAFKA_TOPIC",
 	})
 
+	sinks := app.String(cli.StringOpt{
+		Name:   "sinks",
+		Value:  notifier.SinkKafka,
+		Desc:   "Comma separated list of the sinks the concepts are published to: kafka, stdout, file:<path>, dir:<path> or webhook:<url>",
+		EnvVar: "SINKS",
+	})
+
 	smartlogicBaseURL := app.String(cli.StringOpt{
 		Name:   "smartlogicBaseURL",
 		Desc:   "Base URL for the Smartlogic instance",
@@ -63,12 +74,50 @@ func main() {
 		EnvVar: "SMARTLOGIC_MODEL",
 	})
 
+	smartlogicAuthType := app.String(cli.StringOpt{
+		Name:   "smartlogicAuthType",
+		Value:  smartlogic.AuthTypeAPIKey,
+		Desc:   "How to authenticate to Smartlogic: apikey, client-credentials, bearer or none",
+		EnvVar: "SMARTLOGIC_AUTH_TYPE",
+	})
+
+	smartlogicTokenURL := app.String(cli.StringOpt{
+		Name:   "smartlogicTokenURL",
+		Value:  smartlogic.DefaultTokenURL,
+		Desc:   "Smartlogic endpoint to request access tokens from",
+		EnvVar: "SMARTLOGIC_TOKEN_URL",
+	})
+
 	smartlogicAPIKey := app.String(cli.StringOpt{
 		Name:   "smartlogicAPIKey",
-		Desc:   "Smartlogic model to read from",
+		Desc:   "Smartlogic API key, used with the apikey authentication type",
 		EnvVar: "SMARTLOGIC_API_KEY",
 	})
 
+	smartlogicClientID := app.String(cli.StringOpt{
+		Name:   "smartlogicClientID",
+		Desc:   "OAuth2 client id, used with the client-credentials authentication type",
+		EnvVar: "SMARTLOGIC_CLIENT_ID",
+	})
+
+	smartlogicClientSecret := app.String(cli.StringOpt{
+		Name:   "smartlogicClientSecret",
+		Desc:   "OAuth2 client secret, used with the client-credentials authentication type",
+		EnvVar: "SMARTLOGIC_CLIENT_SECRET",
+	})
+
+	smartlogicScope := app.String(cli.StringOpt{
+		Name:   "smartlogicScope",
+		Desc:   "Optional OAuth2 scope, used with the client-credentials authentication type",
+		EnvVar: "SMARTLOGIC_SCOPE",
+	})
+
+	smartlogicBearerToken := app.String(cli.StringOpt{
+		Name:   "smartlogicBearerToken",
+		Desc:   "Static access token, used with the bearer authentication type",
+		EnvVar: "SMARTLOGIC_BEARER_TOKEN",
+	})
+
 	smartlogicTimeout := app.String(cli.StringOpt{
 		Name:   "smartlogicTimeout",
 		Desc:   "Number of seconds to wait for smartlogic to respond to our requests",
@@ -76,6 +125,212 @@ func main() {
 		Value:  "30s",
 	})
 
+	smartlogicMaxConcurrentRequests := app.Int(cli.IntOpt{
+		Name:   "smartlogicMaxConcurrentRequests",
+		Desc:   "Maximum number of requests in flight to each Smartlogic host",
+		EnvVar: "SMARTLOGIC_MAX_CONCURRENT_REQUESTS",
+		Value:  4,
+	})
+
+	smartlogicRequestsPerMinute := app.Int(cli.IntOpt{
+		Name:   "smartlogicRequestsPerMinute",
+		Desc:   "Maximum number of requests per minute to Smartlogic, apart from the health checks. 0 means no limit",
+		EnvVar: "SMARTLOGIC_REQUESTS_PER_MINUTE",
+		Value:  0,
+	})
+
+	smartlogicRequestsBurst := app.Int(cli.IntOpt{
+		Name:   "smartlogicRequestsBurst",
+		Desc:   "Number of requests which can be made to Smartlogic at once, within the requests per minute",
+		EnvVar: "SMARTLOGIC_REQUESTS_BURST",
+		Value:  10,
+	})
+
+	smartlogicBulkRequestsPerMinute := app.Int(cli.IntOpt{
+		Name:   "smartlogicBulkRequestsPerMinute",
+		Desc:   "Maximum number of requests per minute to Smartlogic made by the republish jobs, leaving the rest for the editorial notifications. 0 means no limit",
+		EnvVar: "SMARTLOGIC_BULK_REQUESTS_PER_MINUTE",
+		Value:  0,
+	})
+
+	smartlogicHealthRequestsPerMinute := app.Int(cli.IntOpt{
+		Name:   "smartlogicHealthRequestsPerMinute",
+		Desc:   "Maximum number of requests per minute to Smartlogic made by the health checks. 0 means no limit",
+		EnvVar: "SMARTLOGIC_HEALTH_REQUESTS_PER_MINUTE",
+		Value:  0,
+	})
+
+	smartlogicBreakerFailureThreshold := app.Int(cli.IntOpt{
+		Name:   "smartlogicBreakerFailureThreshold",
+		Desc:   "Number of consecutive failed Smartlogic requests opening the circuit breaker",
+		EnvVar: "SMARTLOGIC_BREAKER_FAILURE_THRESHOLD",
+		Value:  smartlogic.DefaultFailureThreshold,
+	})
+
+	smartlogicBreakerOpenTimeout := app.String(cli.StringOpt{
+		Name:   "smartlogicBreakerOpenTimeout",
+		Value:  "30s",
+		Desc:   "How long the circuit breaker fails Smartlogic requests fast before letting trial requests through",
+		EnvVar: "SMARTLOGIC_BREAKER_OPEN_TIMEOUT",
+	})
+
+	smartlogicBreakerHalfOpenRequests := app.Int(cli.IntOpt{
+		Name:   "smartlogicBreakerHalfOpenRequests",
+		Desc:   "Number of successful trial requests closing the circuit breaker again",
+		EnvVar: "SMARTLOGIC_BREAKER_HALF_OPEN_REQUESTS",
+		Value:  smartlogic.DefaultHalfOpenRequests,
+	})
+
+	smartlogicChangesWindow := app.String(cli.StringOpt{
+		Name:   "smartlogicChangesWindow",
+		Desc:   "Duration of the time windows the changes since the last notification are requested in, e.g. 1h. If not set, all the changes are requested at once",
+		EnvVar: "SMARTLOGIC_CHANGES_WINDOW",
+	})
+
+	smartlogicChangesPageSize := app.Int(cli.IntOpt{
+		Name:   "smartlogicChangesPageSize",
+		Desc:   "Number of change sets requested per page from the Smartlogic changes API. If 0, changes are not paged",
+		EnvVar: "SMARTLOGIC_CHANGES_PAGE_SIZE",
+		Value:  0,
+	})
+
+	smartlogicConceptsPageSize := app.Int(cli.IntOpt{
+		Name:   "smartlogicConceptsPageSize",
+		Desc:   "Number of concepts requested per page when listing all the concepts of a model",
+		EnvVar: "SMARTLOGIC_CONCEPTS_PAGE_SIZE",
+		Value:  smartlogic.DefaultConceptsPageSize,
+	})
+
+	smartlogicCacheTTL := app.String(cli.StringOpt{
+		Name:   "smartlogicCacheTTL",
+		Desc:   "How long concepts got from Smartlogic are cached for. If not set, concepts are not cached",
+		EnvVar: "SMARTLOGIC_CACHE_TTL",
+	})
+
+	smartlogicCacheMaxEntries := app.Int(cli.IntOpt{
+		Name:   "smartlogicCacheMaxEntries",
+		Desc:   "Number of concepts cached per Smartlogic model",
+		EnvVar: "SMARTLOGIC_CACHE_MAX_ENTRIES",
+		Value:  smartlogic.DefaultCacheMaxEntries,
+	})
+
+	smartlogicCacheServeStale := app.Bool(cli.BoolOpt{
+		Name:   "smartlogicCacheServeStale",
+		Desc:   "Whether to serve expired cached concepts when Smartlogic fails to return them",
+		EnvVar: "SMARTLOGIC_CACHE_SERVE_STALE",
+		Value:  false,
+	})
+
+	cascadePredicates := app.String(cli.StringOpt{
+		Name:   "cascadePredicates",
+		Desc:   "Comma separated list of the relations, e.g. hasSubBrand, along which the notifications cascade to the related concepts. If not set, the notifications don't cascade",
+		EnvVar: "CASCADE_PREDICATES",
+	})
+
+	cascadeDepth := app.Int(cli.IntOpt{
+		Name:   "cascadeDepth",
+		Desc:   "Number of relations the notifications cascade along from the notified concepts",
+		EnvVar: "CASCADE_DEPTH",
+		Value:  notifier.DefaultCascadeDepth,
+	})
+
+	contentHashStore := app.String(cli.StringOpt{
+		Name:   "contentHashStore",
+		Desc:   "Where the content hashes of the published concepts are kept, to skip publishing the concepts which are unchanged: memory or file. If not set, the concepts are always published",
+		EnvVar: "CONTENT_HASH_STORE",
+	})
+
+	contentHashDir := app.String(cli.StringOpt{
+		Name:   "contentHashDir",
+		Desc:   "Directory the content hashes are kept in by the file store, with a subdirectory per model",
+		EnvVar: "CONTENT_HASH_DIR",
+	})
+
+	messageVersionDir := app.String(cli.StringOpt{
+		Name:   "messageVersionDir",
+		Desc:   "Directory the last message version of each concept is kept in, so that the versions keep increasing across restarts. If not set, they are kept in memory only",
+		EnvVar: "MESSAGE_VERSION_DIR",
+	})
+
+	outboxDir := app.String(cli.StringOpt{
+		Name:   "outboxDir",
+		Desc:   "Directory the accepted notifications are kept in until they are published, so that they are notified again after a restart. If not set, they are kept in memory only",
+		EnvVar: "OUTBOX_DIR",
+	})
+
+	outboxRedriveInterval := app.String(cli.StringOpt{
+		Name:   "outboxRedriveInterval",
+		Desc:   "How often the notifications left in the outbox after failing are notified again",
+		EnvVar: "OUTBOX_REDRIVE_INTERVAL",
+		Value:  "1m",
+	})
+
+	deadLetterStore := app.String(cli.StringOpt{
+		Name:   "deadLetterStore",
+		Desc:   "Where the concepts which failed to be published are kept until they are retried successfully: memory or file. If not set, the failed concepts are only logged",
+		EnvVar: "DEAD_LETTER_STORE",
+	})
+
+	deadLetterDir := app.String(cli.StringOpt{
+		Name:   "deadLetterDir",
+		Desc:   "Directory the failed concepts are kept in by the file store, with a subdirectory per model",
+		EnvVar: "DEAD_LETTER_DIR",
+	})
+
+	deadLetterMaxAttempts := app.Int(cli.IntOpt{
+		Name:   "deadLetterMaxAttempts",
+		Desc:   "Number of times a concept may fail before it isn't retried automatically anymore",
+		EnvVar: "DEAD_LETTER_MAX_ATTEMPTS",
+		Value:  notifier.DefaultRetryPolicy.MaxAttempts,
+	})
+
+	deadLetterBackoff := app.String(cli.StringOpt{
+		Name:   "deadLetterBackoff",
+		Desc:   "Delay before a failed concept is first retried, doubling after each failure",
+		EnvVar: "DEAD_LETTER_BACKOFF",
+		Value:  notifier.DefaultRetryPolicy.InitialBackoff.String(),
+	})
+
+	deadLetterMaxBackoff := app.String(cli.StringOpt{
+		Name:   "deadLetterMaxBackoff",
+		Desc:   "Maximum delay between the retries of a failed concept",
+		EnvVar: "DEAD_LETTER_MAX_BACKOFF",
+		Value:  notifier.DefaultRetryPolicy.MaxBackoff.String(),
+	})
+
+	smartlogicRecordFile := app.String(cli.StringOpt{
+		Name:   "smartlogicRecordFile",
+		Desc:   "File the requests made to Smartlogic and the responses got are recorded to, with the credentials and tokens redacted. If not set, nothing is recorded",
+		EnvVar: "SMARTLOGIC_RECORD_FILE",
+	})
+
+	smartlogicReplayFile := app.String(cli.StringOpt{
+		Name:   "smartlogicReplayFile",
+		Desc:   "File recorded with smartlogicRecordFile to serve the Smartlogic responses from, instead of calling Smartlogic",
+		EnvVar: "SMARTLOGIC_REPLAY_FILE",
+	})
+
+	republishBatchSize := app.Int(cli.IntOpt{
+		Name:   "republishBatchSize",
+		Desc:   "Number of concepts notified at once by the republish jobs",
+		EnvVar: "REPUBLISH_BATCH_SIZE",
+		Value:  notifier.DefaultRepublishBatchSize,
+	})
+
+	republishInterval := app.String(cli.StringOpt{
+		Name:   "republishInterval",
+		Desc:   "How long the republish jobs wait between two batches",
+		EnvVar: "REPUBLISH_INTERVAL",
+		Value:  "1s",
+	})
+
+	forceNotifyParallelism := app.Int(cli.IntOpt{
+		Name:   "forceNotifyParallelism",
+		Desc:   "Number of concepts fetched and published concurrently when notifying",
+		EnvVar: "FORCE_NOTIFY_PARALLELISM",
+		Value:  4,
+	})
+
 	smartlogicHealthcheckConcept := app.String(cli.StringOpt{
 		Name:   "smartlogicHealthcheckConcept",
 		Desc:   "Concept uuid existing in the Smartlogic model to be used for healthcheck",
@@ -110,6 +365,37 @@ func main() {
 		EnvVar: "CONCEPT_URI_PREFIX",
 	})
 
+	smartlogicModels := app.String(cli.StringOpt{
+		Name:   "smartlogicModels",
+		Desc:   `JSON list of the Smartlogic models to serve, e.g. [{"model": "...", "conceptUriPrefix": "...", "healthcheckConcept": "..."}]. If not set, the single model given by smartlogicModel, conceptUriPrefix and smartlogicHealthcheckConcept is served`,
+		EnvVar: "SMARTLOGIC_MODELS",
+	})
+
+	publishDeletions := app.Bool(cli.BoolOpt{
+		Name:   "publishDeletions",
+		Desc:   "Whether to publish a deletion message for the changed concepts which no longer exist in Smartlogic. Set per model with publishDeletions in smartlogicModels",
+		EnvVar: "PUBLISH_DELETIONS",
+		Value:  false,
+	})
+
+	smartlogicNamespaces := app.String(cli.StringOpt{
+		Name:   "smartlogicNamespaces",
+		Desc:   `JSON list of the URI namespaces concepts live in, e.g. [{"prefix": "http://www.ft.com/thing/", "kind": "thing", "topic": "SmartlogicConcept"}]. If not set, the thing and managed location namespaces are used`,
+		EnvVar: "SMARTLOGIC_NAMESPACES",
+	})
+
+	smartlogicProjection := app.String(cli.StringOpt{
+		Name:   "smartlogicProjection",
+		Desc:   `JSON projection of the properties requested when getting a concept, e.g. {"properties": ["[]", "skosxl:prefLabel/skosxl:literalForm"], "types": {"Person": ["skosxl:hiddenLabel/skosxl:literalForm"]}}. Set per model with projection in smartlogicModels. If not set, the labels and the direct properties are requested`,
+		EnvVar: "SMARTLOGIC_PROJECTION",
+	})
+
+	conceptValidationRules := app.String(cli.StringOpt{
+		Name:   "conceptValidationRules",
+		Desc:   `JSON list of the rules the concepts are validated with before they are published, e.g. [{"check": "prefLabel", "severity": "block"}, {"check": "relations", "types": ["Brand"], "properties": ["hasParentBrand"], "severity": "warn"}]. The checks are prefLabel, type and relations. If not set, the concepts are not validated`,
+		EnvVar: "CONCEPT_VALIDATION_RULES",
+	})
+
 	lvl, err := log.ParseLevel(*logLevel)
 	if err != nil {
 		log.Warnf("Log level %s could not be parsed, defaulting to info", *logLevel)
@@ -130,52 +416,301 @@ func main() {
 		log.WithError(err).Fatalf("Smartlogic timeout duration %s could not be parsed", *smartlogicTimeout)
 	}
 
+	smartlogicBreakerOpenTimeoutDuration, err := time.ParseDuration(*smartlogicBreakerOpenTimeout)
+	if err != nil {
+		log.WithError(err).Fatalf("Smartlogic circuit breaker open timeout %s could not be parsed", *smartlogicBreakerOpenTimeout)
+	}
+
+	republishIntervalDuration, err := time.ParseDuration(*republishInterval)
+	if err != nil {
+		log.WithError(err).Fatalf("Republish interval %s could not be parsed", *republishInterval)
+	}
+
+	outboxRedriveIntervalDuration, err := time.ParseDuration(*outboxRedriveInterval)
+	if err != nil {
+		log.WithError(err).Fatalf("Outbox redrive interval %s could not be parsed", *outboxRedriveInterval)
+	}
+
+	retryPolicy := notifier.RetryPolicy{MaxAttempts: *deadLetterMaxAttempts}
+	retryPolicy.InitialBackoff, err = time.ParseDuration(*deadLetterBackoff)
+	if err != nil {
+		log.WithError(err).Fatalf("Dead letter backoff %s could not be parsed", *deadLetterBackoff)
+	}
+	retryPolicy.MaxBackoff, err = time.ParseDuration(*deadLetterMaxBackoff)
+	if err != nil {
+		log.WithError(err).Fatalf("Dead letter maximum backoff %s could not be parsed", *deadLetterMaxBackoff)
+	}
+
+	var smartlogicCacheTTLDuration time.Duration
+	if *smartlogicCacheTTL != "" {
+		smartlogicCacheTTLDuration, err = time.ParseDuration(*smartlogicCacheTTL)
+		if err != nil {
+			log.WithError(err).Fatalf("Smartlogic cache TTL %s could not be parsed", *smartlogicCacheTTL)
+		}
+	}
+
+	var smartlogicChangesWindowDuration time.Duration
+	if *smartlogicChangesWindow != "" {
+		smartlogicChangesWindowDuration, err = time.ParseDuration(*smartlogicChangesWindow)
+		if err != nil {
+			log.WithError(err).Fatalf("Smartlogic changes window %s could not be parsed", *smartlogicChangesWindow)
+		}
+	}
+
 	if *smartlogicBaseURL == "" {
 		log.Fatalf("Failed to start the service, smartlogicBaseURL is required.")
 	}
-	if *smartlogicModel == "" {
-		log.Fatalf("Failed to start the service, smartlogicModel is required.")
+	smartlogicAuth, err := smartlogic.NewAuthenticator(smartlogic.AuthConfig{
+		Type:         *smartlogicAuthType,
+		TokenURL:     *smartlogicTokenURL,
+		APIKey:       *smartlogicAPIKey,
+		ClientID:     *smartlogicClientID,
+		ClientSecret: *smartlogicClientSecret,
+		Scope:        *smartlogicScope,
+		BearerToken:  *smartlogicBearerToken,
+	})
+	if err != nil {
+		log.WithError(err).Fatalf("Failed to start the service, invalid Smartlogic authentication configuration.")
 	}
-	if *smartlogicAPIKey == "" {
-		log.Fatalf("Failed to start the service, smartlogicAPIKey is required.")
+
+	var modelConfigs []notifier.ModelConfig
+	if *smartlogicModels != "" {
+		modelConfigs, err = notifier.ParseModelConfigs(*smartlogicModels)
+		if err != nil {
+			log.WithError(err).Fatalf("Failed to start the service, invalid smartlogicModels configuration.")
+		}
+	} else {
+		if *smartlogicModel == "" {
+			log.Fatalf("Failed to start the service, smartlogicModel is required.")
+		}
+		if *smartlogicHealthcheckConcept == "" {
+			log.Fatalf("Failed to start the service, smartlogicHealthcheckConcept is required.")
+		}
+		modelConfigs = []notifier.ModelConfig{{
+			Model:              *smartlogicModel,
+			ConceptURIPrefix:   *conceptUriPrefix,
+			HealthcheckConcept: *smartlogicHealthcheckConcept,
+			PublishDeletions:   *publishDeletions,
+		}}
 	}
-	if *smartlogicHealthcheckConcept == "" {
-		log.Fatalf("Failed to start the service, smartlogicHealthcheckConcept is required.")
+
+	projection := smartlogic.DefaultProjection()
+	if *smartlogicProjection != "" {
+		projection, err = smartlogic.ParseProjection(*smartlogicProjection)
+		if err != nil {
+			log.WithError(err).Fatalf("Failed to start the service, invalid smartlogicProjection configuration.")
+		}
+	}
+
+	namespaces := smartlogic.DefaultNamespaces()
+	if *smartlogicNamespaces != "" {
+		namespaces, err = smartlogic.ParseNamespaces(*smartlogicNamespaces)
+		if err != nil {
+			log.WithError(err).Fatalf("Failed to start the service, invalid smartlogicNamespaces configuration.")
+		}
+	}
+	namespaceRegistry, err := smartlogic.NewNamespaceRegistry(namespaces...)
+	if err != nil {
+		log.WithError(err).Fatalf("Failed to start the service, invalid smartlogicNamespaces configuration.")
+	}
+
+	var validator *notifier.Validator
+	if *conceptValidationRules != "" {
+		rules, err := notifier.ParseValidationRules(*conceptValidationRules)
+		if err != nil {
+			log.WithError(err).Fatalf("Failed to start the service, invalid conceptValidationRules configuration.")
+		}
+		validator = notifier.NewValidator(rules, namespaceRegistry)
+	}
+
+	var cascade *notifier.Cascade
+	if predicates := notifier.ParseCascadePredicates(*cascadePredicates); len(predicates) > 0 {
+		cascade = notifier.NewCascade(predicates, *cascadeDepth, namespaceRegistry)
 	}
 
 	log.Infof("Caching successful health for %s", smartlogicHealthCacheDuration)
-	log.Infof("Checking Smartlogic health via getting concept %s of model %s", *smartlogicHealthcheckConcept, *smartlogicModel)
+	for _, mc := range modelConfigs {
+		log.Infof("Checking Smartlogic health via getting concept %s of model %s", mc.HealthcheckConcept, mc.Model)
+	}
 
 	app.Action = func() {
 		log.Infof("System code: %s, App Name: %s, Port: %s", *appSystemCode, *appName, *port)
 
 		router := mux.NewRouter()
 
-		kf, err := kafka.NewProducer(*kafkaAddresses, *kafkaTopic, kafka.DefaultProducerConfig())
+		sinkSpecs, err := notifier.ParseSinkSpecs(*sinks)
 		if err != nil {
-			log.WithField("kafkaAddresses", *kafkaAddresses).WithField("kafkaTopic", *kafkaTopic).Fatalf("Error creating the Kafka producer.")
+			log.WithError(err).Fatal("Failed to start the service, invalid sinks.")
 		}
+		sink, err := notifier.BuildSink(sinkSpecs, func() (notifier.Sink, error) {
+			kf, err := notifier.NewKeyedProducer(*kafkaAddresses, *kafkaTopic, kafka.DefaultProducerConfig())
+			if err != nil {
+				return nil, fmt.Errorf("failed to create the Kafka producer of the topic %s: %w", *kafkaTopic, err)
+			}
 
-		httpClient := getResilientClient(smartlogicTimeoutDuration)
-		sl, err := smartlogic.NewSmartlogicClient(httpClient, *smartlogicBaseURL, *smartlogicModel, *smartlogicAPIKey, *conceptUriPrefix)
+			topicProducers := map[string]kafka.Producer{}
+			for _, ns := range namespaceRegistry.Namespaces() {
+				if ns.Topic == "" || ns.Topic == *kafkaTopic || topicProducers[ns.Topic] != nil {
+					continue
+				}
+				producer, err := notifier.NewKeyedProducer(*kafkaAddresses, ns.Topic, kafka.DefaultProducerConfig())
+				if err != nil {
+					kf.Shutdown()
+					for _, p := range topicProducers {
+						p.Shutdown()
+					}
+					return nil, fmt.Errorf("failed to create the Kafka producer of the topic %s: %w", ns.Topic, err)
+				}
+				topicProducers[ns.Topic] = producer
+			}
+			topicProducers[*kafkaTopic] = kf
+			return notifier.NewKafkaSink(kf, notifier.WithTopicProducers(topicProducers)), nil
+		})
 		if err != nil {
-			log.Error("Error generating access token when connecting to Smartlogic.  If this continues to fail, please check the configuration.")
+			log.WithError(err).WithField("kafkaAddresses", *kafkaAddresses).Fatal("Failed to create the sinks")
 		}
+		defer sink.Close()
+		log.WithField("sinks", sink.Name()).Info("Publishing the concepts")
+
+		rateLimitedClient := smartlogic.NewRateLimitedClient(
+			smartlogic.NewHostLimitedClient(getResilientClient(smartlogicTimeoutDuration), *smartlogicMaxConcurrentRequests),
+			smartlogic.PerMinute(*smartlogicRequestsPerMinute), *smartlogicRequestsBurst,
+			smartlogic.WithBulkRate(smartlogic.PerMinute(*smartlogicBulkRequestsPerMinute), *smartlogicRequestsBurst),
+			smartlogic.WithHealthRate(smartlogic.PerMinute(*smartlogicHealthRequestsPerMinute), 1))
+		breaker := smartlogic.NewCircuitBreaker(rateLimitedClient,
+			smartlogic.WithFailureThreshold(*smartlogicBreakerFailureThreshold),
+			smartlogic.WithOpenTimeout(smartlogicBreakerOpenTimeoutDuration),
+			smartlogic.WithHalfOpenRequests(*smartlogicBreakerHalfOpenRequests))
+		var httpClient smartlogic.HTTPClient = breaker
+		if *smartlogicReplayFile != "" {
+			cassette, err := smartlogic.LoadCassette(*smartlogicReplayFile)
+			if err != nil {
+				log.WithError(err).Fatalf("Failed to start the service, invalid smartlogicReplayFile.")
+			}
+			log.WithField("cassette", *smartlogicReplayFile).Warn("Replaying the recorded Smartlogic responses instead of calling Smartlogic")
+			httpClient = smartlogic.NewReplayingClient(cassette)
+		}
+		if *smartlogicRecordFile != "" {
+			log.WithField("cassette", *smartlogicRecordFile).Warn("Recording the Smartlogic requests and responses")
+			recorder, err := smartlogic.NewRecordingClient(httpClient, *smartlogicRecordFile)
+			if err != nil {
+				log.WithError(err).Fatalf("Failed to start the service, invalid smartlogicRecordFile.")
+			}
+			defer func() {
+				if err := recorder.Close(); err != nil {
+					log.WithError(err).Error("Failed to write the recorded Smartlogic interactions")
+				}
+			}()
+			httpClient = recorder
+		}
+		// the versions are shared by all the models, as a concept may be published by any of them
+		var versionStore notifier.VersionStore = notifier.NewMemoryVersionStore()
+		if *messageVersionDir != "" {
+			versionStore, err = notifier.NewFileVersionStore(*messageVersionDir)
+			if err != nil {
+				log.WithError(err).Fatal("Failed to initialize the message versions")
+			}
+		}
+		versions := notifier.NewMessageVersions(versionStore)
+		models, err := notifier.BuildModelRegistry(modelConfigs, func(mc notifier.ModelConfig) (notifier.Servicer, error) {
+			modelProjection := projection
+			if mc.Projection != nil {
+				modelProjection = *mc.Projection
+			}
+			sl, err := smartlogic.NewSmartlogicClient(httpClient, *smartlogicBaseURL, mc.Model, smartlogicAuth, mc.ConceptURIPrefix,
+				smartlogic.WithNamespaces(namespaceRegistry),
+				smartlogic.WithChangesWindow(smartlogicChangesWindowDuration),
+				smartlogic.WithChangesPageSize(*smartlogicChangesPageSize),
+				smartlogic.WithConceptsPageSize(*smartlogicConceptsPageSize),
+				smartlogic.WithProjection(modelProjection))
+			if sl == nil {
+				return nil, fmt.Errorf("failed to create the Smartlogic client: %w", err)
+			}
+			if err != nil {
+				log.WithField("model", mc.Model).WithError(err).Error("Error generating access token when connecting to Smartlogic.  If this continues to fail, please check the configuration.")
+			}
+			if smartlogicCacheTTLDuration > 0 {
+				sl = smartlogic.NewCachedClient(sl,
+					smartlogic.WithCacheTTL(smartlogicCacheTTLDuration),
+					smartlogic.WithCacheMaxEntries(*smartlogicCacheMaxEntries),
+					smartlogic.WithStaleOnError(*smartlogicCacheServeStale),
+					smartlogic.WithCacheMetrics(metrics.DefaultRegistry, "smartlogic.cache."+mc.Model))
+			}
+			serviceOpts := []func(*notifier.Service){
+				notifier.WithParallelism(*forceNotifyParallelism),
+				notifier.WithDeletionEvents(mc.PublishDeletions),
+				notifier.WithValidator(validator),
+				notifier.WithCascade(cascade),
+				notifier.WithMessageVersions(versions),
+			}
+			if *contentHashStore != "" {
+				dir := *contentHashDir
+				if dir != "" {
+					dir = filepath.Join(dir, mc.Model)
+				}
+				hashes, err := notifier.NewHashStore(*contentHashStore, dir)
+				if err != nil {
+					return nil, fmt.Errorf("failed to create the content hash store: %w", err)
+				}
+				serviceOpts = append(serviceOpts, notifier.WithHashStore(hashes))
+			}
+			if *deadLetterStore != "" {
+				dir := *deadLetterDir
+				if dir != "" {
+					dir = filepath.Join(dir, mc.Model)
+				}
+				store, err := notifier.NewDeadLetterStore(*deadLetterStore, dir)
+				if err != nil {
+					return nil, fmt.Errorf("failed to create the dead letter store: %w", err)
+				}
+				serviceOpts = append(serviceOpts, notifier.WithDeadLetterQueue(notifier.NewDeadLetterQueue(store, retryPolicy)))
+			}
+			return notifier.NewNotifierService(sink, sl, serviceOpts...), nil
+		})
+		if err != nil {
+			log.WithError(err).Fatal("Failed to initialize the Smartlogic models")
+		}
+
+		// cancelled on shutdown, aborting the notifications and republish jobs in progress
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
 
-		service := notifier.NewNotifierService(kf, sl)
+		for _, model := range models.Models() {
+			service, _ := models.Get(model)
+			if queue := service.DeadLetters(); queue != nil {
+				go queue.Run(ctx, service, notifier.DeadLetterPollInterval)
+			}
+		}
 
-		handler := notifier.NewNotifierHandler(service)
+		handlerOpts := []func(*notifier.Handler){
+			notifier.WithContext(ctx),
+			notifier.WithRepublisher(notifier.NewRepublisher(*republishBatchSize, republishIntervalDuration)),
+		}
+		if *outboxDir != "" {
+			outbox, err := notifier.NewFileOutbox(*outboxDir)
+			if err != nil {
+				log.WithError(err).Fatal("Failed to initialize the outbox")
+			}
+			handlerOpts = append(handlerOpts, notifier.WithOutbox(outbox), notifier.WithOutboxRedriveInterval(outboxRedriveIntervalDuration))
+		}
+		handler := notifier.NewMultiModelHandler(models, handlerOpts...)
 		handler.RegisterEndpoints(router)
 
+		defaultModel, defaultService, _ := models.Default()
+		healthOpts := []func(*notifier.HealthService){notifier.WithCircuitBreaker(breaker)}
+		for _, mc := range modelConfigs[1:] {
+			service, _ := models.Get(mc.Model)
+			healthOpts = append(healthOpts, notifier.WithModelHealthCheck(mc.Model, mc.HealthcheckConcept, service))
+		}
 		healthServiceConfig := &notifier.HealthServiceConfig{
 			AppSystemCode:          *appSystemCode,
 			AppName:                *appName,
 			Description:            appDescription,
-			SmartlogicModel:        *smartlogicModel,
-			SmartlogicModelConcept: *smartlogicHealthcheckConcept,
+			SmartlogicModel:        defaultModel,
+			SmartlogicModelConcept: modelConfigs[0].HealthcheckConcept,
 			SuccessCacheTime:       smartlogicHealthCacheDuration,
 		}
-		healthService, err := notifier.NewHealthService(service, healthServiceConfig)
+		healthService, err := notifier.NewHealthService(defaultService, healthServiceConfig, healthOpts...)
 		if err != nil {
 			log.Fatalf("Failed to initialize health check service: %v", err)
 		}
@@ -214,6 +749,7 @@ func getResilientClient(timeout time.Duration) *pester.Client {
 	client := pester.NewExtendedClient(c)
 	client.Backoff = pester.ExponentialBackoff
 	client.MaxRetries = 5
+	// Concurrency is the number of copies of the same request pester races, the requests in flight are limited by the HostLimitedClient.
 	client.Concurrency = 1
 
 	return client
@@ -0,0 +1,71 @@
+package notifier
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
+)
+
+// DefaultCascadeDepth is the number of relations followed from the notified concepts when none is configured.
+const DefaultCascadeDepth = 1
+
+// Cascade tells which related concepts have to be notified along with a concept, e.g. the sub-brands of a brand,
+// as their representation downstream includes some of the properties of the concept.
+type Cascade struct {
+	predicates []string
+	maxDepth   int
+	namespaces *smartlogic.NamespaceRegistry
+}
+
+// NewCascade creates a cascade following the relations with the given predicates, given by IRI or local name,
+// e.g. hasSubBrand, up to maxDepth relations away from the notified concepts. The namespaces tell which
+// relations point to Smartlogic concepts.
+func NewCascade(predicates []string, maxDepth int, namespaces *smartlogic.NamespaceRegistry) *Cascade {
+	if maxDepth < 1 {
+		maxDepth = DefaultCascadeDepth
+	}
+	return &Cascade{predicates: predicates, maxDepth: maxDepth, namespaces: namespaces}
+}
+
+type noCascadeKey struct{}
+
+// WithoutCascade returns a context in which the notifications don't cascade to the related concepts, e.g. when
+// republishing a whole model, which notifies all of them anyway.
+func WithoutCascade(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCascadeKey{}, true)
+}
+
+func cascades(ctx context.Context) bool {
+	disabled, _ := ctx.Value(noCascadeKey{}).(bool)
+	return !disabled
+}
+
+// ParseCascadePredicates reads the comma separated list of predicates to cascade along.
+func ParseCascadePredicates(value string) []string {
+	var predicates []string
+	for _, p := range strings.Split(value, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			predicates = append(predicates, p)
+		}
+	}
+	return predicates
+}
+
+// related returns the UUIDs of the concepts related to the concept via the predicates of the cascade.
+// The relations to resources outside of the namespaces are not followed.
+func (c *Cascade) related(concept *smartlogic.Concept) []string {
+	var uuids []string
+	seen := map[string]bool{concept.UUID: true}
+	for _, predicate := range c.predicates {
+		for _, uri := range concept.Related(predicate) {
+			_, uuid, ok := c.namespaces.Match(uri)
+			if !ok || seen[uuid] {
+				continue
+			}
+			seen[uuid] = true
+			uuids = append(uuids, uuid)
+		}
+	}
+	return uuids
+}
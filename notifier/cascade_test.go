@@ -0,0 +1,36 @@
+package notifier
+
+import (
+	"testing"
+
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCascadePredicates(t *testing.T) {
+	assert.Equal(t, []string{"hasSubBrand", "http://www.ft.com/ontology/subBrandOf"},
+		ParseCascadePredicates(" hasSubBrand,,http://www.ft.com/ontology/subBrandOf "))
+	assert.Nil(t, ParseCascadePredicates(""))
+}
+
+func TestCascade_Related(t *testing.T) {
+	namespaces, err := smartlogic.NewNamespaceRegistry(smartlogic.DefaultNamespaces()...)
+	assert.NoError(t, err)
+	cascade := NewCascade([]string{"hasSubBrand", "http://www.ft.com/ontology/hasParentBrand"}, 0, namespaces)
+	assert.Equal(t, DefaultCascadeDepth, cascade.maxDepth)
+
+	concept := &smartlogic.Concept{
+		UUID: "brand",
+		Relations: map[string][]string{
+			"hasSubBrand": {
+				"http://www.ft.com/thing/sub-brand",
+				"http://www.ft.com/thing/brand",
+				"http://example.com/thing/external",
+			},
+			"hasParentBrand":          {"http://www.ft.com/thing/parent-brand", "http://www.ft.com/thing/sub-brand"},
+			"isPrimarilyClassifiedBy": {"http://www.ft.com/thing/topic"},
+		},
+	}
+	assert.Equal(t, []string{"sub-brand", "parent-brand"}, cascade.related(concept),
+		"only the concepts related via the predicates should be followed, once and without the concept itself")
+}
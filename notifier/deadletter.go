@@ -0,0 +1,419 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/smartlogic-notifier/internal/fileutil"
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
+	log "github.com/sirupsen/logrus"
+)
+
+// Supported kinds of dead letter stores.
+const (
+	DeadLetterStoreMemory = "memory"
+	DeadLetterStoreFile   = "file"
+)
+
+// DeadLetterPollInterval is how often the dead letters due for a retry are looked for.
+const DeadLetterPollInterval = 10 * time.Second
+
+var ErrNoDeadLetter = errors.New("the concept is not dead-lettered")
+
+// DeadLetter is a concept which failed to be published, kept until it is published or discarded.
+type DeadLetter struct {
+	UUID  string `json:"uuid"`
+	Error string `json:"error"`
+	// Attempts is the number of times the concept failed, including the notification it first failed in.
+	Attempts int `json:"attempts"`
+	// TransactionID is the one of the notification the concept first failed in, which the retries are made with.
+	TransactionID string    `json:"transactionId"`
+	FirstFailed   time.Time `json:"firstFailed"`
+	LastFailed    time.Time `json:"lastFailed"`
+	// NextRetry is when the concept is retried automatically. It isn't set once the retries are exhausted, or when
+	// the failure is terminal.
+	NextRetry *time.Time `json:"nextRetry,omitempty"`
+	// Terminal is set when the concept last failed in a way retrying can't fix, see terminal.
+	Terminal bool `json:"terminal,omitempty"`
+}
+
+// DeadLetterStore keeps the dead letters of a model.
+type DeadLetterStore interface {
+	// Get returns the dead letter of the concept, or false if there is none.
+	Get(conceptUUID string) (DeadLetter, bool, error)
+	Put(letter DeadLetter) error
+	Delete(conceptUUID string) error
+	List() ([]DeadLetter, error)
+}
+
+// NewDeadLetterStore returns the dead letter store of the given kind. The file store keeps the dead letters in the directory.
+func NewDeadLetterStore(kind string, dir string) (DeadLetterStore, error) {
+	switch kind {
+	case DeadLetterStoreMemory:
+		return NewMemoryDeadLetterStore(), nil
+	case DeadLetterStoreFile:
+		if dir == "" {
+			return nil, fmt.Errorf("a directory is required for the %s dead letter store", DeadLetterStoreFile)
+		}
+		store, err := NewFileDeadLetterStore(dir)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+	return nil, fmt.Errorf("unknown dead letter store %q", kind)
+}
+
+// RetryPolicy tells when the dead letters are retried automatically. The delay before a retry doubles after each
+// failure, from InitialBackoff up to MaxBackoff, and the concepts which failed MaxAttempts times aren't retried anymore.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy used when none is configured.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Minute, MaxBackoff: time.Hour}
+
+// backoff returns the delay before retrying a concept which failed the given number of times, or false if it
+// isn't retried anymore.
+func (p RetryPolicy) backoff(attempts int) (time.Duration, bool) {
+	if attempts >= p.MaxAttempts {
+		return 0, false
+	}
+	delay := p.InitialBackoff
+	for i := 1; i < attempts && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay, true
+}
+
+// DeadLetterQueue records the concepts of a model which failed to be published and retries them.
+type DeadLetterQueue struct {
+	store  DeadLetterStore
+	policy RetryPolicy
+	now    func() time.Time
+
+	// mu serialises the updates of the dead letters, which are read before being written.
+	mu sync.Mutex
+}
+
+// NewDeadLetterQueue creates a queue keeping the dead letters in the store and retrying them according to the policy.
+func NewDeadLetterQueue(store DeadLetterStore, policy RetryPolicy) *DeadLetterQueue {
+	return &DeadLetterQueue{store: store, policy: policy, now: time.Now}
+}
+
+// List returns the dead letters, the oldest first.
+func (q *DeadLetterQueue) List() ([]DeadLetter, error) {
+	letters, err := q.store.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the dead letters: %w", err)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		if !letters[i].FirstFailed.Equal(letters[j].FirstFailed) {
+			return letters[i].FirstFailed.Before(letters[j].FirstFailed)
+		}
+		return letters[i].UUID < letters[j].UUID
+	})
+	return letters, nil
+}
+
+// Get returns the dead letter of the concept, or ErrNoDeadLetter.
+func (q *DeadLetterQueue) Get(conceptUUID string) (DeadLetter, error) {
+	letter, ok, err := q.store.Get(conceptUUID)
+	if err != nil {
+		return letter, fmt.Errorf("failed to get the dead letter: %w", err)
+	}
+	if !ok {
+		return letter, fmt.Errorf("%w: %s", ErrNoDeadLetter, conceptUUID)
+	}
+	return letter, nil
+}
+
+// Discard forgets the concept without publishing it.
+func (q *DeadLetterQueue) Discard(conceptUUID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, err := q.Get(conceptUUID); err != nil {
+		return err
+	}
+	return q.store.Delete(conceptUUID)
+}
+
+// Retry notifies the dead-lettered concepts again, or all of them if no UUID is given, whether their automatic
+// retries are exhausted or not. The concepts are notified with the transaction ID they first failed in.
+func (q *DeadLetterQueue) Retry(ctx context.Context, notifier Servicer, UUIDs []string) (Report, error) {
+	var letters []DeadLetter
+	if len(UUIDs) == 0 {
+		var err error
+		if letters, err = q.List(); err != nil {
+			return Report{}, err
+		}
+	}
+	for _, conceptUUID := range UUIDs {
+		letter, err := q.Get(conceptUUID)
+		if err != nil {
+			return Report{}, err
+		}
+		letters = append(letters, letter)
+	}
+	return q.retry(ctx, notifier, letters)
+}
+
+// Run retries the dead letters which are due every interval, until the context is done.
+func (q *DeadLetterQueue) Run(ctx context.Context, notifier Servicer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		due, err := q.due()
+		if err != nil {
+			log.WithError(err).Error("Failed to look for the dead letters to retry")
+			continue
+		}
+		if len(due) == 0 {
+			continue
+		}
+		log.WithField("concepts", len(due)).Info("Retrying the dead-lettered concepts")
+		if _, err := q.retry(smartlogic.WithBudget(ctx, smartlogic.BudgetBulk), notifier, due); err != nil {
+			log.WithError(err).Error("Failed to retry the dead-lettered concepts")
+		}
+	}
+}
+
+// due returns the dead letters whose next retry is due.
+func (q *DeadLetterQueue) due() ([]DeadLetter, error) {
+	letters, err := q.List()
+	if err != nil {
+		return nil, err
+	}
+	now := q.now()
+	var due []DeadLetter
+	for _, letter := range letters {
+		if letter.NextRetry != nil && !letter.NextRetry.After(now) {
+			due = append(due, letter)
+		}
+	}
+	return due, nil
+}
+
+// retry force notifies the concepts of the letters, once per transaction they first failed in. The notifier records
+// their outcomes in the queue. The concepts are got from Smartlogic rather than from the cache, which may still hold
+// the payload they failed with.
+func (q *DeadLetterQueue) retry(ctx context.Context, notifier Servicer, letters []DeadLetter) (Report, error) {
+	ctx = smartlogic.WithoutCache(ctx)
+	var transactionIDs []string
+	uuids := map[string][]string{}
+	for _, letter := range letters {
+		if _, ok := uuids[letter.TransactionID]; !ok {
+			transactionIDs = append(transactionIDs, letter.TransactionID)
+		}
+		uuids[letter.TransactionID] = append(uuids[letter.TransactionID], letter.UUID)
+	}
+
+	var report Report
+	var firstErr error
+	for _, transactionID := range transactionIDs {
+		r, err := notifier.ForceNotify(ctx, uuids[transactionID], transactionID)
+		report.Concepts = append(report.Concepts, r.Concepts...)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return report, firstErr
+}
+
+// record updates the dead letters with the outcomes of a notification: the failed concepts are dead-lettered or
+// their attempts counted, while the others are forgotten. The concepts which failed because the notification was
+// abandoned, e.g. on shutdown, are left as they were.
+func (q *DeadLetterQueue) record(outcomes []ConceptOutcome, causes []error, transactionID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, outcome := range outcomes {
+		entry := log.WithField("concept_uuid", outcome.UUID).WithField("request_transaction_id", transactionID)
+		if outcome.Status != StatusFailed {
+			if err := q.store.Delete(outcome.UUID); err != nil {
+				entry.WithError(err).Warn("Failed to delete the dead letter of the concept")
+			}
+			continue
+		}
+		var cause error
+		if i < len(causes) {
+			cause = causes[i]
+		}
+		if abandoned(cause) {
+			continue
+		}
+		if err := q.fail(outcome, transactionID, terminal(cause)); err != nil {
+			entry.WithError(err).Error("Failed to dead-letter the concept")
+		}
+	}
+}
+
+// abandoned tells whether the concept failed because the notification was abandoned, e.g. on shutdown.
+func abandoned(cause error) bool {
+	return errors.Is(cause, context.Canceled) || errors.Is(cause, context.DeadlineExceeded)
+}
+
+// terminal tells whether the concept failed because of the cause in a way retrying can't fix: the concept doesn't
+// exist in Smartlogic, or a validation rule blocks it. Such a concept is dead-lettered without being retried
+// automatically, and is only retried on demand once it is fixed in Smartlogic.
+func terminal(cause error) bool {
+	return smartlogic.ErrorCode(cause) == smartlogic.CodeConceptNotFound || errors.Is(cause, ErrInvalidConcept)
+}
+
+func (q *DeadLetterQueue) fail(outcome ConceptOutcome, transactionID string, terminal bool) error {
+	letter, ok, err := q.store.Get(outcome.UUID)
+	if err != nil {
+		return err
+	}
+	now := q.now().UTC()
+	if !ok {
+		letter = DeadLetter{UUID: outcome.UUID, TransactionID: transactionID, FirstFailed: now}
+	}
+	letter.Error = outcome.Error
+	letter.Attempts++
+	letter.LastFailed = now
+	letter.NextRetry = nil
+	letter.Terminal = terminal
+	if delay, ok := q.policy.backoff(letter.Attempts); ok && !terminal {
+		next := now.Add(delay)
+		letter.NextRetry = &next
+	}
+	return q.store.Put(letter)
+}
+
+// MemoryDeadLetterStore is a DeadLetterStore held in memory, so the dead letters are lost when the service stops.
+type MemoryDeadLetterStore struct {
+	mu      sync.RWMutex
+	letters map[string]DeadLetter
+}
+
+func NewMemoryDeadLetterStore() *MemoryDeadLetterStore {
+	return &MemoryDeadLetterStore{letters: map[string]DeadLetter{}}
+}
+
+func (s *MemoryDeadLetterStore) Get(conceptUUID string) (DeadLetter, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	letter, ok := s.letters[conceptUUID]
+	return letter, ok, nil
+}
+
+func (s *MemoryDeadLetterStore) Put(letter DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.letters[letter.UUID] = letter
+	return nil
+}
+
+func (s *MemoryDeadLetterStore) Delete(conceptUUID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.letters, conceptUUID)
+	return nil
+}
+
+func (s *MemoryDeadLetterStore) List() ([]DeadLetter, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	letters := make([]DeadLetter, 0, len(s.letters))
+	for _, letter := range s.letters {
+		letters = append(letters, letter)
+	}
+	return letters, nil
+}
+
+// FileDeadLetterStore is a DeadLetterStore keeping a JSON file per concept in a directory, so the dead letters
+// survive restarts.
+type FileDeadLetterStore struct {
+	dir string
+}
+
+// NewFileDeadLetterStore creates a store in the directory, which is created if it doesn't exist.
+func NewFileDeadLetterStore(dir string) (*FileDeadLetterStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create the dead letter directory: %w", err)
+	}
+	return &FileDeadLetterStore{dir: dir}, nil
+}
+
+func (s *FileDeadLetterStore) Get(conceptUUID string) (DeadLetter, bool, error) {
+	letter, err := s.read(s.path(conceptUUID))
+	if os.IsNotExist(err) {
+		return DeadLetter{}, false, nil
+	}
+	if err != nil {
+		return DeadLetter{}, false, err
+	}
+	return letter, true, nil
+}
+
+func (s *FileDeadLetterStore) Put(letter DeadLetter) error {
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteFileAtomic(s.path(letter.UUID), data, 0644)
+}
+
+func (s *FileDeadLetterStore) Delete(conceptUUID string) error {
+	err := os.Remove(s.path(conceptUUID))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// List reads the dead letters from their files. The files which can't be read are skipped, so that a corrupted
+// file doesn't hide the other dead letters.
+func (s *FileDeadLetterStore) List() ([]DeadLetter, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var letters []DeadLetter
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		letter, err := s.read(filepath.Join(s.dir, name))
+		if err != nil {
+			log.WithError(err).WithField("file", name).Error("Failed to read a dead letter")
+			continue
+		}
+		letters = append(letters, letter)
+	}
+	return letters, nil
+}
+
+func (s *FileDeadLetterStore) read(path string) (DeadLetter, error) {
+	var letter DeadLetter
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return letter, err
+	}
+	err = json.Unmarshal(data, &letter)
+	return letter, err
+}
+
+func (s *FileDeadLetterStore) path(conceptUUID string) string {
+	return conceptFile(s.dir, conceptUUID, ".json")
+}
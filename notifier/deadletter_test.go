@@ -0,0 +1,241 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 6, InitialBackoff: time.Minute, MaxBackoff: 5 * time.Minute}
+	tests := []struct {
+		attempts      int
+		expectedDelay time.Duration
+		expectedRetry bool
+	}{
+		{attempts: 1, expectedDelay: time.Minute, expectedRetry: true},
+		{attempts: 2, expectedDelay: 2 * time.Minute, expectedRetry: true},
+		{attempts: 3, expectedDelay: 4 * time.Minute, expectedRetry: true},
+		{attempts: 4, expectedDelay: 5 * time.Minute, expectedRetry: true},
+		{attempts: 5, expectedDelay: 5 * time.Minute, expectedRetry: true},
+		{attempts: 6, expectedRetry: false},
+	}
+	for _, test := range tests {
+		delay, retry := policy.backoff(test.attempts)
+		assert.Equal(t, test.expectedRetry, retry, "attempts %d", test.attempts)
+		assert.Equal(t, test.expectedDelay, delay, "attempts %d", test.attempts)
+	}
+}
+
+func TestDeadLetterStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletters")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fileStore, err := NewFileDeadLetterStore(dir + "/model")
+	assert.NoError(t, err)
+
+	stores := map[string]DeadLetterStore{
+		"memory": NewMemoryDeadLetterStore(),
+		"file":   fileStore,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			_, ok, err := store.Get("uuid")
+			assert.NoError(t, err)
+			assert.False(t, ok)
+
+			assert.NoError(t, store.Put(DeadLetter{UUID: "uuid", Attempts: 1}))
+			assert.NoError(t, store.Put(DeadLetter{UUID: "uuid", Attempts: 2, Error: "failed"}))
+			assert.NoError(t, store.Put(DeadLetter{UUID: "../other", Attempts: 1}))
+			letter, ok, err := store.Get("uuid")
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, DeadLetter{UUID: "uuid", Attempts: 2, Error: "failed"}, letter)
+			letters, err := store.List()
+			assert.NoError(t, err)
+			assert.Len(t, letters, 2)
+
+			assert.NoError(t, store.Delete("uuid"))
+			assert.NoError(t, store.Delete("uuid"), "deleting a missing dead letter should succeed")
+			_, ok, err = store.Get("uuid")
+			assert.NoError(t, err)
+			assert.False(t, ok)
+		})
+	}
+
+	reopened, err := NewFileDeadLetterStore(dir + "/model")
+	assert.NoError(t, err)
+	letters, err := reopened.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []DeadLetter{{UUID: "../other", Attempts: 1}}, letters, "the dead letters should survive restarts")
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(t, files, 1, "the dead letters should be kept within the directory")
+}
+
+func TestNewDeadLetterStore(t *testing.T) {
+	store, err := NewDeadLetterStore(DeadLetterStoreMemory, "")
+	assert.NoError(t, err)
+	assert.IsType(t, &MemoryDeadLetterStore{}, store)
+
+	_, err = NewDeadLetterStore(DeadLetterStoreFile, "")
+	assert.EqualError(t, err, "a directory is required for the file dead letter store")
+
+	_, err = NewDeadLetterStore("redis", "")
+	assert.EqualError(t, err, `unknown dead letter store "redis"`)
+}
+
+func TestDeadLetterQueue_Record(t *testing.T) {
+	now := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	queue := NewDeadLetterQueue(NewMemoryDeadLetterStore(), RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Minute, MaxBackoff: time.Hour})
+	queue.now = func() time.Time { return now }
+
+	queue.record([]ConceptOutcome{
+		{UUID: "uuid1", Status: StatusFailed, Error: "kafka is down"},
+		{UUID: "uuid2", Status: StatusFailed, Error: "context canceled"},
+	}, []error{errors.New("kafka is down"), context.Canceled}, "tid_first")
+	letters, err := queue.List()
+	assert.NoError(t, err)
+	next := now.Add(time.Minute)
+	assert.Equal(t, []DeadLetter{{UUID: "uuid1", Error: "kafka is down", Attempts: 1, TransactionID: "tid_first", FirstFailed: now, LastFailed: now, NextRetry: &next}},
+		letters, "the concepts abandoned because the notification was cancelled shouldn't be dead-lettered")
+
+	later := now.Add(time.Minute)
+	queue.now = func() time.Time { return later }
+	queue.record([]ConceptOutcome{{UUID: "uuid1", Status: StatusFailed, Error: "kafka is still down"}}, []error{errors.New("kafka is still down")}, "tid_retry")
+	letter, err := queue.Get("uuid1")
+	assert.NoError(t, err)
+	assert.Equal(t, DeadLetter{UUID: "uuid1", Error: "kafka is still down", Attempts: 2, TransactionID: "tid_first", FirstFailed: now, LastFailed: later},
+		letter, "the retries should be exhausted, while the original transaction ID is kept")
+
+	queue.record([]ConceptOutcome{{UUID: "uuid1", Status: StatusUnchanged}}, []error{nil}, "tid_retry")
+	_, err = queue.Get("uuid1")
+	assert.True(t, errors.Is(err, ErrNoDeadLetter), "the concept should be forgotten once it is notified successfully")
+}
+
+func TestDeadLetterQueue_RecordTerminalFailures(t *testing.T) {
+	now := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	queue := NewDeadLetterQueue(NewMemoryDeadLetterStore(), DefaultRetryPolicy)
+	queue.now = func() time.Time { return now }
+
+	notFound := fmt.Errorf("failed to get the concept: %w", smartlogic.ErrorConceptDoesNotExist)
+	invalid := blockingError([]Violation{{Rule: "prefLabel", Message: "the concept has no prefLabel", Severity: SeverityBlock}})
+	queue.record([]ConceptOutcome{
+		{UUID: "uuid1", Status: StatusFailed, Error: notFound.Error()},
+		{UUID: "uuid2", Status: StatusFailed, Error: invalid.Error()},
+	}, []error{notFound, invalid}, "tid_first")
+
+	letters, err := queue.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []DeadLetter{
+		{UUID: "uuid1", Error: notFound.Error(), Attempts: 1, TransactionID: "tid_first", FirstFailed: now, LastFailed: now, Terminal: true},
+		{UUID: "uuid2", Error: invalid.Error(), Attempts: 1, TransactionID: "tid_first", FirstFailed: now, LastFailed: now, Terminal: true},
+	}, letters, "the concepts which can't be fixed by retrying shouldn't be retried automatically")
+	due, err := queue.due()
+	assert.NoError(t, err)
+	assert.Empty(t, due)
+
+	// once fixed, a concept retried on demand failing for another reason is retried automatically again
+	queue.record([]ConceptOutcome{{UUID: "uuid1", Status: StatusFailed, Error: "kafka is down"}}, []error{errors.New("kafka is down")}, "tid_retry")
+	letter, err := queue.Get("uuid1")
+	assert.NoError(t, err)
+	assert.False(t, letter.Terminal)
+	assert.NotNil(t, letter.NextRetry)
+}
+
+func TestDeadLetterQueue_Retry(t *testing.T) {
+	now := time.Now()
+	queue := NewDeadLetterQueue(NewMemoryDeadLetterStore(), DefaultRetryPolicy)
+	queue.store.Put(DeadLetter{UUID: "uuid1", TransactionID: "tid_1", FirstFailed: now})
+	queue.store.Put(DeadLetter{UUID: "uuid2", TransactionID: "tid_2", FirstFailed: now.Add(time.Second)})
+	queue.store.Put(DeadLetter{UUID: "uuid3", TransactionID: "tid_1", FirstFailed: now.Add(2 * time.Second)})
+
+	notified := map[string][]string{}
+	service := &mockService{
+		forceNotify: func(uuids []string, transactionID string) (Report, error) {
+			notified[transactionID] = append(notified[transactionID], uuids...)
+			var report Report
+			for _, uuid := range uuids {
+				report.Concepts = append(report.Concepts, ConceptOutcome{UUID: uuid, Status: StatusPublished})
+			}
+			if transactionID == "tid_2" {
+				return report, errors.New("failed")
+			}
+			return report, nil
+		},
+	}
+
+	report, err := queue.Retry(context.Background(), service, []string{"uuid3"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"tid_1": {"uuid3"}}, notified)
+	assert.Len(t, report.Concepts, 1)
+
+	notified = map[string][]string{}
+	report, err = queue.Retry(context.Background(), service, nil)
+	assert.EqualError(t, err, "failed")
+	assert.Equal(t, map[string][]string{"tid_1": {"uuid1", "uuid3"}, "tid_2": {"uuid2"}}, notified,
+		"the concepts should be retried with the transaction they first failed in")
+	assert.Len(t, report.Concepts, 3)
+
+	_, err = queue.Retry(context.Background(), service, []string{"uuid1", "uuid4"})
+	assert.True(t, errors.Is(err, ErrNoDeadLetter))
+}
+
+func TestDeadLetterQueue_RetryBypassesCache(t *testing.T) {
+	kc := &mockKafkaClient{}
+	sl := newCachedSmartlogic(newVersionedSmartlogic())
+	_, err := sl.GetConcept(context.Background(), "uuid1")
+	assert.NoError(t, err)
+	queue := NewDeadLetterQueue(NewMemoryDeadLetterStore(), DefaultRetryPolicy)
+	queue.store.Put(DeadLetter{UUID: "uuid1", TransactionID: "tid_1"})
+	service := NewNotifierService(NewKafkaSink(kc), sl, WithDeadLetterQueue(queue))
+
+	_, err = queue.Retry(context.Background(), service, nil)
+	assert.NoError(t, err)
+	messages := kc.getSentMessages()
+	assert.Len(t, messages, 1)
+	assert.Equal(t, `{"version": 2}`, messages[0].Body, "the dead letters should be retried with the latest payload rather than the cached one")
+}
+
+func TestDeadLetterQueue_Run(t *testing.T) {
+	queue := NewDeadLetterQueue(NewMemoryDeadLetterStore(), DefaultRetryPolicy)
+	due := time.Now().Add(-time.Second)
+	notDue := time.Now().Add(time.Hour)
+	queue.store.Put(DeadLetter{UUID: "due", TransactionID: "tid", NextRetry: &due})
+	queue.store.Put(DeadLetter{UUID: "not_due", TransactionID: "tid", NextRetry: &notDue})
+	queue.store.Put(DeadLetter{UUID: "exhausted", TransactionID: "tid"})
+
+	retried := make(chan []string, 10)
+	service := &mockService{
+		forceNotify: func(uuids []string, transactionID string) (Report, error) {
+			retried <- uuids
+			queue.record([]ConceptOutcome{{UUID: uuids[0], Status: StatusPublished}}, nil, transactionID)
+			return Report{}, nil
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx, service, 10*time.Millisecond)
+
+	select {
+	case uuids := <-retried:
+		assert.Equal(t, []string{"due"}, uuids)
+	case <-time.After(time.Second):
+		t.Fatal("the due dead letter wasn't retried")
+	}
+	waitUntil(t, func() bool {
+		letters, _ := queue.List()
+		return len(letters) == 2
+	})
+	select {
+	case uuids := <-retried:
+		t.Fatalf("only the due dead letters should be retried, got %v", uuids)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
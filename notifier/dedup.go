@@ -0,0 +1,157 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Financial-Times/smartlogic-notifier/internal/fileutil"
+)
+
+// HashStore keeps the content hash of the latest payload published for each concept, so that the concepts which
+// are notified again without any change aren't published again.
+type HashStore interface {
+	// Get returns the hash of the concept, or false if there is none.
+	Get(conceptUUID string) (string, bool, error)
+	Put(conceptUUID string, hash string) error
+	Delete(conceptUUID string) error
+}
+
+// Supported kinds of hash stores.
+const (
+	HashStoreMemory = "memory"
+	HashStoreFile   = "file"
+)
+
+// NewHashStore returns the hash store of the given kind. The file store keeps the hashes in the directory.
+func NewHashStore(kind string, dir string) (HashStore, error) {
+	switch kind {
+	case HashStoreMemory:
+		return NewMemoryHashStore(), nil
+	case HashStoreFile:
+		if dir == "" {
+			return nil, fmt.Errorf("a directory is required for the %s hash store", HashStoreFile)
+		}
+		store, err := NewFileHashStore(dir)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+	return nil, fmt.Errorf("unknown hash store %q", kind)
+}
+
+type noDeduplicationKey struct{}
+
+// WithoutDeduplication returns a context in which the concepts are published even when their payload is unchanged,
+// e.g. to force downstream to ingest them again.
+func WithoutDeduplication(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noDeduplicationKey{}, true)
+}
+
+func deduplicates(ctx context.Context) bool {
+	disabled, _ := ctx.Value(noDeduplicationKey{}).(bool)
+	return !disabled
+}
+
+// contentHash returns the hash of the canonical form of a JSON payload, which doesn't depend on the order of the
+// properties nor on the whitespace. Other payloads are hashed as they are.
+func contentHash(payload []byte) string {
+	canonical := payload
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err == nil {
+		// encoding/json writes the keys of the objects in order
+		if data, err := json.Marshal(v); err == nil {
+			canonical = data
+		}
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+// MemoryHashStore is a HashStore held in memory, so it starts empty every time the service starts.
+type MemoryHashStore struct {
+	mu     sync.RWMutex
+	hashes map[string]string
+}
+
+func NewMemoryHashStore() *MemoryHashStore {
+	return &MemoryHashStore{hashes: map[string]string{}}
+}
+
+func (s *MemoryHashStore) Get(conceptUUID string) (string, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hash, ok := s.hashes[conceptUUID]
+	return hash, ok, nil
+}
+
+func (s *MemoryHashStore) Put(conceptUUID string, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hashes[conceptUUID] = hash
+	return nil
+}
+
+func (s *MemoryHashStore) Delete(conceptUUID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.hashes, conceptUUID)
+	return nil
+}
+
+// FileHashStore is a HashStore keeping a file per concept in a directory, so the hashes survive restarts.
+type FileHashStore struct {
+	dir string
+}
+
+// NewFileHashStore creates a store in the directory, which is created if it doesn't exist.
+func NewFileHashStore(dir string) (*FileHashStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create the hash store directory: %w", err)
+	}
+	return &FileHashStore{dir: dir}, nil
+}
+
+func (s *FileHashStore) Get(conceptUUID string) (string, bool, error) {
+	data, err := ioutil.ReadFile(s.path(conceptUUID))
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return string(data), true, nil
+}
+
+func (s *FileHashStore) Put(conceptUUID string, hash string) error {
+	return fileutil.WriteFileAtomic(s.path(conceptUUID), []byte(hash), 0644)
+}
+
+func (s *FileHashStore) Delete(conceptUUID string) error {
+	err := os.Remove(s.path(conceptUUID))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *FileHashStore) path(conceptUUID string) string {
+	return conceptFile(s.dir, conceptUUID, "")
+}
+
+// conceptFile returns the file of the concept in the directory of a store, with the given extension. The UUID is
+// hashed, as it comes from the requests and can't be trusted to be a safe file name.
+func conceptFile(dir string, conceptUUID string, ext string) string {
+	sum := sha256.Sum256([]byte(conceptUUID))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+ext)
+}
@@ -0,0 +1,77 @@
+package notifier
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentHash(t *testing.T) {
+	hash := contentHash([]byte(`{"@id": "http://www.ft.com/thing/uuid", "sem:guid": [{"@value": "uuid"}], "count": 1.50}`))
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, contentHash([]byte("{\n  \"sem:guid\": [{\"@value\": \"uuid\"}],\n  \"count\": 1.50,\n  \"@id\": \"http://www.ft.com/thing/uuid\"\n}")),
+		"the order of the properties and the whitespace shouldn't matter")
+	assert.NotEqual(t, hash, contentHash([]byte(`{"@id": "http://www.ft.com/thing/uuid", "sem:guid": [{"@value": "uuid"}], "count": 1.5}`)),
+		"the numbers should be kept as they are")
+	assert.NotEqual(t, hash, contentHash([]byte(`{"@id": "http://www.ft.com/thing/other"}`)))
+	assert.Equal(t, contentHash([]byte("not json")), contentHash([]byte("not json")))
+}
+
+func TestHashStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hashes")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fileStore, err := NewFileHashStore(dir + "/model")
+	assert.NoError(t, err)
+
+	stores := map[string]HashStore{
+		"memory": NewMemoryHashStore(),
+		"file":   fileStore,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			_, ok, err := store.Get("uuid")
+			assert.NoError(t, err)
+			assert.False(t, ok)
+
+			assert.NoError(t, store.Put("uuid", "hash1"))
+			assert.NoError(t, store.Put("uuid", "hash2"))
+			assert.NoError(t, store.Put("../other", "hash3"))
+			hash, ok, err := store.Get("uuid")
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, "hash2", hash)
+
+			assert.NoError(t, store.Delete("uuid"))
+			assert.NoError(t, store.Delete("uuid"), "deleting a missing hash should succeed")
+			_, ok, err = store.Get("uuid")
+			assert.NoError(t, err)
+			assert.False(t, ok)
+			hash, _, _ = store.Get("../other")
+			assert.Equal(t, "hash3", hash)
+		})
+	}
+
+	reopened, err := NewFileHashStore(dir + "/model")
+	assert.NoError(t, err)
+	hash, ok, err := reopened.Get("../other")
+	assert.NoError(t, err)
+	assert.True(t, ok, "the hashes should survive restarts")
+	assert.Equal(t, "hash3", hash)
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(t, files, 1, "the hashes should be kept within the directory")
+}
+
+func TestNewHashStore(t *testing.T) {
+	store, err := NewHashStore(HashStoreMemory, "")
+	assert.NoError(t, err)
+	assert.IsType(t, &MemoryHashStore{}, store)
+
+	_, err = NewHashStore(HashStoreFile, "")
+	assert.EqualError(t, err, "a directory is required for the file hash store")
+
+	_, err = NewHashStore("redis", "")
+	assert.EqualError(t, err, `unknown hash store "redis"`)
+}
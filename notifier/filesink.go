@@ -0,0 +1,165 @@
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// defaultTopicFile is the name of the file the messages of the default topic are written to by the directory sinks.
+const defaultTopicFile = "default"
+
+// ndjsonRecord is the line written for a message by the NDJSON sinks. A JSON body is embedded compacted onto the
+// line rather than as a string, so that the lines can be processed with tools like jq.
+type ndjsonRecord struct {
+	Topic   string            `json:"topic,omitempty"`
+	Key     string            `json:"key,omitempty"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+func marshalNDJSON(message Message) ([]byte, error) {
+	body := json.RawMessage(message.Body)
+	if !json.Valid(body) {
+		var err error
+		if body, err = json.Marshal(message.Body); err != nil {
+			return nil, err
+		}
+	}
+	line, err := json.Marshal(ndjsonRecord{Topic: message.Topic, Key: message.Key, Headers: message.Headers, Body: body})
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+// NDJSONSink writes each message as a line of JSON, e.g. to run the notifier locally without Kafka.
+type NDJSONSink struct {
+	name string
+	// open returns the writer of the messages of the topic.
+	open func(topic string) (io.Writer, error)
+	// check returns an error when the messages can't be written.
+	check func() error
+
+	mu      sync.Mutex
+	writers map[string]io.Writer
+	closers []io.Closer
+	// closed is set by Close, after which the messages are rejected rather than written to closed or reopened files.
+	closed bool
+}
+
+// NewStdoutSink creates a sink writing the messages to the standard output.
+func NewStdoutSink() *NDJSONSink {
+	return &NDJSONSink{
+		name:    "stdout",
+		open:    func(string) (io.Writer, error) { return os.Stdout, nil },
+		check:   func() error { return nil },
+		writers: map[string]io.Writer{},
+	}
+}
+
+// NewFileSink creates a sink appending the messages to the file at path, which is created if it doesn't exist.
+func NewFileSink(path string) (*NDJSONSink, error) {
+	// the file is opened upfront, so that a wrong path fails on startup
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &NDJSONSink{
+		name:    "file " + path,
+		open:    func(string) (io.Writer, error) { return file, nil },
+		check:   func() error { _, err := file.Stat(); return err },
+		writers: map[string]io.Writer{},
+		closers: []io.Closer{file},
+	}, nil
+}
+
+// NewDirSink creates a sink appending the messages to a file per topic in the directory, which is created if it
+// doesn't exist. The messages of the default topic are written to default.ndjson.
+func NewDirSink(dir string) (*NDJSONSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &NDJSONSink{
+		name:    "directory " + dir,
+		writers: map[string]io.Writer{},
+		check: func() error {
+			info, err := os.Stat(dir)
+			if err == nil && !info.IsDir() {
+				err = fmt.Errorf("%s is not a directory", dir)
+			}
+			return err
+		},
+	}
+	s.open = func(topic string) (io.Writer, error) {
+		name := topic
+		if name == "" {
+			name = defaultTopicFile
+		}
+		// the topics come from the configuration, but are still kept from escaping the directory
+		name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+		file, err := os.OpenFile(filepath.Join(dir, name+".ndjson"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		s.closers = append(s.closers, file)
+		return file, nil
+	}
+	return s, nil
+}
+
+func (s *NDJSONSink) Name() string {
+	return s.name
+}
+
+// Publish writes the message with a single write, so that the lines of the messages are never interleaved.
+func (s *NDJSONSink) Publish(message Message) error {
+	line, err := marshalNDJSON(message)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return fmt.Errorf("failed to publish to %s: %w", s.name, ErrSinkClosed)
+	}
+	w, ok := s.writers[message.Topic]
+	if !ok {
+		if w, err = s.open(message.Topic); err != nil {
+			return err
+		}
+		s.writers[message.Topic] = w
+	}
+	_, err = w.Write(line)
+	return err
+}
+
+func (s *NDJSONSink) Check() error {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return ErrSinkClosed
+	}
+	return s.check()
+}
+
+// Close closes the files of the sink. It may be called several times.
+func (s *NDJSONSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	var firstErr error
+	for _, c := range s.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.closers = nil
+	s.writers = map[string]io.Writer{}
+	return firstErr
+}
@@ -1,11 +1,15 @@
 package notifier
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
@@ -24,23 +28,52 @@ var maxTimeValue = time.Unix(1<<63-62135596801, 999999999)
 // LastChangeLimit represents the upper limit to how far in the past we can reingest smartlogic updates
 var LastChangeLimit = time.Hour * 168
 
+// DefaultOutboxRedriveInterval is how often the notifications left in the outbox after failing are notified again.
+const DefaultOutboxRedriveInterval = time.Minute
+
 type Handler struct {
-	notifier  Servicer
-	ticker    Ticker
-	requestCh chan notificationRequest
+	ctx         context.Context
+	models      *ModelRegistry
+	ticker      Ticker
+	requestCh   chan notificationRequest
+	republisher *Republisher
+	outbox      Outbox
+	// redriveInterval is how often the pending items of the outbox are notified again.
+	redriveInterval time.Duration
+
+	// inFlight holds the IDs of the outbox items being notified, which aren't re-driven until they are done.
+	inFlightMu sync.Mutex
+	inFlight   map[string]bool
 }
 
+// NewNotifierHandler creates a handler serving a single Smartlogic model.
 func NewNotifierHandler(notifier Servicer, opts ...func(*Handler)) *Handler {
+	models := NewModelRegistry()
+	_ = models.Register("", notifier)
+	return NewMultiModelHandler(models, opts...)
+}
+
+// NewMultiModelHandler creates a handler serving all the Smartlogic models in the registry.
+func NewMultiModelHandler(models *ModelRegistry, opts ...func(*Handler)) *Handler {
 	h := &Handler{
-		notifier:  notifier,
-		ticker:    &ticker{ticker: time.NewTicker(5 * time.Second)},
-		requestCh: make(chan notificationRequest, 1),
+		ctx:         context.Background(),
+		models:      models,
+		ticker:      &ticker{ticker: time.NewTicker(5 * time.Second)},
+		requestCh:   make(chan notificationRequest, 1),
+		republisher: NewRepublisher(DefaultRepublishBatchSize, 0),
+		inFlight:    map[string]bool{},
+
+		redriveInterval: DefaultOutboxRedriveInterval,
 	}
 
 	for _, opt := range opts {
 		opt(h)
 	}
 
+	if h.outbox != nil {
+		// The notifications left by a restart are replayed right away, the ones failing afterwards on every interval.
+		h.redriveOutbox()
+	}
 	go h.processNotifyRequests()
 
 	return h
@@ -58,6 +91,37 @@ func WithTicker(t Ticker) func(*Handler) {
 	}
 }
 
+// WithContext sets the context of the notifications processed in the background. Once it is done,
+// the pending notifications are abandoned and no new ones are processed.
+func WithContext(ctx context.Context) func(*Handler) {
+	return func(h *Handler) {
+		h.ctx = ctx
+	}
+}
+
+// WithOutbox makes the handler persist the notifications in the outbox before acknowledging them, and remove them
+// once they are published. The notifications left in the outbox, e.g. by a restart, are replayed when the handler
+// is created, and the ones which failed are notified again periodically, see WithOutboxRedriveInterval.
+func WithOutbox(outbox Outbox) func(*Handler) {
+	return func(h *Handler) {
+		h.outbox = outbox
+	}
+}
+
+// WithOutboxRedriveInterval sets how often the notifications left in the outbox after failing are notified again.
+func WithOutboxRedriveInterval(interval time.Duration) func(*Handler) {
+	return func(h *Handler) {
+		h.redriveInterval = interval
+	}
+}
+
+// WithRepublisher sets the republisher running the jobs started with the republish endpoints.
+func WithRepublisher(r *Republisher) func(*Handler) {
+	return func(h *Handler) {
+		h.republisher = r
+	}
+}
+
 func (h *Handler) HandleNotify(resp http.ResponseWriter, req *http.Request) {
 	vars := req.URL.Query()
 	var notSet []string
@@ -84,18 +148,42 @@ func (h *Handler) HandleNotify(resp http.ResponseWriter, req *http.Request) {
 		writeJSONResponseMessage(resp, http.StatusBadRequest, responseData{Msg: err.Error()})
 		return
 	}
-	go func() {
-		transactionID := req.Header.Get(transactionidutils.TransactionIDHeader)
-		h.requestCh <- notificationRequest{
-			notifySince:   lastChange,
-			transactionID: transactionID,
+
+	model, _, ok := h.models.Lookup(modifiedGraphId)
+	if !ok {
+		writeJSONResponseMessage(resp, http.StatusBadRequest, responseData{Msg: "Unknown model " + modifiedGraphId})
+		return
+	}
+
+	n := notificationRequest{
+		model:         model,
+		notifySince:   lastChange,
+		transactionID: req.Header.Get(transactionidutils.TransactionIDHeader),
+	}
+	if h.outbox != nil {
+		item, err := h.outbox.Add(OutboxItem{Kind: OutboxNotify, Model: model, NotifySince: lastChange, TransactionID: n.transactionID})
+		if err != nil {
+			log.WithError(err).WithField("model", model).Error("Failed to persist the notification")
+			writeJSONResponseMessage(resp, http.StatusServiceUnavailable, responseData{Msg: "Failed to accept the notification", Err: err, Code: codeInternal})
+			return
 		}
+		h.claim(item.ID)
+		n.outboxID = item.ID
+	}
+
+	go func() {
+		h.requestCh <- n
 	}()
 
 	writeJSONResponseMessage(resp, http.StatusOK, responseData{Msg: "Concepts successfully ingested"})
 }
 
 func (h *Handler) HandleGetConcepts(resp http.ResponseWriter, req *http.Request) {
+	notifier, ok := h.serviceFor(resp, req)
+	if !ok {
+		return
+	}
+
 	vars := req.URL.Query()
 	lastChangeDate := vars.Get("lastChangeDate")
 	if lastChangeDate == "" {
@@ -109,12 +197,17 @@ func (h *Handler) HandleGetConcepts(resp http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	uuids, err := h.notifier.GetChangedConceptList(lastChange)
+	var changes interface{}
+	if details, _ := strconv.ParseBool(vars.Get("details")); details {
+		changes, err = notifier.GetChangedConcepts(req.Context(), lastChange)
+	} else {
+		changes, err = notifier.GetChangedConceptList(req.Context(), lastChange)
+	}
 	if err != nil {
-		writeJSONResponseMessage(resp, http.StatusInternalServerError, responseData{Msg: "There was an error getting the changes", Err: err})
+		writeJSONError(resp, "There was an error getting the changes", err)
 		return
 	}
-	uuidsJson, err := json.Marshal(uuids)
+	uuidsJson, err := json.Marshal(changes)
 	if err != nil {
 		writeJSONResponseMessage(resp, http.StatusInternalServerError, responseData{Msg: "There was an error encoding the response", Err: err})
 		return
@@ -124,8 +217,15 @@ func (h *Handler) HandleGetConcepts(resp http.ResponseWriter, req *http.Request)
 }
 
 func (h *Handler) HandleForceNotify(resp http.ResponseWriter, req *http.Request) {
+	model, notifier, ok := h.modelFor(resp, req)
+	if !ok {
+		return
+	}
+
 	type payload struct {
 		UUIDs []string `json:"uuids,omitempty"`
+		// Force publishes the concepts even when they are unchanged since they were last published.
+		Force bool `json:"force,omitempty"`
 	}
 	var pl payload
 	decoder := json.NewDecoder(req.Body)
@@ -140,15 +240,73 @@ func (h *Handler) HandleForceNotify(resp http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	err = h.notifier.ForceNotify(pl.UUIDs, req.Header.Get(transactionidutils.TransactionIDHeader))
+	item := OutboxItem{Kind: OutboxForceNotify, Model: model, UUIDs: pl.UUIDs, Force: pl.Force, TransactionID: req.Header.Get(transactionidutils.TransactionIDHeader)}
+	if h.outbox != nil {
+		item, err = h.outbox.Add(item)
+		if err != nil {
+			log.WithError(err).WithField("model", model).Error("Failed to persist the force notify")
+			writeJSONResponseMessage(resp, http.StatusServiceUnavailable, responseData{Msg: "Failed to accept the force notify", Err: err, Code: codeInternal})
+			return
+		}
+		h.claim(item.ID)
+	}
+
+	if h.outbox == nil {
+		// nothing would notify the concepts again, so the notification is abandoned when the client disconnects
+		report, err := h.forceNotify(req.Context(), notifier, item)
+		writeForceNotifyReport(resp, report, err)
+		return
+	}
+
+	// The notification runs in the background on the context of the handler, so that it is completed, and removed
+	// from the outbox, even when the client disconnects before it is done.
+	type result struct {
+		report Report
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		report, err := h.forceNotify(h.ctx, notifier, item)
+		done <- result{report: report, err: err}
+	}()
+	var res result
+	select {
+	case res = <-done:
+	case <-req.Context().Done():
+		log.WithField("model", model).WithField("transaction_id", item.TransactionID).Warn("The client disconnected before the force notify completed, it is completed in the background")
+		return
+	}
+
+	writeForceNotifyReport(resp, res.report, res.err)
+}
+
+func writeForceNotifyReport(resp http.ResponseWriter, report Report, err error) {
 	if err != nil {
-		writeJSONResponseMessage(resp, http.StatusInternalServerError, responseData{Msg: "There was an error completing the force notify"})
+		status, code := errorStatus(err)
+		writeJSONReport(resp, status, responseData{Msg: "There was an error completing the force notify", Code: code}, report)
 		return
 	}
-	writeResponseData(resp, http.StatusOK, "text/plain", "Concept notification completed")
+	writeJSONReport(resp, http.StatusOK, responseData{Msg: "Concept notification completed"}, report)
+}
+
+// forceNotify notifies the concepts of the force notify item, then settles the item in the outbox, if any.
+func (h *Handler) forceNotify(ctx context.Context, notifier Servicer, item OutboxItem) (Report, error) {
+	// the concepts are forced, so their latest payload is published rather than the cached one
+	ctx = smartlogic.WithoutCache(ctx)
+	if item.Force {
+		ctx = WithoutDeduplication(ctx)
+	}
+	report, err := notifier.ForceNotify(ctx, item.UUIDs, item.TransactionID)
+	h.settle(err, item.ID)
+	return report, err
 }
 
 func (h *Handler) HandleGetConcept(resp http.ResponseWriter, req *http.Request) {
+	notifier, ok := h.serviceFor(resp, req)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(req)
 	uuid, ok := vars["uuid"]
 
@@ -157,18 +315,148 @@ func (h *Handler) HandleGetConcept(resp http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	concept, err := h.notifier.GetConcept(uuid)
+	concept, err := notifier.GetConcept(req.Context(), uuid)
 	if err != nil {
-		errStatus := http.StatusInternalServerError
-		if errors.Is(err, smartlogic.ErrorConceptDoesNotExist) {
-			errStatus = http.StatusNotFound
-		}
-		writeJSONResponseMessage(resp, errStatus, responseData{Msg: "There was an error retrieving the concept", Err: err})
+		writeJSONError(resp, "There was an error retrieving the concept", err)
 		return
 	}
 	writeResponseData(resp, http.StatusOK, "application/ld+json", string(concept))
 }
 
+// HandleGetProjection returns the properties requested from Smartlogic when getting the concept.
+func (h *Handler) HandleGetProjection(resp http.ResponseWriter, req *http.Request) {
+	notifier, ok := h.serviceFor(resp, req)
+	if !ok {
+		return
+	}
+
+	projection, err := notifier.GetProjection(req.Context(), mux.Vars(req)["uuid"])
+	if err != nil {
+		writeJSONError(resp, "There was an error retrieving the concept projection", err)
+		return
+	}
+	writeJSON(resp, http.StatusOK, projection)
+}
+
+// HandleStartRepublish starts a job republishing all the concepts of the model.
+func (h *Handler) HandleStartRepublish(resp http.ResponseWriter, req *http.Request) {
+	model, notifier, ok := h.modelFor(resp, req)
+	if !ok {
+		return
+	}
+	job, err := h.republisher.Start(h.ctx, model, notifier)
+	if err != nil {
+		writeJSON(resp, http.StatusConflict, job.Status())
+		return
+	}
+	writeJSON(resp, http.StatusAccepted, job.Status())
+}
+
+// HandleRepublishStatus returns the progress of the latest republish job of the model.
+func (h *Handler) HandleRepublishStatus(resp http.ResponseWriter, req *http.Request) {
+	model, _, ok := h.modelFor(resp, req)
+	if !ok {
+		return
+	}
+	job, err := h.republisher.Job(model)
+	if err != nil {
+		writeJSONResponseMessage(resp, http.StatusNotFound, responseData{Msg: err.Error()})
+		return
+	}
+	writeJSON(resp, http.StatusOK, job.Status())
+}
+
+// HandleCancelRepublish cancels the latest republish job of the model. The job stops once the batch being
+// notified is completed.
+func (h *Handler) HandleCancelRepublish(resp http.ResponseWriter, req *http.Request) {
+	model, _, ok := h.modelFor(resp, req)
+	if !ok {
+		return
+	}
+	job, err := h.republisher.Job(model)
+	if err != nil {
+		writeJSONResponseMessage(resp, http.StatusNotFound, responseData{Msg: err.Error()})
+		return
+	}
+	job.Cancel()
+	writeJSON(resp, http.StatusAccepted, job.Status())
+}
+
+// HandleListDeadLetters returns the concepts of the model which failed to be published.
+func (h *Handler) HandleListDeadLetters(resp http.ResponseWriter, req *http.Request) {
+	_, queue, ok := h.deadLettersFor(resp, req)
+	if !ok {
+		return
+	}
+	letters, err := queue.List()
+	if err != nil {
+		writeJSONResponseMessage(resp, http.StatusInternalServerError, responseData{Msg: "There was an error listing the dead letters", Err: err, Code: codeInternal})
+		return
+	}
+	if letters == nil {
+		letters = []DeadLetter{}
+	}
+	writeJSON(resp, http.StatusOK, struct {
+		DeadLetters []DeadLetter `json:"deadLetters"`
+	}{letters})
+}
+
+// HandleGetDeadLetter returns the dead letter of a concept.
+func (h *Handler) HandleGetDeadLetter(resp http.ResponseWriter, req *http.Request) {
+	_, queue, ok := h.deadLettersFor(resp, req)
+	if !ok {
+		return
+	}
+	letter, err := queue.Get(mux.Vars(req)["uuid"])
+	if err != nil {
+		writeDeadLetterError(resp, "There was an error getting the dead letter", err)
+		return
+	}
+	writeJSON(resp, http.StatusOK, letter)
+}
+
+// HandleDiscardDeadLetter forgets a dead-lettered concept without publishing it.
+func (h *Handler) HandleDiscardDeadLetter(resp http.ResponseWriter, req *http.Request) {
+	_, queue, ok := h.deadLettersFor(resp, req)
+	if !ok {
+		return
+	}
+	if err := queue.Discard(mux.Vars(req)["uuid"]); err != nil {
+		writeDeadLetterError(resp, "There was an error discarding the dead letter", err)
+		return
+	}
+	writeJSONResponseMessage(resp, http.StatusOK, responseData{Msg: "Dead letter discarded"})
+}
+
+// HandleRetryDeadLetters notifies the dead-lettered concepts in the payload again, or all of them when the payload
+// is empty.
+func (h *Handler) HandleRetryDeadLetters(resp http.ResponseWriter, req *http.Request) {
+	notifier, queue, ok := h.deadLettersFor(resp, req)
+	if !ok {
+		return
+	}
+
+	var pl struct {
+		UUIDs []string `json:"uuids,omitempty"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&pl); err != nil && err != io.EOF {
+		writeJSONResponseMessage(resp, http.StatusBadRequest, responseData{Msg: "There was an error decoding the payload", Err: err})
+		return
+	}
+
+	report, err := queue.Retry(req.Context(), notifier, pl.UUIDs)
+	if errors.Is(err, ErrNoDeadLetter) {
+		writeDeadLetterError(resp, "There was an error retrying the dead letters", err)
+		return
+	}
+	if err != nil {
+		status, code := errorStatus(err)
+		writeJSONReport(resp, status, responseData{Msg: "There was an error retrying the dead letters", Code: code}, report)
+		return
+	}
+	writeJSONReport(resp, http.StatusOK, responseData{Msg: "Dead letters retried"}, report)
+}
+
 func (h *Handler) RegisterEndpoints(router *mux.Router) {
 	notifyHandler := handlers.MethodHandler{
 		"GET": http.HandlerFunc(h.HandleNotify),
@@ -182,16 +470,98 @@ func (h *Handler) RegisterEndpoints(router *mux.Router) {
 	getConceptsHandler := handlers.MethodHandler{
 		"GET": http.HandlerFunc(h.HandleGetConcepts),
 	}
+	getProjectionHandler := handlers.MethodHandler{
+		"GET": http.HandlerFunc(h.HandleGetProjection),
+	}
 
 	router.Handle("/notify", notifyHandler)
 	router.Handle("/force-notify", forceNotifyHandler)
 	router.Handle("/concept/{uuid}", getConceptHandler)
+	router.Handle("/concept/{uuid}/projection", getProjectionHandler)
 	router.Handle("/concepts", getConceptsHandler)
+
+	router.Handle("/models/{model}/force-notify", forceNotifyHandler)
+	router.Handle("/models/{model}/concept/{uuid}", getConceptHandler)
+	router.Handle("/models/{model}/concept/{uuid}/projection", getProjectionHandler)
+	router.Handle("/models/{model}/concepts", getConceptsHandler)
+
+	republishHandler := handlers.MethodHandler{
+		"POST":   http.HandlerFunc(h.HandleStartRepublish),
+		"GET":    http.HandlerFunc(h.HandleRepublishStatus),
+		"DELETE": http.HandlerFunc(h.HandleCancelRepublish),
+	}
+	router.Handle("/republish", republishHandler)
+	router.Handle("/models/{model}/republish", republishHandler)
+
+	deadLettersHandler := handlers.MethodHandler{
+		"GET": http.HandlerFunc(h.HandleListDeadLetters),
+	}
+	retryDeadLettersHandler := handlers.MethodHandler{
+		"POST": http.HandlerFunc(h.HandleRetryDeadLetters),
+	}
+	deadLetterHandler := handlers.MethodHandler{
+		"GET":    http.HandlerFunc(h.HandleGetDeadLetter),
+		"DELETE": http.HandlerFunc(h.HandleDiscardDeadLetter),
+	}
+	// the retry routes are registered first, as they would otherwise match the routes of a dead letter
+	router.Handle("/dead-letters", deadLettersHandler)
+	router.Handle("/dead-letters/retry", retryDeadLettersHandler)
+	router.Handle("/dead-letters/{uuid}", deadLetterHandler)
+	router.Handle("/models/{model}/dead-letters", deadLettersHandler)
+	router.Handle("/models/{model}/dead-letters/retry", retryDeadLettersHandler)
+	router.Handle("/models/{model}/dead-letters/{uuid}", deadLetterHandler)
+}
+
+// serviceFor returns the service of the model requested in the path, or the one of the default model.
+// If the model is not served by the notifier, it writes a not found response.
+func (h *Handler) serviceFor(resp http.ResponseWriter, req *http.Request) (Servicer, bool) {
+	_, service, ok := h.modelFor(resp, req)
+	return service, ok
+}
+
+// modelFor is like serviceFor, but also returns the name of the model.
+func (h *Handler) modelFor(resp http.ResponseWriter, req *http.Request) (string, Servicer, bool) {
+	model, ok := mux.Vars(req)["model"]
+	if !ok {
+		model, service, ok := h.models.Default()
+		if !ok {
+			writeJSONResponseMessage(resp, http.StatusNotFound, responseData{Msg: "No model is configured"})
+		}
+		return model, service, ok
+	}
+
+	service, ok := h.models.Get(model)
+	if !ok {
+		writeJSONResponseMessage(resp, http.StatusNotFound, responseData{Msg: "Unknown model " + model})
+	}
+	return model, service, ok
+}
+
+// deadLettersFor is like serviceFor, but also returns the dead letter queue of the model. If the model doesn't
+// record its dead letters, it writes a not found response.
+func (h *Handler) deadLettersFor(resp http.ResponseWriter, req *http.Request) (Servicer, *DeadLetterQueue, bool) {
+	model, notifier, ok := h.modelFor(resp, req)
+	if !ok {
+		return nil, nil, false
+	}
+	queue := notifier.DeadLetters()
+	if queue == nil {
+		msg := "Dead letters are not recorded"
+		if model != "" {
+			msg += " for model " + model
+		}
+		writeJSONResponseMessage(resp, http.StatusNotFound, responseData{Msg: msg})
+		return nil, nil, false
+	}
+	return notifier, queue, true
 }
 
 type notificationRequest struct {
+	model         string
 	notifySince   time.Time
 	transactionID string
+	// outboxID is the ID of the request in the outbox, if it was persisted.
+	outboxID string
 }
 
 type ticker struct {
@@ -207,17 +577,37 @@ func (t *ticker) Stop() {
 }
 
 func (h *Handler) processNotifyRequests() {
+	lastRedrive := time.Now()
 	for {
 		h.ticker.Tick()
+		if h.ctx.Err() != nil {
+			return
+		}
+
+		if h.outbox != nil && time.Since(lastRedrive) >= h.redriveInterval {
+			lastRedrive = time.Now()
+			h.redriveOutbox()
+		}
 
 		if len(h.requestCh) == 0 {
 			continue
 		}
 
-		n := notificationRequest{notifySince: maxTimeValue}
+		// coalesce the pending requests into a single one per model, notifying since the earliest of their changes
+		pending := map[string]notificationRequest{}
+		outboxIDs := map[string][]string{}
+		var models []string
 		for req := range h.requestCh {
+			n, ok := pending[req.model]
+			if !ok {
+				n = notificationRequest{notifySince: maxTimeValue}
+				models = append(models, req.model)
+			}
 			if n.notifySince.After(req.notifySince) {
-				n = req
+				pending[req.model] = req
+			}
+			if req.outboxID != "" {
+				outboxIDs[req.model] = append(outboxIDs[req.model], req.outboxID)
 			}
 
 			if len(h.requestCh) == 0 {
@@ -225,16 +615,171 @@ func (h *Handler) processNotifyRequests() {
 			}
 		}
 
-		err := h.notifier.Notify(n.notifySince, n.transactionID)
-		if err != nil {
-			log.WithError(err).Errorf("Failed to notify for a change with transaction id %s since %v", n.transactionID, n.notifySince)
+		for _, model := range models {
+			n := pending[model]
+			notifier, ok := h.models.Get(model)
+			if !ok {
+				log.Errorf("Failed to notify for a change with transaction id %s, unknown model %s", n.transactionID, model)
+				h.release(outboxIDs[model]...)
+				continue
+			}
+			err := notifier.Notify(h.ctx, n.notifySince, n.transactionID)
+			if err != nil {
+				log.WithError(err).WithField("model", model).Errorf("Failed to notify for a change with transaction id %s since %v", n.transactionID, n.notifySince)
+			}
+			h.settle(err, outboxIDs[model]...)
 		}
 	}
 }
 
+// redriveOutbox notifies again, in the background, the pending items of the outbox which aren't being notified.
+// The pending items are read before returning, so that the requests accepted afterwards aren't notified twice.
+func (h *Handler) redriveOutbox() {
+	pending, err := h.outbox.Pending()
+	if err != nil {
+		log.WithError(err).Error("Failed to replay the pending notifications")
+		return
+	}
+	var items []OutboxItem
+	for _, item := range pending {
+		if h.claim(item.ID) {
+			items = append(items, item)
+		}
+	}
+	go h.replayOutbox(items)
+}
+
+// replayOutbox notifies again the notifications left in the outbox. The notify requests are queued like new ones,
+// while the force notify requests are notified one after the other.
+func (h *Handler) replayOutbox(items []OutboxItem) {
+	if len(items) > 0 {
+		log.WithField("pending", len(items)).Info("Replaying the notifications left in the outbox")
+	}
+	for i, item := range items {
+		if h.ctx.Err() != nil {
+			for _, abandoned := range items[i:] {
+				h.release(abandoned.ID)
+			}
+			return
+		}
+		entry := log.WithField("model", item.Model).WithField("transaction_id", item.TransactionID).WithField("kind", item.Kind)
+		notifier, ok := h.models.Get(item.Model)
+		if !ok {
+			entry.Error("Dropping a pending notification of a model which isn't served anymore")
+			h.removeFromOutbox(item.ID)
+			continue
+		}
+		switch item.Kind {
+		case OutboxNotify:
+			// Smartlogic doesn't return the changes older than the limit, see validateLastChangeDate.
+			if time.Since(item.NotifySince) > LastChangeLimit {
+				entry.Errorf("Dropping a pending notification since %v, which is too old to be notified", item.NotifySince)
+				h.removeFromOutbox(item.ID)
+				continue
+			}
+			h.requestCh <- notificationRequest{model: item.Model, notifySince: item.NotifySince, transactionID: item.TransactionID, outboxID: item.ID}
+		case OutboxForceNotify:
+			if time.Since(item.Accepted) > LastChangeLimit {
+				entry.Errorf("Dropping a pending force notify accepted at %v, which is too old to be notified", item.Accepted)
+				h.removeFromOutbox(item.ID)
+				continue
+			}
+			if _, err := h.forceNotify(h.ctx, notifier, item); err != nil {
+				entry.WithError(err).Error("Failed to replay a pending force notify")
+			}
+		default:
+			entry.Error("Dropping a pending notification of an unknown kind")
+			h.removeFromOutbox(item.ID)
+		}
+	}
+}
+
+func (h *Handler) removeFromOutbox(id string) {
+	if h.outbox == nil || id == "" {
+		return
+	}
+	if err := h.outbox.Remove(id); err != nil {
+		log.WithError(err).WithField("outbox_id", id).Error("Failed to remove a published notification from the outbox")
+	}
+	h.release(id)
+}
+
+// settle removes the outbox items of a notification once it is published, or once it failed in a way notifying it
+// again wouldn't fix, e.g. when its failed concepts are retried by the dead letter queue. The others are left to be
+// re-driven.
+func (h *Handler) settle(err error, ids ...string) {
+	if err != nil && retryable(err) {
+		h.release(ids...)
+		return
+	}
+	for _, id := range ids {
+		h.removeFromOutbox(id)
+	}
+}
+
+// claim marks the outbox item as being notified. It returns false if it already was.
+func (h *Handler) claim(id string) bool {
+	h.inFlightMu.Lock()
+	defer h.inFlightMu.Unlock()
+	if h.inFlight[id] {
+		return false
+	}
+	h.inFlight[id] = true
+	return true
+}
+
+// release marks the outbox items as not being notified anymore, so that they are re-driven if still pending.
+func (h *Handler) release(ids ...string) {
+	h.inFlightMu.Lock()
+	defer h.inFlightMu.Unlock()
+	for _, id := range ids {
+		delete(h.inFlight, id)
+	}
+}
+
+// Codes of the errors which weren't caused by Smartlogic.
+const (
+	codeInternal       = "internal_error"
+	codeInvalidConcept = "invalid_concept"
+)
+
+// errorStatus returns the status and the machine readable code of the response to a request which failed with the error.
+func errorStatus(err error) (int, string) {
+	code := smartlogic.ErrorCode(err)
+	if code == "" && errors.Is(err, ErrInvalidConcept) {
+		return http.StatusUnprocessableEntity, codeInvalidConcept
+	}
+	switch code {
+	case smartlogic.CodeConceptNotFound:
+		return http.StatusNotFound, code
+	case smartlogic.CodeUnauthorized:
+		return http.StatusUnauthorized, code
+	case smartlogic.CodeUpstream, smartlogic.CodeMalformedResponse:
+		return http.StatusBadGateway, code
+	case smartlogic.CodeCircuitOpen:
+		return http.StatusServiceUnavailable, code
+	case smartlogic.CodeTimeout:
+		return http.StatusGatewayTimeout, code
+	case smartlogic.CodeRateLimited:
+		return http.StatusTooManyRequests, code
+	}
+	return http.StatusInternalServerError, codeInternal
+}
+
+// writeDeadLetterError writes the response to a dead letter request which failed with the error, with not found when
+// the concept is not dead-lettered.
+func writeDeadLetterError(w http.ResponseWriter, msg string, err error) {
+	if errors.Is(err, ErrNoDeadLetter) {
+		writeJSONResponseMessage(w, http.StatusNotFound, responseData{Msg: msg, Err: err})
+		return
+	}
+	writeJSONResponseMessage(w, http.StatusInternalServerError, responseData{Msg: msg, Err: err, Code: codeInternal})
+}
+
 type responseData struct {
-	Msg string
-	Err error
+	Msg  string
+	Err  error
+	Code string
 }
 
 func writeResponseData(w http.ResponseWriter, statusCode int, contentType string, msg string) {
@@ -246,12 +791,50 @@ func writeResponseData(w http.ResponseWriter, statusCode int, contentType string
 	_, _ = w.Write([]byte(msg))
 }
 
+// writeJSONResponseMessage writes the message of the response. The messages are encoded, as the errors may quote the
+// bodies of the Smartlogic responses.
 func writeJSONResponseMessage(w http.ResponseWriter, statusCode int, resp responseData) {
-	msg := `{"message": "` + resp.Msg + `"}`
+	body := struct {
+		Message string `json:"message"`
+		Error   string `json:"error,omitempty"`
+		Code    string `json:"code,omitempty"`
+	}{Message: resp.Msg, Code: resp.Code}
 	if resp.Err != nil {
-		msg = `{"message": "` + resp.Msg + `", "error": "` + resp.Err.Error() + `"}`
+		body.Error = resp.Err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeJSONError writes the response to a request which failed with the error, with the status and the code
+// matching the kind of the error.
+func writeJSONError(w http.ResponseWriter, msg string, err error) {
+	statusCode, code := errorStatus(err)
+	writeJSONResponseMessage(w, statusCode, responseData{Msg: msg, Err: err, Code: code})
+}
+
+// writeJSONReport writes the outcome of each concept of a notification together with a summary message.
+func writeJSONReport(w http.ResponseWriter, statusCode int, resp responseData, report Report) {
+	body, err := json.Marshal(struct {
+		Message string `json:"message"`
+		Code    string `json:"code,omitempty"`
+		Report
+	}{Message: resp.Msg, Code: resp.Code, Report: report})
+	if err != nil {
+		writeJSONResponseMessage(w, http.StatusInternalServerError, responseData{Msg: "There was an error encoding the response", Err: err})
+		return
+	}
+	writeResponseData(w, statusCode, "application/json", string(body))
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeJSONResponseMessage(w, http.StatusInternalServerError, responseData{Msg: "There was an error encoding the response", Err: err})
+		return
 	}
-	writeResponseData(w, statusCode, "application/json", msg)
+	writeResponseData(w, statusCode, "application/json", string(body))
 }
 
 func validateLastChangeDate(change string) (time.Time, error) {
@@ -2,11 +2,14 @@ package notifier
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	http "net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
@@ -93,10 +96,14 @@ func TestHandlers(t *testing.T) {
 			url:         "/force-notify",
 			requestBody: `{"uuids": ["1","2","3"]}`,
 			resultCode:  200,
-			resultBody:  "Concept notification completed",
+			resultBody:  `{"message":"Concept notification completed","concepts":[{"uuid":"1","status":"published"},{"uuid":"2","status":"published"},{"uuid":"3","status":"published"}]}`,
 			mockService: &mockService{
-				forceNotify: func(strings []string, s string) error {
-					return nil
+				forceNotify: func(uuids []string, s string) (Report, error) {
+					report := Report{}
+					for _, uuid := range uuids {
+						report.Concepts = append(report.Concepts, ConceptOutcome{UUID: uuid, Status: StatusPublished})
+					}
+					return report, nil
 				},
 			},
 		},
@@ -115,10 +122,39 @@ func TestHandlers(t *testing.T) {
 			url:         "/force-notify",
 			requestBody: `{"uuids": ["1","2","3"]}`,
 			resultCode:  500,
-			resultBody:  "{\"message\": \"There was an error completing the force notify\"}",
+			resultBody:  `{"message":"There was an error completing the force notify","code":"internal_error","concepts":[{"uuid":"1","status":"failed","error":"not found"}]}`,
+			mockService: &mockService{
+				forceNotify: func(uuids []string, s string) (Report, error) {
+					return Report{Concepts: []ConceptOutcome{{UUID: "1", Status: StatusFailed, Error: "not found"}}}, errors.New("error in force notify")
+				},
+			},
+		},
+		{
+			name:        "Force Notify - Unauthorized",
+			method:      "POST",
+			url:         "/force-notify",
+			requestBody: `{"uuids": ["1"]}`,
+			resultCode:  401,
+			resultBody:  `{"message":"There was an error completing the force notify","code":"unauthorized","concepts":[{"uuid":"1","status":"failed","error":"failed to get a valid access token"}]}`,
 			mockService: &mockService{
-				forceNotify: func(strings []string, s string) error {
-					return errors.New("error in force notify")
+				forceNotify: func(uuids []string, s string) (Report, error) {
+					cause := &smartlogic.Error{Kind: smartlogic.ErrUnauthorized, Err: errors.New("failed to get a valid access token")}
+					return Report{Concepts: []ConceptOutcome{{UUID: "1", Status: StatusFailed, Error: cause.Error()}}}, fmt.Errorf("There was an error with 1 concept ingestions: %w", cause)
+				},
+			},
+		},
+		{
+			name:        "Force Notify - Invalid concept",
+			method:      "POST",
+			url:         "/force-notify",
+			requestBody: `{"uuids": ["1"]}`,
+			resultCode:  422,
+			resultBody:  `{"message":"There was an error completing the force notify","code":"invalid_concept","concepts":[{"uuid":"1","status":"failed","error":"concept failed validation: the concept has no prefLabel","violations":[{"rule":"label","severity":"block","message":"the concept has no prefLabel"}]}]}`,
+			mockService: &mockService{
+				forceNotify: func(uuids []string, s string) (Report, error) {
+					violations := []Violation{{Rule: "label", Severity: SeverityBlock, Message: "the concept has no prefLabel"}}
+					cause := blockingError(violations)
+					return Report{Concepts: []ConceptOutcome{{UUID: "1", Status: StatusFailed, Error: cause.Error(), Violations: violations}}}, fmt.Errorf("There was an error with 1 concept ingestions: %w", cause)
 				},
 			},
 		},
@@ -139,7 +175,7 @@ func TestHandlers(t *testing.T) {
 			method:     "GET",
 			url:        "/concept/11",
 			resultCode: 404,
-			resultBody: "{\"message\": \"There was an error retrieving the concept\", \"error\": \"concept does not exist\"}",
+			resultBody: "{\"message\": \"There was an error retrieving the concept\", \"error\": \"concept does not exist\", \"code\": \"concept_not_found\"}",
 			mockService: &mockService{
 				getConcept: func(s string) ([]byte, error) {
 					return nil, smartlogic.ErrorConceptDoesNotExist
@@ -151,13 +187,90 @@ func TestHandlers(t *testing.T) {
 			method:     "GET",
 			url:        "/concept/11",
 			resultCode: 500,
-			resultBody: "{\"message\": \"There was an error retrieving the concept\", \"error\": \"failed to get concept\"}",
+			resultBody: "{\"message\": \"There was an error retrieving the concept\", \"error\": \"failed to get concept\", \"code\": \"internal_error\"}",
 			mockService: &mockService{
 				getConcept: func(s string) ([]byte, error) {
 					return nil, errors.New("failed to get concept")
 				},
 			},
 		},
+		{
+			name:       "Get Concept - Circuit open",
+			method:     "GET",
+			url:        "/concept/11",
+			resultCode: 503,
+			resultBody: "{\"message\": \"There was an error retrieving the concept\", \"error\": \"smartlogic is unavailable, the circuit breaker is open\", \"code\": \"circuit_open\"}",
+			mockService: &mockService{
+				getConcept: func(s string) ([]byte, error) {
+					return nil, smartlogic.ErrCircuitOpen
+				},
+			},
+		},
+		{
+			name:       "Get Concept - Timeout",
+			method:     "GET",
+			url:        "/concept/11",
+			resultCode: 504,
+			resultBody: "{\"message\": \"There was an error retrieving the concept\", \"error\": \"context deadline exceeded\", \"code\": \"timeout\"}",
+			mockService: &mockService{
+				getConcept: func(s string) ([]byte, error) {
+					return nil, &smartlogic.Error{Kind: smartlogic.ErrTimeout, Err: context.DeadlineExceeded}
+				},
+			},
+		},
+		{
+			name:       "Get Concept - Rate limited",
+			method:     "GET",
+			url:        "/concept/11",
+			resultCode: 429,
+			resultBody: "{\"message\": \"There was an error retrieving the concept\", \"error\": \"smartlogic returned status 429\", \"code\": \"rate_limited\"}",
+			mockService: &mockService{
+				getConcept: func(s string) ([]byte, error) {
+					return nil, &smartlogic.Error{Kind: smartlogic.ErrRateLimited, StatusCode: 429, Err: errors.New("smartlogic returned status 429")}
+				},
+			},
+		},
+		{
+			name:       "Get Concept - Malformed response",
+			method:     "GET",
+			url:        "/concept/11",
+			resultCode: 502,
+			resultBody: "{\"message\": \"There was an error retrieving the concept\", \"error\": \"invalid Smartlogic response\", \"code\": \"malformed_response\"}",
+			mockService: &mockService{
+				getConcept: func(s string) ([]byte, error) {
+					return nil, &smartlogic.Error{Kind: smartlogic.ErrMalformedResponse}
+				},
+			},
+		},
+		{
+			name:       "Get Projection - Success",
+			method:     "GET",
+			url:        "/concept/1/projection",
+			resultCode: 200,
+			resultBody: `{"uuid":"1","namespace":"http://www.ft.com/thing/","types":["Person"],"properties":["[]","skosxl:hiddenLabel/skosxl:literalForm"]}`,
+			mockService: &mockService{
+				getProjection: func(uuid string) (smartlogic.EffectiveProjection, error) {
+					return smartlogic.EffectiveProjection{
+						UUID:       uuid,
+						Namespace:  "http://www.ft.com/thing/",
+						Types:      []string{"Person"},
+						Properties: []string{"[]", "skosxl:hiddenLabel/skosxl:literalForm"},
+					}, nil
+				},
+			},
+		},
+		{
+			name:       "Get Projection - Error",
+			method:     "GET",
+			url:        "/concept/11/projection",
+			resultCode: 404,
+			resultBody: "{\"message\": \"There was an error retrieving the concept projection\", \"error\": \"concept does not exist\", \"code\": \"concept_not_found\"}",
+			mockService: &mockService{
+				getProjection: func(uuid string) (smartlogic.EffectiveProjection, error) {
+					return smartlogic.EffectiveProjection{}, smartlogic.ErrorConceptDoesNotExist
+				},
+			},
+		},
 		{
 			name:       "Get Concepts - Success",
 			method:     "GET",
@@ -170,6 +283,25 @@ func TestHandlers(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:       "Get Concepts - Details",
+			method:     "GET",
+			url:        fmt.Sprintf("/concepts?lastChangeDate=%s&details=true", today),
+			resultCode: 200,
+			resultBody: `[{"uri":"http://www.ft.com/thing/1","uuid":"1","changeType":"created","committer":"jane.doe@ft.com","committed":"2020-04-27T10:00:00Z","changeId":"urn:x-change:1"}]`,
+			mockService: &mockService{
+				getChangedConcepts: func(t time.Time) ([]smartlogic.ChangedConcept, error) {
+					return []smartlogic.ChangedConcept{{
+						URI:        "http://www.ft.com/thing/1",
+						UUID:       "1",
+						ChangeType: smartlogic.ChangeTypeCreated,
+						Committer:  "jane.doe@ft.com",
+						Committed:  time.Date(2020, 4, 27, 10, 0, 0, 0, time.UTC),
+						ChangeID:   "urn:x-change:1",
+					}}, nil
+				},
+			},
+		},
 		{
 			name:        "Get Concepts - Invalid Time",
 			method:      "GET",
@@ -199,13 +331,25 @@ func TestHandlers(t *testing.T) {
 			method:     "GET",
 			url:        fmt.Sprintf("/concepts?lastChangeDate=%s", today),
 			resultCode: 500,
-			resultBody: "{\"message\": \"There was an error getting the changes\", \"error\": \"smartlogic error\"}",
+			resultBody: "{\"message\": \"There was an error getting the changes\", \"error\": \"smartlogic error\", \"code\": \"internal_error\"}",
 			mockService: &mockService{
 				getChangedConceptList: func(t time.Time) ([]string, error) {
 					return nil, errors.New("smartlogic error")
 				},
 			},
 		},
+		{
+			name:       "Get Concepts - Smartlogic unavailable",
+			method:     "GET",
+			url:        fmt.Sprintf("/concepts?lastChangeDate=%s", today),
+			resultCode: 502,
+			resultBody: "{\"message\": \"There was an error getting the changes\", \"error\": \"smartlogic returned status 500\", \"code\": \"upstream_error\"}",
+			mockService: &mockService{
+				getChangedConceptList: func(t time.Time) ([]string, error) {
+					return nil, &smartlogic.Error{Kind: smartlogic.ErrUpstream, StatusCode: 500, Err: errors.New("smartlogic returned status 500")}
+				},
+			},
+		},
 		{
 			name:        "__health",
 			method:      "GET",
@@ -262,7 +406,7 @@ func TestHandlers(t *testing.T) {
 			body := string(b)
 			assert.Equal(t, d.resultCode, rr.Code, d.name)
 			if d.resultBody != "IGNORE" {
-				assert.Equal(t, d.resultBody, body, d.name)
+				assertBody(t, d.resultBody, body, d.name)
 			}
 
 		})
@@ -324,7 +468,7 @@ func TestConcurrentNotify(t *testing.T) {
 				},
 			}
 
-			service := NewNotifierService(kc, sl)
+			service := NewNotifierService(NewKafkaSink(kc), sl)
 
 			// making sure the ticker will fire at least once during the test execution
 			tickerInterval := test.duration / 2
@@ -452,7 +596,7 @@ func TestProcessingNotifyRequestsDoesNotBlock(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			t.Parallel()
 			kc := &mockKafkaClient{}
-			service := NewNotifierService(kc, test.slClient)
+			service := NewNotifierService(NewKafkaSink(kc), test.slClient)
 
 			tickerInterval := test.duration / 10
 			tk := &mockTicker{ticker: time.NewTicker(tickerInterval)}
@@ -517,7 +661,7 @@ func TestGettingSmartlogicChangesOneRequestAtATime(t *testing.T) {
 				},
 			}
 
-			service := NewNotifierService(kc, sl)
+			service := NewNotifierService(NewKafkaSink(kc), sl)
 
 			tickerInterval := test.duration / 5
 			tk := &ticker{ticker: time.NewTicker(tickerInterval)}
@@ -545,3 +689,651 @@ func TestGettingSmartlogicChangesOneRequestAtATime(t *testing.T) {
 		})
 	}
 }
+
+func TestMultiModelHandlers(t *testing.T) {
+	t.Parallel()
+	log.SetOutput(ioutil.Discard)
+
+	today := time.Now().Format(TimeFormat)
+	newService := func(name string) *mockService {
+		return &mockService{
+			getConcept: func(uuid string) ([]byte, error) {
+				return []byte(name + ":" + uuid), nil
+			},
+			getChangedConceptList: func(t time.Time) ([]string, error) {
+				return []string{name}, nil
+			},
+			forceNotify: func(uuids []string, s string) (Report, error) {
+				return Report{Concepts: []ConceptOutcome{{UUID: uuids[0], Status: StatusPublished, Namespace: name}}}, nil
+			},
+		}
+	}
+	models := NewModelRegistry()
+	assert.NoError(t, models.Register("FTModel", newService("FTModel")))
+	assert.NoError(t, models.Register("Locations", newService("Locations")))
+
+	testCases := []struct {
+		name        string
+		method      string
+		url         string
+		requestBody string
+		resultCode  int
+		resultBody  string
+	}{
+		{
+			name:       "Get Concept - Default model",
+			method:     "GET",
+			url:        "/concept/1",
+			resultCode: 200,
+			resultBody: "FTModel:1",
+		},
+		{
+			name:       "Get Concept - Model in path",
+			method:     "GET",
+			url:        "/models/Locations/concept/1",
+			resultCode: 200,
+			resultBody: "Locations:1",
+		},
+		{
+			name:       "Get Concept - Unknown model",
+			method:     "GET",
+			url:        "/models/Unknown/concept/1",
+			resultCode: 404,
+			resultBody: "{\"message\": \"Unknown model Unknown\"}",
+		},
+		{
+			name:       "Get Concepts - Model in path",
+			method:     "GET",
+			url:        fmt.Sprintf("/models/Locations/concepts?lastChangeDate=%s", today),
+			resultCode: 200,
+			resultBody: `["Locations"]`,
+		},
+		{
+			name:        "Force Notify - Model in path",
+			method:      "POST",
+			url:         "/models/Locations/force-notify",
+			requestBody: `{"uuids": ["1"]}`,
+			resultCode:  200,
+			resultBody:  `{"message":"Concept notification completed","concepts":[{"uuid":"1","status":"published","namespace":"Locations"}]}`,
+		},
+		{
+			name:       "Notify - Unknown model",
+			method:     "GET",
+			url:        fmt.Sprintf("/notify?affectedGraphId=Unknown&modifiedGraphId=Unknown&lastChangeDate=%s", today),
+			resultCode: 400,
+			resultBody: "{\"message\": \"Unknown model Unknown\"}",
+		},
+	}
+
+	handler := NewMultiModelHandler(models)
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	for _, d := range testCases {
+		t.Run(d.name, func(t *testing.T) {
+			req, _ := http.NewRequest(d.method, d.url, bytes.NewBufferString(d.requestBody))
+			rr := httptest.NewRecorder()
+			m.ServeHTTP(rr, req)
+
+			assert.Equal(t, d.resultCode, rr.Code, d.name)
+			assertBody(t, d.resultBody, rr.Body.String(), d.name)
+		})
+	}
+}
+
+func TestMultiModelNotifyRouting(t *testing.T) {
+	t.Parallel()
+	log.SetOutput(ioutil.Discard)
+
+	notified := make(chan string, 2)
+	newService := func(name string) *mockService {
+		return &mockService{
+			notify: func(i time.Time, s string) error {
+				notified <- name
+				return nil
+			},
+		}
+	}
+	models := NewModelRegistry()
+	assert.NoError(t, models.Register("FTModel", newService("FTModel")))
+	assert.NoError(t, models.Register("Locations", newService("Locations")))
+
+	tk := &ticker{ticker: time.NewTicker(10 * time.Millisecond)}
+	handler := NewMultiModelHandler(models, WithTicker(tk))
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	url := fmt.Sprintf("/notify?affectedGraphId=Locations&modifiedGraphId=urn:x-evn-master:Locations&lastChangeDate=%s", time.Now().Format(TimeFormat))
+	req, _ := http.NewRequest("GET", url, nil)
+	rr := httptest.NewRecorder()
+	m.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	select {
+	case model := <-notified:
+		assert.Equal(t, "Locations", model)
+	case <-time.After(time.Second):
+		t.Fatal("the model was not notified")
+	}
+}
+
+func TestHandler_StopsNotifyingWhenContextIsDone(t *testing.T) {
+	t.Parallel()
+	log.SetOutput(ioutil.Discard)
+
+	notified := make(chan struct{}, 1)
+	service := &mockService{
+		notify: func(i time.Time, s string) error {
+			notified <- struct{}{}
+			return nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tk := &ticker{ticker: time.NewTicker(10 * time.Millisecond)}
+	handler := NewNotifierHandler(service, WithTicker(tk), WithContext(ctx))
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	url := fmt.Sprintf("/notify?affectedGraphId=1&modifiedGraphId=2&lastChangeDate=%s", time.Now().Format(TimeFormat))
+	req, _ := http.NewRequest("GET", url, nil)
+	rr := httptest.NewRecorder()
+	m.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	select {
+	case <-notified:
+		t.Fatal("no notification should be processed once the context is done")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestHandleForceNotify_Force(t *testing.T) {
+	t.Parallel()
+	log.SetOutput(ioutil.Discard)
+
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{concepts: map[string]string{"1": `{"label": "one"}`}}
+	handler := NewNotifierHandler(NewNotifierService(NewKafkaSink(kc), sl, WithHashStore(NewMemoryHashStore())))
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	for _, test := range []struct {
+		body       string
+		resultBody string
+	}{
+		{body: `{"uuids": ["1"]}`, resultBody: `{"message":"Concept notification completed","concepts":[{"uuid":"1","status":"published"}]}`},
+		{body: `{"uuids": ["1"]}`, resultBody: `{"message":"Concept notification completed","concepts":[{"uuid":"1","status":"unchanged"}]}`},
+		{body: `{"uuids": ["1"], "force": true}`, resultBody: `{"message":"Concept notification completed","concepts":[{"uuid":"1","status":"published"}]}`},
+	} {
+		req, _ := http.NewRequest("POST", "/force-notify", bytes.NewBufferString(test.body))
+		rr := httptest.NewRecorder()
+		m.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, test.resultBody, rr.Body.String())
+	}
+	assert.Equal(t, 2, kc.sentCount)
+}
+
+func TestHandleForceNotify_BypassesCache(t *testing.T) {
+	t.Parallel()
+	log.SetOutput(ioutil.Discard)
+
+	kc := &mockKafkaClient{}
+	sl := newCachedSmartlogic(newVersionedSmartlogic())
+	_, err := sl.GetConcept(context.Background(), "1")
+	assert.NoError(t, err)
+	handler := NewNotifierHandler(NewNotifierService(NewKafkaSink(kc), sl))
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	req, _ := http.NewRequest("POST", "/force-notify", bytes.NewBufferString(`{"uuids": ["1"]}`))
+	rr := httptest.NewRecorder()
+	m.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	messages := kc.getSentMessages()
+	assert.Len(t, messages, 1)
+	assert.Equal(t, `{"version": 2}`, messages[0].Body, "the latest payload should be published rather than the cached one")
+}
+
+func TestHandler_Outbox(t *testing.T) {
+	t.Parallel()
+	log.SetOutput(ioutil.Discard)
+
+	var mu sync.Mutex
+	failing := true
+	var notified []string
+	service := &mockService{
+		notify: func(since time.Time, transactionID string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			notified = append(notified, transactionID)
+			if failing {
+				return errors.New("kafka is down")
+			}
+			return nil
+		},
+		forceNotify: func(uuids []string, transactionID string) (Report, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			notified = append(notified, transactionID)
+			if failing {
+				return Report{}, errors.New("kafka is down")
+			}
+			return Report{}, nil
+		},
+	}
+	outbox := &mockOutbox{}
+	tk := &mockTicker{ticker: time.NewTicker(10 * time.Millisecond)}
+	handler := NewNotifierHandler(service, WithTicker(tk), WithOutbox(outbox))
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	url := fmt.Sprintf("/notify?affectedGraphId=1&modifiedGraphId=2&lastChangeDate=%s", time.Now().Format(TimeFormat))
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("X-Request-Id", "tid_notify")
+	rr := httptest.NewRecorder()
+	m.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req, _ = http.NewRequest("POST", "/force-notify", bytes.NewBufferString(`{"uuids": ["1"], "force": true}`))
+	req.Header.Set("X-Request-Id", "tid_force")
+	rr = httptest.NewRecorder()
+	m.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+
+	waitUntil(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(notified) == 2
+	})
+	pending, _ := outbox.Pending()
+	if assert.Len(t, pending, 2, "the failed notifications should be kept in the outbox") {
+		assert.Equal(t, OutboxItem{ID: "1", Kind: OutboxNotify, Model: "", NotifySince: pending[0].NotifySince, TransactionID: "tid_notify", Accepted: pending[0].Accepted}, pending[0])
+		assert.Equal(t, OutboxItem{ID: "2", Kind: OutboxForceNotify, Model: "", UUIDs: []string{"1"}, Force: true, TransactionID: "tid_force", Accepted: pending[1].Accepted}, pending[1])
+	}
+
+	// a restart replays the pending notifications and removes them once they are published
+	mu.Lock()
+	failing = false
+	notified = nil
+	mu.Unlock()
+	NewNotifierHandler(service, WithTicker(&mockTicker{ticker: time.NewTicker(10 * time.Millisecond)}), WithOutbox(outbox))
+	waitUntil(t, func() bool {
+		pending, _ := outbox.Pending()
+		return len(pending) == 0
+	})
+	mu.Lock()
+	assert.ElementsMatch(t, []string{"tid_notify", "tid_force"}, notified)
+	mu.Unlock()
+}
+
+func TestHandler_OutboxRedrive(t *testing.T) {
+	t.Parallel()
+	log.SetOutput(ioutil.Discard)
+
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	// every notification fails the first time it is notified
+	notify := func(transactionID string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[transactionID]++
+		if attempts[transactionID] == 1 {
+			return errors.New("kafka is down")
+		}
+		return nil
+	}
+	service := &mockService{
+		notify: func(since time.Time, transactionID string) error {
+			return notify(transactionID)
+		},
+		forceNotify: func(uuids []string, transactionID string) (Report, error) {
+			return Report{}, notify(transactionID)
+		},
+	}
+	outbox := &mockOutbox{}
+	tk := &mockTicker{ticker: time.NewTicker(10 * time.Millisecond)}
+	handler := NewNotifierHandler(service, WithTicker(tk), WithOutbox(outbox), WithOutboxRedriveInterval(50*time.Millisecond))
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	url := fmt.Sprintf("/notify?affectedGraphId=1&modifiedGraphId=2&lastChangeDate=%s", time.Now().Format(TimeFormat))
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("X-Request-Id", "tid_notify")
+	rr := httptest.NewRecorder()
+	m.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req, _ = http.NewRequest("POST", "/force-notify", bytes.NewBufferString(`{"uuids": ["1"]}`))
+	req.Header.Set("X-Request-Id", "tid_force")
+	rr = httptest.NewRecorder()
+	m.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+
+	// the failed notifications are notified again without a restart, and removed once they are published
+	waitUntil(t, func() bool {
+		pending, _ := outbox.Pending()
+		return len(pending) == 0
+	})
+	mu.Lock()
+	assert.Equal(t, map[string]int{"tid_notify": 2, "tid_force": 2}, attempts)
+	mu.Unlock()
+}
+
+func TestHandler_OutboxDropsPermanentFailures(t *testing.T) {
+	t.Parallel()
+	log.SetOutput(ioutil.Discard)
+
+	for _, test := range []struct {
+		name    string
+		service func(sink *mockSink) Servicer
+		kept    bool
+	}{
+		{
+			name: "missing concept",
+			service: func(sink *mockSink) Servicer {
+				return NewNotifierService(sink, &mockSmartlogicClient{
+					resolveConceptFunc: func(uuid string) (*smartlogic.Concept, smartlogic.Namespace, error) {
+						return nil, smartlogic.Namespace{}, smartlogic.ErrorConceptDoesNotExist
+					},
+				})
+			},
+		},
+		{
+			name: "dead-lettered concept",
+			service: func(sink *mockSink) Servicer {
+				sink.err = errors.New("kafka is down")
+				queue := NewDeadLetterQueue(NewMemoryDeadLetterStore(), DefaultRetryPolicy)
+				return NewNotifierService(sink, &mockSmartlogicClient{concepts: map[string]string{"1": "concept1"}}, WithDeadLetterQueue(queue))
+			},
+		},
+		{
+			name: "failed concept without dead letters",
+			service: func(sink *mockSink) Servicer {
+				sink.err = errors.New("kafka is down")
+				return NewNotifierService(sink, &mockSmartlogicClient{concepts: map[string]string{"1": "concept1"}})
+			},
+			kept: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			outbox := &mockOutbox{}
+			handler := NewNotifierHandler(test.service(&mockSink{name: "Kafka"}), WithOutbox(outbox))
+			m := mux.NewRouter()
+			handler.RegisterEndpoints(m)
+
+			req, _ := http.NewRequest("POST", "/force-notify", bytes.NewBufferString(`{"uuids": ["1"]}`))
+			rr := httptest.NewRecorder()
+			m.ServeHTTP(rr, req)
+			assert.NotEqual(t, http.StatusOK, rr.Code)
+			pending, _ := outbox.Pending()
+			if test.kept {
+				assert.Len(t, pending, 1, "the notifications which may succeed when notified again should be kept")
+			} else {
+				assert.Empty(t, pending, "the notifications which can't succeed by being notified again shouldn't be kept")
+			}
+		})
+	}
+}
+
+func TestHandler_OutboxDropsOldForceNotify(t *testing.T) {
+	t.Parallel()
+	log.SetOutput(ioutil.Discard)
+
+	notified := make(chan struct{}, 1)
+	service := &mockService{
+		forceNotify: func(uuids []string, transactionID string) (Report, error) {
+			notified <- struct{}{}
+			return Report{}, nil
+		},
+	}
+	outbox := &mockOutbox{}
+	_, _ = outbox.Add(OutboxItem{Kind: OutboxForceNotify, UUIDs: []string{"1"}, Accepted: time.Now().Add(-LastChangeLimit - time.Hour)})
+	NewNotifierHandler(service, WithOutbox(outbox))
+
+	waitUntil(t, func() bool {
+		pending, _ := outbox.Pending()
+		return len(pending) == 0
+	})
+	assert.Empty(t, notified, "a force notify older than the limit should be dropped rather than notified")
+}
+
+func TestHandleForceNotify_ClientDisconnectsWithoutOutbox(t *testing.T) {
+	t.Parallel()
+	log.SetOutput(ioutil.Discard)
+
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{concepts: map[string]string{"1": "concept1"}}
+	handler := NewNotifierHandler(NewNotifierService(NewKafkaSink(kc), sl))
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequest("POST", "/force-notify", bytes.NewBufferString(`{"uuids": ["1"]}`))
+	m.ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx))
+	assert.Equal(t, 0, kc.getSentCount(), "without an outbox, the force notify should be abandoned when the client disconnects")
+}
+
+func TestHandleForceNotify_ClientDisconnects(t *testing.T) {
+	t.Parallel()
+	log.SetOutput(ioutil.Discard)
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	service := &mockService{
+		forceNotify: func(uuids []string, transactionID string) (Report, error) {
+			close(started)
+			<-unblock
+			return Report{}, nil
+		},
+	}
+	outbox := &mockOutbox{}
+	handler := NewNotifierHandler(service, WithOutbox(outbox))
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequest("POST", "/force-notify", bytes.NewBufferString(`{"uuids": ["1"]}`))
+	served := make(chan struct{})
+	go func() {
+		m.ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx))
+		close(served)
+	}()
+	<-started
+	cancel()
+	select {
+	case <-served:
+	case <-time.After(time.Second):
+		t.Fatal("the handler should return once the client disconnects")
+	}
+	pending, _ := outbox.Pending()
+	assert.Len(t, pending, 1, "the force notify should be kept in the outbox until it is completed")
+
+	close(unblock)
+	waitUntil(t, func() bool {
+		pending, _ := outbox.Pending()
+		return len(pending) == 0
+	})
+}
+
+// waitUntil waits for the condition to hold, failing the test if it doesn't within a second.
+func waitUntil(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("the condition wasn't met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// assertBody compares the JSON bodies whatever their formatting, and the other bodies as they are.
+func assertBody(t *testing.T, expected string, actual string, msgAndArgs ...interface{}) {
+	t.Helper()
+	if json.Valid([]byte(expected)) {
+		assert.JSONEq(t, expected, actual, msgAndArgs...)
+		return
+	}
+	assert.Equal(t, expected, actual, msgAndArgs...)
+}
+
+func TestWriteJSONResponseMessage(t *testing.T) {
+	rr := httptest.NewRecorder()
+	writeJSONResponseMessage(rr, http.StatusBadGateway, responseData{
+		Msg:  "There was an error retrieving the concept",
+		Err:  errors.New("smartlogic returned \"Internal error\"\nat line 1"),
+		Code: "upstream_error",
+	})
+
+	assert.Equal(t, http.StatusBadGateway, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	var body map[string]string
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body), "the response should be valid JSON")
+	assert.Equal(t, map[string]string{
+		"message": "There was an error retrieving the concept",
+		"error":   "smartlogic returned \"Internal error\"\nat line 1",
+		"code":    "upstream_error",
+	}, body)
+}
+
+func TestHandler_OutboxFailure(t *testing.T) {
+	t.Parallel()
+	log.SetOutput(ioutil.Discard)
+
+	handler := NewNotifierHandler(&mockService{}, WithOutbox(&mockOutbox{err: errors.New("disk full")}))
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	url := fmt.Sprintf("/notify?affectedGraphId=1&modifiedGraphId=2&lastChangeDate=%s", time.Now().Format(TimeFormat))
+	req, _ := http.NewRequest("GET", url, nil)
+	rr := httptest.NewRecorder()
+	m.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.JSONEq(t, `{"message": "Failed to accept the notification", "error": "disk full", "code": "internal_error"}`, rr.Body.String())
+
+	req, _ = http.NewRequest("POST", "/force-notify", bytes.NewBufferString(`{"uuids": ["1"]}`))
+	rr = httptest.NewRecorder()
+	m.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+}
+
+func TestRepublishEndpoints(t *testing.T) {
+	t.Parallel()
+	log.SetOutput(ioutil.Discard)
+
+	release := make(chan struct{})
+	service := &mockService{
+		listConcepts: func(visit func([]string) error) error {
+			<-release
+			return visit([]string{"1", "2"})
+		},
+		forceNotify: func(uuids []string, s string) (Report, error) {
+			return Report{Concepts: []ConceptOutcome{{UUID: "1", Status: StatusPublished}, {UUID: "2", Status: StatusPublished}}}, nil
+		},
+	}
+	handler := NewNotifierHandler(service)
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	call := func(method, url string) (int, RepublishStatus) {
+		req, _ := http.NewRequest(method, url, nil)
+		rr := httptest.NewRecorder()
+		m.ServeHTTP(rr, req)
+		var status RepublishStatus
+		_ = json.Unmarshal(rr.Body.Bytes(), &status)
+		return rr.Code, status
+	}
+
+	code, _ := call("GET", "/republish")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, status := call("POST", "/republish")
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.Equal(t, JobRunning, status.State)
+
+	code, _ = call("POST", "/republish")
+	assert.Equal(t, http.StatusConflict, code)
+
+	close(release)
+	job, err := handler.republisher.Job("")
+	assert.NoError(t, err)
+	job.Wait()
+
+	code, status = call("GET", "/republish")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, JobCompleted, status.State)
+	assert.Equal(t, 2, status.Listed)
+	assert.Equal(t, 2, status.Published)
+
+	code, status = call("DELETE", "/republish")
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.Equal(t, JobCompleted, status.State, "finished jobs can't be cancelled")
+
+	code, _ = call("GET", "/models/Unknown/republish")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestDeadLetterEndpoints(t *testing.T) {
+	t.Parallel()
+	log.SetOutput(ioutil.Discard)
+
+	sl := &mockSmartlogicClient{concepts: map[string]string{"1": "concept1"}}
+	queue := NewDeadLetterQueue(NewMemoryDeadLetterStore(), DefaultRetryPolicy)
+	handler := NewNotifierHandler(NewNotifierService(NewKafkaSink(&mockKafkaClient{}), sl, WithDeadLetterQueue(queue)))
+	m := mux.NewRouter()
+	handler.RegisterEndpoints(m)
+
+	call := func(method, url, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		m.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := call("POST", "/force-notify", `{"uuids": ["1", "2"]}`)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+
+	rr = call("GET", "/dead-letters", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var list struct {
+		DeadLetters []DeadLetter `json:"deadLetters"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+	assert.Len(t, list.DeadLetters, 1)
+	assert.Equal(t, "2", list.DeadLetters[0].UUID)
+	assert.Equal(t, "can't find concept", list.DeadLetters[0].Error)
+
+	assert.Equal(t, http.StatusOK, call("GET", "/dead-letters/2", "").Code)
+	assert.Equal(t, http.StatusNotFound, call("GET", "/dead-letters/3", "").Code)
+	assert.Equal(t, http.StatusNotFound, call("POST", "/dead-letters/retry", `{"uuids": ["3"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, call("POST", "/dead-letters/retry", `{"uuids": `).Code)
+
+	rr = call("POST", "/dead-letters/retry", `{"uuids": ["2"]}`)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	letter, err := queue.Get("2")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, letter.Attempts)
+
+	sl.concepts["2"] = "concept2"
+	rr = call("POST", "/dead-letters/retry", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"message":"Dead letters retried","concepts":[{"uuid":"2","status":"published"}]}`, rr.Body.String())
+	rr = call("GET", "/dead-letters", "")
+	assert.JSONEq(t, `{"deadLetters":[]}`, rr.Body.String())
+
+	delete(sl.concepts, "2")
+	call("POST", "/force-notify", `{"uuids": ["2"]}`)
+	assert.Equal(t, http.StatusOK, call("DELETE", "/dead-letters/2", "").Code)
+	assert.Equal(t, http.StatusNotFound, call("DELETE", "/dead-letters/2", "").Code)
+
+	withoutDeadLetters := NewNotifierHandler(&mockService{})
+	m = mux.NewRouter()
+	withoutDeadLetters.RegisterEndpoints(m)
+	rr = call("GET", "/dead-letters", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.JSONEq(t, `{"message":"Dead letters are not recorded"}`, rr.Body.String())
+}
@@ -1,6 +1,7 @@
 package notifier
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 	"github.com/Financial-Times/http-handlers-go/httphandlers"
 	"github.com/Financial-Times/service-status-go/gtg"
 	status "github.com/Financial-Times/service-status-go/httphandlers"
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
 	"github.com/gorilla/mux"
 	metrics "github.com/rcrowley/go-metrics"
 	log "github.com/sirupsen/logrus"
@@ -19,6 +21,8 @@ import (
 const (
 	businessImpact = "Editorial updates of concepts in Smartlogic will not be ingested into UPP"
 	panicGuideURL  = "https://runbooks.in.ft.com/smartlogic-notifier"
+	// conceptCheckTimeout bounds how long fetching the health check concept of a model may take.
+	conceptCheckTimeout = 10 * time.Second
 )
 
 // HealthService is responsible for gtg and health checks.
@@ -27,7 +31,16 @@ type HealthService struct {
 	config            *HealthServiceConfig
 	notifier          Servicer
 	Checks            []fthealth.Check
-	checkSuccessCache bool
+	models            []modelHealthCheck
+	checkSuccessCache map[string]bool
+	breaker           *smartlogic.CircuitBreaker
+}
+
+// modelHealthCheck describes how the connectivity to a Smartlogic model is checked.
+type modelHealthCheck struct {
+	model    string
+	concept  string
+	notifier Servicer
 }
 
 type HealthServiceConfig struct {
@@ -61,8 +74,22 @@ func (c *HealthServiceConfig) Validate() error {
 	return nil
 }
 
+// WithModelHealthCheck adds a connectivity check for an additional Smartlogic model, next to the one in the config.
+func WithModelHealthCheck(model string, concept string, notifier Servicer) func(*HealthService) {
+	return func(hs *HealthService) {
+		hs.models = append(hs.models, modelHealthCheck{model: model, concept: concept, notifier: notifier})
+	}
+}
+
+// WithCircuitBreaker adds a check failing while the circuit breaker in front of Smartlogic is not closed.
+func WithCircuitBreaker(breaker *smartlogic.CircuitBreaker) func(*HealthService) {
+	return func(hs *HealthService) {
+		hs.breaker = breaker
+	}
+}
+
 // NewHealthService initialises the HealthCheck service but doesn't start the updating of the health check result.
-func NewHealthService(notifier Servicer, config *HealthServiceConfig) (*HealthService, error) {
+func NewHealthService(notifier Servicer, config *HealthServiceConfig, opts ...func(*HealthService)) (*HealthService, error) {
 	err := config.Validate()
 	if err != nil {
 		return nil, fmt.Errorf("invalid config: %w", err)
@@ -71,10 +98,23 @@ func NewHealthService(notifier Servicer, config *HealthServiceConfig) (*HealthSe
 	service := &HealthService{
 		config:   config,
 		notifier: notifier,
+		models: []modelHealthCheck{
+			{model: config.SmartlogicModel, concept: config.SmartlogicModelConcept, notifier: notifier},
+		},
+		checkSuccessCache: map[string]bool{},
+	}
+	for _, opt := range opts {
+		opt(service)
+	}
+
+	for _, sink := range notifier.Sinks() {
+		service.Checks = append(service.Checks, service.sinkHealthCheck(sink))
 	}
-	service.Checks = []fthealth.Check{
-		service.kafkaHealthCheck(),
-		service.smartlogicHealthCheck(),
+	for _, m := range service.models {
+		service.Checks = append(service.Checks, service.smartlogicHealthCheck(m.model))
+	}
+	if service.breaker != nil {
+		service.Checks = append(service.Checks, service.circuitBreakerHealthCheck())
 	}
 	return service, nil
 }
@@ -98,17 +138,25 @@ func (hs *HealthService) Start() {
 	}()
 }
 
-// updateSmartlogicSuccessCache tries to get concept from the Smartlogic model, which uuid is given in the config
-// of the health check service, and based on the success of the check updates the HealthService cache.
+// updateSmartlogicSuccessCache tries to get the health check concept from each of the Smartlogic models
+// and based on the success of the checks updates the HealthService cache. The concept is got from Smartlogic
+// rather than from the concept cache, which would hide Smartlogic being down.
 func (hs *HealthService) updateSmartlogicSuccessCache() error {
-	_, err := hs.notifier.GetConcept(hs.config.SmartlogicModelConcept)
-	if err != nil {
-		log.WithError(err).Errorf("health check concept %s couldn't be retrieved", hs.config.SmartlogicModelConcept)
-		hs.setCheckSuccessCache(false)
-		return err
+	var checkErr error
+	for _, m := range hs.models {
+		ctx := smartlogic.WithoutCache(smartlogic.WithBudget(context.Background(), smartlogic.BudgetHealth))
+		ctx, cancel := context.WithTimeout(ctx, conceptCheckTimeout)
+		_, err := m.notifier.GetConcept(ctx, m.concept)
+		cancel()
+		if err != nil {
+			log.WithError(err).WithField("model", m.model).Errorf("health check concept %s couldn't be retrieved", m.concept)
+			hs.setCheckSuccessCache(m.model, false)
+			checkErr = err
+			continue
+		}
+		hs.setCheckSuccessCache(m.model, true)
 	}
-	hs.setCheckSuccessCache(true)
-	return nil
+	return checkErr
 }
 
 // RegisterAdminEndpoints adds the admin endpoints to the given router
@@ -137,47 +185,71 @@ func (hs *HealthService) HealthcheckHandler() fthealth.TimedHealthCheck {
 	}
 }
 
-func (hs *HealthService) smartlogicHealthCheck() fthealth.Check {
+func (hs *HealthService) smartlogicHealthCheck(model string) fthealth.Check {
 	return fthealth.Check{
 		BusinessImpact:   businessImpact,
-		Name:             fmt.Sprintf("Check connectivity to Smartlogic model %s", hs.config.SmartlogicModel),
+		Name:             fmt.Sprintf("Check connectivity to Smartlogic model %s", model),
 		PanicGuide:       panicGuideURL,
 		Severity:         3,
 		TechnicalSummary: `Check that Smartlogic is healthy and the API is accessible.  If it is, restart this service.`,
-		Checker:          hs.smartlogicConnectivityCheck,
+		Checker: func() (string, error) {
+			return hs.smartlogicConnectivityCheck(model)
+		},
+	}
+}
+
+func (hs *HealthService) circuitBreakerHealthCheck() fthealth.Check {
+	return fthealth.Check{
+		BusinessImpact:   businessImpact,
+		Name:             "Check the Smartlogic circuit breaker",
+		PanicGuide:       panicGuideURL,
+		Severity:         3,
+		TechnicalSummary: `Requests to Smartlogic kept failing, so they are failed fast without calling Smartlogic. Check that Smartlogic is healthy and the API is accessible.`,
+		Checker:          hs.checkCircuitBreaker,
 	}
 }
 
-func (hs *HealthService) kafkaHealthCheck() fthealth.Check {
+func (hs *HealthService) checkCircuitBreaker() (string, error) {
+	status := hs.breaker.Status()
+	if status.State == smartlogic.CircuitClosed {
+		return "Smartlogic circuit breaker is closed", nil
+	}
+	msg := fmt.Sprintf("Smartlogic circuit breaker is %s since %s after %d consecutive failures",
+		status.State, status.OpenedAt.Format(time.RFC3339), status.ConsecutiveFailures)
+	return msg, errors.New(msg)
+}
+
+func (hs *HealthService) sinkHealthCheck(sink Sink) fthealth.Check {
 	return fthealth.Check{
 		BusinessImpact:   businessImpact,
-		Name:             "Check connectivity to Kafka",
+		Name:             fmt.Sprintf("Check connectivity to %s", sink.Name()),
 		PanicGuide:       panicGuideURL,
 		Severity:         3,
-		TechnicalSummary: `Cannot connect to Kafka. Verify that Kafka is healthy in this cluster.`,
-		Checker:          hs.checkKafkaConnectivity,
+		TechnicalSummary: fmt.Sprintf(`Cannot publish to %s. Verify that it is healthy and reachable from this cluster.`, sink.Name()),
+		Checker: func() (string, error) {
+			return checkSinkConnectivity(sink)
+		},
 	}
 }
 
-// smartlogicConnectivityCheck always returns the cached result for the Smartlogic connectivity check.
-func (hs *HealthService) smartlogicConnectivityCheck() (string, error) {
-	if !hs.getCheckSuccessCache() {
-		msg := "latest Smartlogic connectivity check is unsuccessful"
+// smartlogicConnectivityCheck always returns the cached result for the Smartlogic connectivity check of the model.
+func (hs *HealthService) smartlogicConnectivityCheck(model string) (string, error) {
+	if !hs.getCheckSuccessCache(model) {
+		msg := fmt.Sprintf("latest Smartlogic connectivity check is unsuccessful for model %s", model)
 		log.Error(msg)
 		return msg, errors.New(msg)
 	}
 	return "", nil
 }
 
-func (hs *HealthService) checkKafkaConnectivity() (string, error) {
-	err := hs.notifier.CheckKafkaConnectivity()
+func checkSinkConnectivity(sink Sink) (string, error) {
+	err := sink.Check()
 	if err != nil {
-		clientError := fmt.Sprint("Error verifying open connection to Kafka")
+		clientError := fmt.Sprintf("Error verifying open connection to %s", sink.Name())
 		log.WithError(err).Error(clientError)
-		return "Error connecting with Kafka", errors.New(clientError)
-	} else {
-		return "Successfully connected to Kafka", nil
+		return fmt.Sprintf("Error connecting with %s", sink.Name()), errors.New(clientError)
 	}
+	return fmt.Sprintf("Successfully connected to %s", sink.Name()), nil
 }
 
 // GtgCheck is responsible for __gtg endpoint.
@@ -190,16 +262,16 @@ func (hs *HealthService) GtgCheck() gtg.StatusChecker {
 	return gtg.FailFastParallelCheck(sc)
 }
 
-func (hs *HealthService) getCheckSuccessCache() bool {
+func (hs *HealthService) getCheckSuccessCache(model string) bool {
 	hs.RLock()
 	defer hs.RUnlock()
-	return hs.checkSuccessCache
+	return hs.checkSuccessCache[model]
 }
 
-func (hs *HealthService) setCheckSuccessCache(val bool) {
+func (hs *HealthService) setCheckSuccessCache(model string, val bool) {
 	hs.Lock()
 	defer hs.Unlock()
-	hs.checkSuccessCache = val
+	hs.checkSuccessCache[model] = val
 }
 
 func gtgCheck(handler func() (string, error)) gtg.StatusChecker {
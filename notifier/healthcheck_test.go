@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -137,7 +138,7 @@ func TestHealthServiceChecks(t *testing.T) {
 				getConcept: func(s string) ([]byte, error) {
 					return []byte(""), nil
 				},
-				checkKafkaConnectivity: func() error {
+				checkSink: func() error {
 					return nil
 				},
 			},
@@ -151,7 +152,7 @@ func TestHealthServiceChecks(t *testing.T) {
 				getConcept: func(s string) ([]byte, error) {
 					return []byte(""), nil
 				},
-				checkKafkaConnectivity: func() error {
+				checkSink: func() error {
 					return nil
 				},
 			},
@@ -165,7 +166,7 @@ func TestHealthServiceChecks(t *testing.T) {
 				getConcept: func(s string) ([]byte, error) {
 					return nil, errors.New("couldn't retrieve FT organisation from Smartlogic")
 				},
-				checkKafkaConnectivity: func() error {
+				checkSink: func() error {
 					return nil
 				},
 			},
@@ -187,7 +188,7 @@ func TestHealthServiceChecks(t *testing.T) {
 			name: "health endpoint Smartlogic failure",
 			url:  "__health",
 			mockService: &mockService{
-				checkKafkaConnectivity: func() error {
+				checkSink: func() error {
 					return nil
 				},
 			},
@@ -274,7 +275,7 @@ func TestHealthServiceCache(t *testing.T) {
 
 			mockSvc := &mockService{
 				getConcept: getConcept,
-				checkKafkaConnectivity: func() error {
+				checkSink: func() error {
 					return nil
 				},
 			}
@@ -341,3 +342,133 @@ func assertRequest(t *testing.T, m http.Handler, url string, expectedBody string
 	assert.Equal(t, expectedStatus, rr.Code, url)
 	assert.Contains(t, body, expectedBody, url)
 }
+
+func TestHealthServiceBypassesConceptCache(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	var down bool
+	sl := newCachedSmartlogic(&mockSmartlogicClient{
+		resolveConceptFunc: func(uuid string) (*smartlogic.Concept, smartlogic.Namespace, error) {
+			if down {
+				return nil, smartlogic.Namespace{}, errors.New("smartlogic is down")
+			}
+			return &smartlogic.Concept{UUID: uuid, Raw: []byte("{}")}, smartlogic.Namespace{}, nil
+		},
+	})
+	healthService, err := NewHealthService(NewNotifierService(&mockSink{}, sl), &HealthServiceConfig{
+		AppSystemCode:          "system-code",
+		AppName:                "app-name",
+		Description:            "description",
+		SmartlogicModel:        "testModel",
+		SmartlogicModelConcept: "testConcept",
+		SuccessCacheTime:       time.Minute,
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, healthService.updateSmartlogicSuccessCache())
+	down = true
+	assert.Error(t, healthService.updateSmartlogicSuccessCache(), "Smartlogic being down shouldn't be hidden by the cached concept")
+	_, err = healthService.smartlogicConnectivityCheck("testModel")
+	assert.Error(t, err)
+}
+
+func TestHealthServiceMultipleModels(t *testing.T) {
+	t.Parallel()
+	log.SetOutput(ioutil.Discard)
+
+	okService := &mockService{
+		getConcept: func(s string) ([]byte, error) {
+			return []byte(""), nil
+		},
+		checkSink: func() error {
+			return nil
+		},
+	}
+	failingService := &mockService{
+		getConcept: func(s string) ([]byte, error) {
+			return nil, errors.New("couldn't retrieve the location from Smartlogic")
+		},
+	}
+
+	m := mux.NewRouter()
+	healthcheckCacheInterval := 10 * time.Millisecond
+	healthConfig := &HealthServiceConfig{
+		AppSystemCode:          "system-code",
+		AppName:                "app-name",
+		Description:            "description",
+		SmartlogicModel:        "FTModel",
+		SmartlogicModelConcept: "testConcept",
+		SuccessCacheTime:       healthcheckCacheInterval,
+	}
+	healthService, err := NewHealthService(okService, healthConfig, WithModelHealthCheck("Locations", "locationConcept", failingService))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, healthService.Checks, 3)
+	healthService.Start()
+	_ = healthService.RegisterAdminEndpoints(m)
+
+	time.Sleep(healthcheckCacheInterval)
+
+	assertRequest(t, m, "__gtg", "latest Smartlogic connectivity check is unsuccessful for model Locations", 503)
+	assertRequest(t, m, "__health", "Check connectivity to Smartlogic model Locations", 200)
+}
+
+type failingHTTPClient struct{}
+
+func (failingHTTPClient) Do(*http.Request) (*http.Response, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestHealthServiceCircuitBreaker(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	breaker := smartlogic.NewCircuitBreaker(failingHTTPClient{}, smartlogic.WithFailureThreshold(1))
+	healthConfig := &HealthServiceConfig{
+		AppSystemCode:          "system-code",
+		AppName:                "app-name",
+		Description:            "description",
+		SmartlogicModel:        "FTModel",
+		SmartlogicModelConcept: "testConcept",
+		SuccessCacheTime:       time.Minute,
+	}
+	healthService, err := NewHealthService(&mockService{}, healthConfig, WithCircuitBreaker(breaker))
+	assert.NoError(t, err)
+	assert.Len(t, healthService.Checks, 3)
+
+	msg, err := healthService.checkCircuitBreaker()
+	assert.NoError(t, err)
+	assert.Equal(t, "Smartlogic circuit breaker is closed", msg)
+
+	req, _ := http.NewRequest("GET", "http://smartlogic/url", nil)
+	_, _ = breaker.Do(req)
+	msg, err = healthService.checkCircuitBreaker()
+	assert.Error(t, err)
+	assert.Contains(t, msg, "Smartlogic circuit breaker is open since")
+	assert.Contains(t, msg, "after 1 consecutive failures")
+}
+
+func TestHealthServiceSinks(t *testing.T) {
+	healthConfig := &HealthServiceConfig{
+		AppSystemCode:          "system-code",
+		AppName:                "app-name",
+		Description:            "description",
+		SmartlogicModel:        "FTModel",
+		SmartlogicModelConcept: "testConcept",
+		SuccessCacheTime:       time.Minute,
+	}
+	kafkaSink := &mockSink{name: "Kafka", check: func() error { return nil }}
+	webhookSink := &mockSink{name: "webhook http://localhost/concepts", check: func() error { return errors.New("connection refused") }}
+	service := NewNotifierService(NewFanOutSink(kafkaSink, webhookSink), &mockSmartlogicClient{})
+	healthService, err := NewHealthService(service, healthConfig)
+	assert.NoError(t, err)
+	assert.Len(t, healthService.Checks, 3, "there should be a check per sink")
+
+	assert.Equal(t, "Check connectivity to Kafka", healthService.Checks[0].Name)
+	msg, err := healthService.Checks[0].Checker()
+	assert.NoError(t, err)
+	assert.Equal(t, "Successfully connected to Kafka", msg)
+	assert.Equal(t, "Check connectivity to webhook http://localhost/concepts", healthService.Checks[1].Name)
+	_, err = healthService.Checks[1].Checker()
+	assert.EqualError(t, err, "Error verifying open connection to webhook http://localhost/concepts")
+}
@@ -1,16 +1,26 @@
 package notifier
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/Financial-Times/kafka-client-go/kafka"
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
+	metrics "github.com/rcrowley/go-metrics"
 )
 
 type mockSmartlogicClient struct {
 	concepts                  map[string]string
+	namespaces                map[string]smartlogic.Namespace
 	getChangedConceptListFunc func(changeDate time.Time) ([]string, error)
+	getChangedConceptsFunc    func(changeDate time.Time) ([]smartlogic.ChangedConcept, error)
+	resolveConceptFunc        func(uuid string) (*smartlogic.Concept, smartlogic.Namespace, error)
+	getConceptInNamespaceFunc func(ns smartlogic.Namespace, uuid string) (*smartlogic.Concept, error)
+	listConceptsFunc          func(visit func([]string) error) error
+	getProjectionFunc         func(uuid string) (smartlogic.EffectiveProjection, error)
 
 	mu                          sync.Mutex
 	changedConceptListCallCount int
@@ -20,7 +30,7 @@ func (sl *mockSmartlogicClient) AccessToken() string {
 	return "access-token"
 }
 
-func (sl *mockSmartlogicClient) GetConcept(uuid string) ([]byte, error) {
+func (sl *mockSmartlogicClient) GetConcept(_ context.Context, uuid string) ([]byte, error) {
 	c, ok := sl.concepts[uuid]
 	if !ok {
 		return nil, errors.New("can't find concept")
@@ -28,7 +38,26 @@ func (sl *mockSmartlogicClient) GetConcept(uuid string) ([]byte, error) {
 	return []byte(c), nil
 }
 
-func (sl *mockSmartlogicClient) GetChangedConceptList(changeDate time.Time) ([]string, error) {
+func (sl *mockSmartlogicClient) ResolveConcept(_ context.Context, uuid string) (*smartlogic.Concept, smartlogic.Namespace, error) {
+	if sl.resolveConceptFunc != nil {
+		return sl.resolveConceptFunc(uuid)
+	}
+	c, err := sl.GetConcept(context.Background(), uuid)
+	if err != nil {
+		return nil, smartlogic.Namespace{}, err
+	}
+	return &smartlogic.Concept{UUID: uuid, Raw: c}, sl.namespaces[uuid], nil
+}
+
+func (sl *mockSmartlogicClient) GetConceptInNamespace(ctx context.Context, ns smartlogic.Namespace, uuid string) (*smartlogic.Concept, error) {
+	if sl.getConceptInNamespaceFunc != nil {
+		return sl.getConceptInNamespaceFunc(ns, uuid)
+	}
+	concept, _, err := sl.ResolveConcept(ctx, uuid)
+	return concept, err
+}
+
+func (sl *mockSmartlogicClient) GetChangedConceptList(_ context.Context, changeDate time.Time) ([]string, error) {
 	sl.mu.Lock()
 	defer sl.mu.Unlock()
 	sl.changedConceptListCallCount++
@@ -39,6 +68,54 @@ func (sl *mockSmartlogicClient) GetChangedConceptList(changeDate time.Time) ([]s
 	return nil, errors.New("not implemented")
 }
 
+func (sl *mockSmartlogicClient) GetChangedConcepts(_ context.Context, changeDate time.Time) ([]smartlogic.ChangedConcept, error) {
+	if sl.getChangedConceptsFunc != nil {
+		return sl.getChangedConceptsFunc(changeDate)
+	}
+	uuids, err := sl.GetChangedConceptList(context.Background(), changeDate)
+	if err != nil {
+		return nil, err
+	}
+	var changes []smartlogic.ChangedConcept
+	for _, uuid := range uuids {
+		changes = append(changes, smartlogic.ChangedConcept{UUID: uuid, ChangeType: smartlogic.ChangeTypeUpdated})
+	}
+	return changes, nil
+}
+
+func (sl *mockSmartlogicClient) ListConcepts(_ context.Context, visit func([]string) error) error {
+	if sl.listConceptsFunc != nil {
+		return sl.listConceptsFunc(visit)
+	}
+	return errors.New("not implemented")
+}
+
+func (sl *mockSmartlogicClient) GetProjection(_ context.Context, uuid string) (smartlogic.EffectiveProjection, error) {
+	if sl.getProjectionFunc != nil {
+		return sl.getProjectionFunc(uuid)
+	}
+	return smartlogic.EffectiveProjection{}, errors.New("not implemented")
+}
+
+// newCachedSmartlogic returns a concept cache in front of the client, with its metrics in a registry of its own.
+func newCachedSmartlogic(client smartlogic.Clienter) *smartlogic.CachedClient {
+	return smartlogic.NewCachedClient(client, smartlogic.WithCacheMetrics(metrics.NewRegistry(), "cache"))
+}
+
+// newVersionedSmartlogic returns a client whose concepts get a new version each time they are fetched.
+func newVersionedSmartlogic() *mockSmartlogicClient {
+	var mu sync.Mutex
+	versions := map[string]int{}
+	return &mockSmartlogicClient{
+		resolveConceptFunc: func(uuid string) (*smartlogic.Concept, smartlogic.Namespace, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			versions[uuid]++
+			return &smartlogic.Concept{UUID: uuid, Raw: []byte(fmt.Sprintf(`{"version": %d}`, versions[uuid]))}, smartlogic.Namespace{}, nil
+		},
+	}
+}
+
 func (sl *mockSmartlogicClient) getChangedConceptListCallCount() int {
 	sl.mu.Lock()
 	defer sl.mu.Unlock()
@@ -48,6 +125,7 @@ func (sl *mockSmartlogicClient) getChangedConceptListCallCount() int {
 type mockKafkaClient struct {
 	mu        sync.Mutex
 	sentCount int
+	sent      []kafka.FTMessage
 }
 
 func (kf *mockKafkaClient) ConnectivityCheck() error {
@@ -59,6 +137,7 @@ func (kf *mockKafkaClient) SendMessage(message kafka.FTMessage) error {
 	defer kf.mu.Unlock()
 
 	kf.sentCount++
+	kf.sent = append(kf.sent, message)
 	return nil
 }
 
@@ -71,49 +150,130 @@ func (kf *mockKafkaClient) getSentCount() int {
 	return kf.sentCount
 }
 
+func (kf *mockKafkaClient) getSent() []string {
+	var bodies []string
+	for _, m := range kf.getSentMessages() {
+		bodies = append(bodies, m.Body)
+	}
+	return bodies
+}
+
+func (kf *mockKafkaClient) getSentMessages() []kafka.FTMessage {
+	kf.mu.Lock()
+	defer kf.mu.Unlock()
+	return append([]kafka.FTMessage(nil), kf.sent...)
+}
+
 type mockService struct {
-	getConcept             func(string) ([]byte, error)
-	getChangedConceptList  func(time.Time) ([]string, error)
-	notify                 func(time.Time, string) error
-	forceNotify            func([]string, string) error
-	checkKafkaConnectivity func() error
+	getConcept            func(string) ([]byte, error)
+	getChangedConceptList func(time.Time) ([]string, error)
+	getChangedConcepts    func(time.Time) ([]smartlogic.ChangedConcept, error)
+	notify                func(time.Time, string) error
+	forceNotify           func([]string, string) (Report, error)
+	checkSink             func() error
+	listConcepts          func(func([]string) error) error
+	getProjection         func(string) (smartlogic.EffectiveProjection, error)
+	deadLetters           *DeadLetterQueue
 }
 
-func (s *mockService) GetConcept(uuid string) ([]byte, error) {
+func (s *mockService) DeadLetters() *DeadLetterQueue {
+	return s.deadLetters
+}
+
+func (s *mockService) GetProjection(_ context.Context, uuid string) (smartlogic.EffectiveProjection, error) {
+	if s.getProjection != nil {
+		return s.getProjection(uuid)
+	}
+	return smartlogic.EffectiveProjection{}, errors.New("not implemented")
+}
+
+func (s *mockService) ListConcepts(_ context.Context, visit func([]string) error) error {
+	if s.listConcepts != nil {
+		return s.listConcepts(visit)
+	}
+	return errors.New("not implemented")
+}
+
+func (s *mockService) GetConcept(_ context.Context, uuid string) ([]byte, error) {
 	if s.getConcept != nil {
 		return s.getConcept(uuid)
 	}
 	return nil, errors.New("not implemented")
 }
 
-func (s *mockService) GetChangedConceptList(lastChange time.Time) ([]string, error) {
+func (s *mockService) GetChangedConceptList(_ context.Context, lastChange time.Time) ([]string, error) {
 	if s.getChangedConceptList != nil {
 		return s.getChangedConceptList(lastChange)
 	}
 	return nil, errors.New("not implemented")
 }
 
-func (s *mockService) Notify(lastChange time.Time, transactionID string) error {
+func (s *mockService) GetChangedConcepts(_ context.Context, lastChange time.Time) ([]smartlogic.ChangedConcept, error) {
+	if s.getChangedConcepts != nil {
+		return s.getChangedConcepts(lastChange)
+	}
+	return nil, errors.New("not implemented")
+}
+
+func (s *mockService) Notify(_ context.Context, lastChange time.Time, transactionID string) error {
 	if s.notify != nil {
 		return s.notify(lastChange, transactionID)
 	}
 	return errors.New("not implemented")
 }
 
-func (s *mockService) ForceNotify(uuids []string, transactionID string) error {
+func (s *mockService) ForceNotify(_ context.Context, uuids []string, transactionID string) (Report, error) {
 	if s.forceNotify != nil {
 		return s.forceNotify(uuids, transactionID)
 	}
-	return errors.New("not implemented")
+	return Report{}, errors.New("not implemented")
+}
+
+func (s *mockService) Sinks() []Sink {
+	return []Sink{&mockSink{name: "Kafka", check: s.checkSink}}
+}
+
+// mockSink records the messages published to it, failing them while err is set.
+type mockSink struct {
+	name  string
+	check func() error
+
+	mu        sync.Mutex
+	published []Message
+	err       error
+}
+
+func (s *mockSink) Name() string {
+	return s.name
+}
+
+func (s *mockSink) Publish(message Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.published = append(s.published, message)
+	return nil
 }
 
-func (s *mockService) CheckKafkaConnectivity() error {
-	if s.checkKafkaConnectivity != nil {
-		return s.checkKafkaConnectivity()
+func (s *mockSink) Check() error {
+	if s.check != nil {
+		return s.check()
 	}
 	return errors.New("not implemented")
 }
 
+func (s *mockSink) Close() error {
+	return nil
+}
+
+func (s *mockSink) getPublished() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.published...)
+}
+
 type mockTicker struct {
 	ticker *time.Ticker
 
@@ -136,3 +296,44 @@ func (t *mockTicker) getTicks() int {
 	defer t.mu.Unlock()
 	return t.ticks
 }
+
+// mockOutbox is an in-memory Outbox, failing to add items when err is set.
+type mockOutbox struct {
+	mu    sync.Mutex
+	items []OutboxItem
+	seq   int
+	err   error
+}
+
+func (o *mockOutbox) Add(item OutboxItem) (OutboxItem, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.err != nil {
+		return item, o.err
+	}
+	o.seq++
+	item.ID = fmt.Sprintf("%d", o.seq)
+	if item.Accepted.IsZero() {
+		item.Accepted = time.Now()
+	}
+	o.items = append(o.items, item)
+	return item, nil
+}
+
+func (o *mockOutbox) Remove(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i, item := range o.items {
+		if item.ID == id {
+			o.items = append(o.items[:i], o.items[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (o *mockOutbox) Pending() ([]OutboxItem, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]OutboxItem(nil), o.items...), nil
+}
@@ -0,0 +1,133 @@
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/smartlogic-notifier/internal/fileutil"
+	log "github.com/sirupsen/logrus"
+)
+
+// Kinds of the work kept in the outbox.
+const (
+	OutboxNotify      = "notify"
+	OutboxForceNotify = "force-notify"
+)
+
+const outboxFileSuffix = ".json"
+
+// OutboxItem is a notification accepted by the notifier which hasn't been published yet.
+type OutboxItem struct {
+	ID    string `json:"id"`
+	Kind  string `json:"kind"`
+	Model string `json:"model"`
+	// NotifySince is the last change date of a notify request.
+	NotifySince time.Time `json:"notifySince,omitempty"`
+	// UUIDs and Force are the payload of a force-notify request.
+	UUIDs         []string  `json:"uuids,omitempty"`
+	Force         bool      `json:"force,omitempty"`
+	TransactionID string    `json:"transactionId,omitempty"`
+	Accepted      time.Time `json:"accepted"`
+}
+
+// Outbox persists the accepted notifications until they are published, so that they survive restarts.
+type Outbox interface {
+	// Add persists the item and returns it with its ID.
+	Add(item OutboxItem) (OutboxItem, error)
+	// Remove deletes the item once it is published.
+	Remove(id string) error
+	// Pending returns the items not removed yet, in the order they were added.
+	Pending() ([]OutboxItem, error)
+}
+
+// FileOutbox is an Outbox keeping a file per item in a directory. The files are synced to disk before Add returns.
+type FileOutbox struct {
+	dir string
+	now func() time.Time
+
+	mu   sync.Mutex
+	last string
+	seq  int
+}
+
+// NewFileOutbox creates an outbox in the directory, which is created if it doesn't exist.
+func NewFileOutbox(dir string) (*FileOutbox, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create the outbox directory: %w", err)
+	}
+	return &FileOutbox{dir: dir, now: time.Now}, nil
+}
+
+func (o *FileOutbox) Add(item OutboxItem) (OutboxItem, error) {
+	item.Accepted = o.now().UTC()
+	item.ID = o.nextID(item.Accepted)
+	data, err := json.Marshal(item)
+	if err != nil {
+		return item, err
+	}
+	if err := fileutil.WriteFileAtomic(o.path(item.ID), data, 0644); err != nil {
+		return item, fmt.Errorf("failed to persist the notification: %w", err)
+	}
+	return item, nil
+}
+
+func (o *FileOutbox) Remove(id string) error {
+	err := os.Remove(o.path(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Pending reads the items from their files. The files which can't be read are skipped, so that a corrupted
+// file doesn't block the other items.
+func (o *FileOutbox) Pending() ([]OutboxItem, error) {
+	files, err := ioutil.ReadDir(o.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the outbox: %w", err)
+	}
+	var items []OutboxItem
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, outboxFileSuffix) {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(o.dir, name))
+		if err != nil {
+			log.WithError(err).WithField("file", name).Error("Failed to read a pending notification from the outbox")
+			continue
+		}
+		var item OutboxItem
+		if err := json.Unmarshal(data, &item); err != nil {
+			log.WithError(err).WithField("file", name).Error("Failed to parse a pending notification from the outbox")
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// nextID returns an ID sorting after all the previous ones, as the files are listed in the order of their names.
+func (o *FileOutbox) nextID(accepted time.Time) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	id := fmt.Sprintf("%020d-%06d", accepted.UnixNano(), 0)
+	if id <= o.last {
+		o.seq++
+		id = o.last[:20] + fmt.Sprintf("-%06d", o.seq)
+	} else {
+		o.seq = 0
+	}
+	o.last = id
+	return id
+}
+
+func (o *FileOutbox) path(id string) string {
+	return filepath.Join(o.dir, filepath.Base(id)+outboxFileSuffix)
+}
@@ -0,0 +1,46 @@
+package notifier
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileOutbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	outbox, err := NewFileOutbox(filepath.Join(dir, "outbox"))
+	assert.NoError(t, err)
+	now := time.Date(2020, 4, 27, 12, 0, 0, 0, time.UTC)
+	outbox.now = func() time.Time { return now }
+
+	notify, err := outbox.Add(OutboxItem{Kind: OutboxNotify, Model: "FTModel", NotifySince: now.Add(-time.Minute), TransactionID: "tid_1"})
+	assert.NoError(t, err)
+	forceNotify, err := outbox.Add(OutboxItem{Kind: OutboxForceNotify, Model: "FTModel", UUIDs: []string{"uuid1"}, Force: true})
+	assert.NoError(t, err)
+	now = now.Add(-time.Second)
+	late, err := outbox.Add(OutboxItem{Kind: OutboxNotify, Model: "Locations", NotifySince: now})
+	assert.NoError(t, err)
+	assert.True(t, notify.ID < forceNotify.ID && forceNotify.ID < late.ID, "the IDs should keep the order of the items even if the clock goes back")
+	assert.Equal(t, now.Add(time.Second), notify.Accepted)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "outbox", "corrupted.json"), []byte(`{"kind": `), 0644))
+
+	reopened, err := NewFileOutbox(filepath.Join(dir, "outbox"))
+	assert.NoError(t, err)
+	pending, err := reopened.Pending()
+	assert.NoError(t, err)
+	assert.Equal(t, []OutboxItem{notify, forceNotify, late}, pending, "the items should survive restarts, in order")
+
+	assert.NoError(t, reopened.Remove(forceNotify.ID))
+	assert.NoError(t, reopened.Remove(forceNotify.ID), "removing a missing item should succeed")
+	pending, err = reopened.Pending()
+	assert.NoError(t, err)
+	assert.Equal(t, []OutboxItem{notify, late}, pending)
+}
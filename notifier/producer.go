@@ -0,0 +1,73 @@
+package notifier
+
+import (
+	"strings"
+
+	"github.com/Financial-Times/kafka-client-go/kafka"
+	"github.com/Shopify/sarama"
+)
+
+// KeyedProducer is a Kafka producer which can set the key of the messages, so that all the messages with the same
+// key are written to the same partition, and consumed in the order they were published.
+type KeyedProducer interface {
+	kafka.Producer
+	SendKeyedMessage(key string, message kafka.FTMessage) error
+}
+
+// SaramaProducer is a KeyedProducer writing the messages to a topic synchronously. The messages are partitioned by
+// the hash of their key, and a single request is in flight at a time, so that a retry never reorders them.
+type SaramaProducer struct {
+	topic    string
+	producer sarama.SyncProducer
+	// client is the connection to the brokers the producer writes with.
+	client sarama.Client
+}
+
+// NewKeyedProducer creates a producer writing to the topic of the Kafka brokers, given as a comma separated list.
+func NewKeyedProducer(brokers string, topic string, config *sarama.Config) (*SaramaProducer, error) {
+	addrs := strings.Split(brokers, ",")
+	config.Producer.Partitioner = sarama.NewHashPartitioner
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Return.Successes = true
+	config.Net.MaxOpenRequests = 1
+	client, err := sarama.NewClient(addrs, config)
+	if err != nil {
+		return nil, err
+	}
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return newSaramaProducer(topic, producer, client), nil
+}
+
+func newSaramaProducer(topic string, producer sarama.SyncProducer, client sarama.Client) *SaramaProducer {
+	return &SaramaProducer{topic: topic, producer: producer, client: client}
+}
+
+// SendMessage writes the message without a key, to any partition.
+func (p *SaramaProducer) SendMessage(message kafka.FTMessage) error {
+	return p.SendKeyedMessage("", message)
+}
+
+func (p *SaramaProducer) SendKeyedMessage(key string, message kafka.FTMessage) error {
+	msg := &sarama.ProducerMessage{Topic: p.topic, Value: sarama.StringEncoder(message.Build())}
+	if key != "" {
+		msg.Key = sarama.StringEncoder(key)
+	}
+	_, _, err := p.producer.SendMessage(msg)
+	return err
+}
+
+// ConnectivityCheck refreshes the metadata of the topic with the client of the producer, rather than connecting to
+// the brokers again for every check.
+func (p *SaramaProducer) ConnectivityCheck() error {
+	return p.client.RefreshMetadata(p.topic)
+}
+
+// Shutdown closes the producer, then its client, which a producer created from a client doesn't close.
+func (p *SaramaProducer) Shutdown() {
+	_ = p.producer.Close()
+	_ = p.client.Close()
+}
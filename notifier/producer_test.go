@@ -0,0 +1,97 @@
+package notifier
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/Financial-Times/kafka-client-go/kafka"
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockSyncProducer struct {
+	mu     sync.Mutex
+	sent   []*sarama.ProducerMessage
+	closed bool
+}
+
+func (p *mockSyncProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sent = append(p.sent, msg)
+	return 0, int64(len(p.sent)), nil
+}
+
+func (p *mockSyncProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	for _, msg := range msgs {
+		if _, _, err := p.SendMessage(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *mockSyncProducer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return nil
+}
+
+func encoded(t *testing.T, encoder sarama.Encoder) string {
+	if encoder == nil {
+		return ""
+	}
+	b, err := encoder.Encode()
+	assert.NoError(t, err)
+	return string(b)
+}
+
+// mockSaramaClient is a sarama.Client whose metadata can't be refreshed when err is set.
+type mockSaramaClient struct {
+	sarama.Client
+
+	mu        sync.Mutex
+	refreshed []string
+	err       error
+	closed    bool
+}
+
+func (c *mockSaramaClient) RefreshMetadata(topics ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refreshed = append(c.refreshed, topics...)
+	return c.err
+}
+
+func (c *mockSaramaClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func TestSaramaProducer(t *testing.T) {
+	sp := &mockSyncProducer{}
+	client := &mockSaramaClient{}
+	producer := newSaramaProducer("SmartlogicConcept", sp, client)
+	message := kafka.NewFTMessage(map[string]string{"X-Request-Id": "tid_1"}, "concept")
+
+	assert.NoError(t, producer.SendKeyedMessage("uuid1", message))
+	assert.NoError(t, producer.SendMessage(message))
+	assert.Len(t, sp.sent, 2)
+	assert.Equal(t, "SmartlogicConcept", sp.sent[0].Topic)
+	assert.Equal(t, "uuid1", encoded(t, sp.sent[0].Key))
+	assert.Equal(t, message.Build(), encoded(t, sp.sent[0].Value))
+	assert.Nil(t, sp.sent[1].Key, "the messages sent without a key shouldn't be keyed")
+
+	assert.NoError(t, producer.ConnectivityCheck())
+	client.err = errors.New("no brokers")
+	assert.EqualError(t, producer.ConnectivityCheck(), "no brokers")
+	assert.Equal(t, []string{"SmartlogicConcept", "SmartlogicConcept"}, client.refreshed,
+		"the checks should refresh the metadata of the topic with the client of the producer")
+	producer.Shutdown()
+	assert.True(t, sp.closed)
+	assert.True(t, client.closed)
+}
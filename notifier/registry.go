@@ -0,0 +1,135 @@
+package notifier
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
+)
+
+// smartlogicGraphPrefixes are the prefixes Smartlogic may put in front of the model name in the graph ids it sends us.
+var smartlogicGraphPrefixes = []string{"urn:x-evn-master:", "urn:x-evn-tch-union:"}
+
+// ModelConfig describes a Smartlogic model served by the notifier.
+type ModelConfig struct {
+	Model              string `json:"model"`
+	ConceptURIPrefix   string `json:"conceptUriPrefix"`
+	HealthcheckConcept string `json:"healthcheckConcept"`
+	// PublishDeletions enables the deletion messages for the changed concepts which no longer exist.
+	PublishDeletions bool `json:"publishDeletions"`
+	// Projection sets the properties requested when getting the concepts of the model. If not set, the projection
+	// of the service is used. A projection without properties gets the ones of the default projection.
+	Projection *smartlogic.Projection `json:"projection,omitempty"`
+}
+
+func (c ModelConfig) Validate() error {
+	if c.Model == "" {
+		return errors.New("property model is required")
+	}
+	if c.ConceptURIPrefix == "" {
+		return fmt.Errorf("property conceptUriPrefix is required for model %s", c.Model)
+	}
+	if c.HealthcheckConcept == "" {
+		return fmt.Errorf("property healthcheckConcept is required for model %s", c.Model)
+	}
+	if c.Projection != nil {
+		if err := c.Projection.Validate(); err != nil {
+			return fmt.Errorf("invalid projection for model %s: %w", c.Model, err)
+		}
+	}
+	return nil
+}
+
+// ParseModelConfigs reads the list of model configurations from its JSON representation.
+func ParseModelConfigs(data string) ([]ModelConfig, error) {
+	var configs []ModelConfig
+	if err := json.Unmarshal([]byte(data), &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse the models configuration: %w", err)
+	}
+	if len(configs) == 0 {
+		return nil, errors.New("at least one model should be configured")
+	}
+	for _, c := range configs {
+		if c.Projection != nil && len(c.Projection.Properties) == 0 {
+			c.Projection.Properties = smartlogic.DefaultProjection().Properties
+		}
+		if err := c.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return configs, nil
+}
+
+// ModelRegistry holds a notifier service for each of the Smartlogic models served by this process.
+// The first registered model is the default one, used by the endpoints which don't specify a model.
+type ModelRegistry struct {
+	models map[string]Servicer
+	names  []string
+}
+
+func NewModelRegistry() *ModelRegistry {
+	return &ModelRegistry{models: map[string]Servicer{}}
+}
+
+// BuildModelRegistry creates a registry with the services built for each of the given model configurations.
+func BuildModelRegistry(configs []ModelConfig, build func(ModelConfig) (Servicer, error)) (*ModelRegistry, error) {
+	registry := NewModelRegistry()
+	for _, c := range configs {
+		service, err := build(c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build the service for model %s: %w", c.Model, err)
+		}
+		if err := registry.Register(c.Model, service); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+func (r *ModelRegistry) Register(model string, service Servicer) error {
+	if _, ok := r.models[model]; ok {
+		return fmt.Errorf("model %s is already registered", model)
+	}
+	r.models[model] = service
+	r.names = append(r.names, model)
+	return nil
+}
+
+// Get returns the service of the given model.
+func (r *ModelRegistry) Get(model string) (Servicer, bool) {
+	service, ok := r.models[model]
+	return service, ok
+}
+
+// Lookup returns the service of the model a Smartlogic graph id refers to.
+// If the process serves a single model, that model is returned regardless of the graph id.
+func (r *ModelRegistry) Lookup(graphID string) (string, Servicer, bool) {
+	if service, ok := r.models[graphID]; ok {
+		return graphID, service, true
+	}
+	for _, prefix := range smartlogicGraphPrefixes {
+		model := strings.TrimPrefix(graphID, prefix)
+		if service, ok := r.models[model]; ok {
+			return model, service, true
+		}
+	}
+	if len(r.names) == 1 {
+		return r.Default()
+	}
+	return "", nil, false
+}
+
+// Default returns the first registered model and its service.
+func (r *ModelRegistry) Default() (string, Servicer, bool) {
+	if len(r.names) == 0 {
+		return "", nil, false
+	}
+	return r.names[0], r.models[r.names[0]], true
+}
+
+// Models returns the names of the registered models in the order of their registration.
+func (r *ModelRegistry) Models() []string {
+	return append([]string(nil), r.names...)
+}
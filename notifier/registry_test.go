@@ -0,0 +1,121 @@
+package notifier
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseModelConfigs(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          string
+		expected      []ModelConfig
+		expectedError bool
+	}{
+		{
+			name: "success",
+			data: `[{"model": "FTModel", "conceptUriPrefix": "http://www.ft.com/thing/", "healthcheckConcept": "b1a492d9-dcfe-43f8-8072-17b4618a78fd"},
+				{"model": "Locations", "conceptUriPrefix": "http://www.ft.com/ontology/managedlocation/", "healthcheckConcept": "822e3c99-afc6-3c55-b497-2255ac546f35"}]`,
+			expected: []ModelConfig{
+				{Model: "FTModel", ConceptURIPrefix: "http://www.ft.com/thing/", HealthcheckConcept: "b1a492d9-dcfe-43f8-8072-17b4618a78fd"},
+				{Model: "Locations", ConceptURIPrefix: "http://www.ft.com/ontology/managedlocation/", HealthcheckConcept: "822e3c99-afc6-3c55-b497-2255ac546f35"},
+			},
+		},
+		{
+			name: "projection",
+			data: `[{"model": "FTModel", "conceptUriPrefix": "http://www.ft.com/thing/", "healthcheckConcept": "b1a492d9-dcfe-43f8-8072-17b4618a78fd",
+				"projection": {"types": {"Person": ["skosxl:hiddenLabel/skosxl:literalForm"]}}}]`,
+			expected: []ModelConfig{
+				{Model: "FTModel", ConceptURIPrefix: "http://www.ft.com/thing/", HealthcheckConcept: "b1a492d9-dcfe-43f8-8072-17b4618a78fd",
+					Projection: &smartlogic.Projection{
+						Properties: smartlogic.DefaultProjection().Properties,
+						Types:      map[string][]string{"Person": {"skosxl:hiddenLabel/skosxl:literalForm"}},
+					}},
+			},
+		},
+		{
+			name:          "invalid projection",
+			data:          `[{"model": "FTModel", "conceptUriPrefix": "http://www.ft.com/thing/", "healthcheckConcept": "b1a492d9-dcfe-43f8-8072-17b4618a78fd", "projection": {"properties": [""]}}]`,
+			expectedError: true,
+		},
+		{
+			name:          "invalid json",
+			data:          `[{"model": "FTModel"`,
+			expectedError: true,
+		},
+		{
+			name:          "no models",
+			data:          `[]`,
+			expectedError: true,
+		},
+		{
+			name:          "missing healthcheck concept",
+			data:          `[{"model": "FTModel", "conceptUriPrefix": "http://www.ft.com/thing/"}]`,
+			expectedError: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configs, err := ParseModelConfigs(test.data)
+			if test.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, configs)
+		})
+	}
+}
+
+func TestBuildModelRegistry(t *testing.T) {
+	configs := []ModelConfig{{Model: "FTModel"}, {Model: "Locations"}}
+	registry, err := BuildModelRegistry(configs, func(c ModelConfig) (Servicer, error) {
+		return &mockService{}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"FTModel", "Locations"}, registry.Models())
+
+	model, _, ok := registry.Default()
+	assert.True(t, ok)
+	assert.Equal(t, "FTModel", model)
+
+	_, err = BuildModelRegistry(append(configs, ModelConfig{Model: "FTModel"}), func(c ModelConfig) (Servicer, error) {
+		return &mockService{}, nil
+	})
+	assert.Error(t, err, "duplicate models are not allowed")
+
+	_, err = BuildModelRegistry(configs, func(c ModelConfig) (Servicer, error) {
+		return nil, errors.New("failed")
+	})
+	assert.Error(t, err)
+}
+
+func TestModelRegistry_Lookup(t *testing.T) {
+	ftModel := &mockService{}
+	locations := &mockService{}
+	registry := NewModelRegistry()
+	assert.NoError(t, registry.Register("FTModel", ftModel))
+	assert.NoError(t, registry.Register("Locations", locations))
+
+	model, service, ok := registry.Lookup("Locations")
+	assert.True(t, ok)
+	assert.Equal(t, "Locations", model)
+	assert.True(t, service == locations)
+
+	model, service, ok = registry.Lookup("urn:x-evn-master:FTModel")
+	assert.True(t, ok)
+	assert.Equal(t, "FTModel", model)
+	assert.True(t, service == ftModel)
+
+	_, _, ok = registry.Lookup("Unknown")
+	assert.False(t, ok)
+
+	single := NewModelRegistry()
+	assert.NoError(t, single.Register("FTModel", ftModel))
+	model, _, ok = single.Lookup("Unknown")
+	assert.True(t, ok, "a single model is used regardless of the graph id")
+	assert.Equal(t, "FTModel", model)
+}
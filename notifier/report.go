@@ -0,0 +1,72 @@
+package notifier
+
+// Statuses of the concepts in a notification report.
+const (
+	StatusPublished = "published"
+	StatusDeleted   = "deleted"
+	StatusFailed    = "failed"
+	// StatusUnchanged is the status of the concepts which weren't published, as their payload is unchanged since
+	// they were last published.
+	StatusUnchanged = "unchanged"
+)
+
+// ConceptOutcome is the result of notifying a single concept.
+type ConceptOutcome struct {
+	UUID      string `json:"uuid"`
+	Status    string `json:"status"`
+	Namespace string `json:"namespace,omitempty"`
+	Error     string `json:"error,omitempty"`
+	// Violations are the validation rules the concept violates.
+	Violations []Violation `json:"violations,omitempty"`
+	// CascadedFrom is the UUID of the notified concept this one is related to, when it was only notified because of
+	// the cascade rather than requested or changed.
+	CascadedFrom string `json:"cascadedFrom,omitempty"`
+
+	// related are the UUIDs of the concepts the cascade continues to.
+	related []string
+}
+
+// failed records the error the concept couldn't be published because of.
+func (o ConceptOutcome) failed(err error) (ConceptOutcome, error) {
+	o.Status = StatusFailed
+	o.Error = err.Error()
+	return o, err
+}
+
+// Report holds the outcome of each concept of a notification, in the order the concepts were requested.
+type Report struct {
+	Concepts []ConceptOutcome `json:"concepts"`
+}
+
+// Failed returns the outcomes of the concepts that couldn't be published.
+func (r Report) Failed() []ConceptOutcome {
+	var failed []ConceptOutcome
+	for _, c := range r.Concepts {
+		if c.Status == StatusFailed {
+			failed = append(failed, c)
+		}
+	}
+	return failed
+}
+
+// Cascaded returns the UUIDs of the concepts which were notified because of the cascade.
+func (r Report) Cascaded() []string {
+	var uuids []string
+	for _, c := range r.Concepts {
+		if c.CascadedFrom != "" {
+			uuids = append(uuids, c.UUID)
+		}
+	}
+	return uuids
+}
+
+// Published returns the number of concepts for which a message was published.
+func (r Report) Published() int {
+	published := 0
+	for _, c := range r.Concepts {
+		if c.Status == StatusPublished || c.Status == StatusDeleted {
+			published++
+		}
+	}
+	return published
+}
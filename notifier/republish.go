@@ -0,0 +1,240 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
+	transactionidutils "github.com/Financial-Times/transactionid-utils-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// States of a republish job.
+const (
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobCancelled = "cancelled"
+	JobFailed    = "failed"
+)
+
+// maxReportedFailures caps the number of failed UUIDs kept in the status of a republish job.
+const maxReportedFailures = 1000
+
+// DefaultRepublishBatchSize is the number of concepts a republish job notifies at once when none is configured.
+const DefaultRepublishBatchSize = 100
+
+var (
+	ErrJobRunning   = errors.New("a republish job is already running")
+	ErrNoJob        = errors.New("no republish job was started")
+	errJobCancelled = errors.New("republish job was cancelled")
+)
+
+// RepublishStatus is the progress of a republish job.
+type RepublishStatus struct {
+	TransactionID string     `json:"transactionId"`
+	Model         string     `json:"model,omitempty"`
+	State         string     `json:"state"`
+	Started       time.Time  `json:"started"`
+	Finished      *time.Time `json:"finished,omitempty"`
+	Listed        int        `json:"listed"`
+	Published     int        `json:"published"`
+	Failed        int        `json:"failed"`
+	FailedUUIDs   []string   `json:"failedUuids,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	// Cancelling is set when the job was asked to stop, but the batch being notified is not completed yet.
+	Cancelling bool `json:"cancelling,omitempty"`
+}
+
+// RepublishJob lists all the concepts of a model and notifies them in throttled batches.
+type RepublishJob struct {
+	service   Servicer
+	batchSize int
+	interval  time.Duration
+
+	mu     sync.Mutex
+	status RepublishStatus
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+	done   chan struct{}
+}
+
+func newRepublishJob(ctx context.Context, model string, service Servicer, batchSize int, interval time.Duration) *RepublishJob {
+	ctx, cancel := context.WithCancel(WithoutDeduplication(WithoutCascade(smartlogic.WithoutCache(smartlogic.WithBudget(ctx, smartlogic.BudgetBulk)))))
+	return &RepublishJob{
+		service:   service,
+		batchSize: batchSize,
+		interval:  interval,
+		status: RepublishStatus{
+			TransactionID: transactionidutils.NewTransactionID(),
+			Model:         model,
+			State:         JobRunning,
+			Started:       time.Now(),
+		},
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+// Status returns a snapshot of the progress of the job.
+func (j *RepublishJob) Status() RepublishStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	status := j.status
+	status.FailedUUIDs = append([]string(nil), j.status.FailedUUIDs...)
+	return status
+}
+
+// Cancel stops the job. The concepts of the batch being notified which weren't published yet are reported as failed.
+func (j *RepublishJob) Cancel() {
+	j.once.Do(func() {
+		j.update(func(s *RepublishStatus) {
+			s.Cancelling = s.State == JobRunning
+		})
+		j.cancel()
+	})
+}
+
+// Wait blocks until the job finishes.
+func (j *RepublishJob) Wait() {
+	<-j.done
+}
+
+func (j *RepublishJob) running() bool {
+	select {
+	case <-j.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (j *RepublishJob) run() {
+	defer close(j.done)
+	defer j.cancel()
+
+	entry := log.WithField("transaction_id", j.status.TransactionID).WithField("model", j.status.Model)
+	entry.Info("Starting to republish all the concepts")
+
+	batches := 0
+	err := j.service.ListConcepts(j.ctx, func(uuids []string) error {
+		j.update(func(s *RepublishStatus) { s.Listed += len(uuids) })
+		for start := 0; start < len(uuids); start += j.batchSize {
+			end := start + j.batchSize
+			if end > len(uuids) {
+				end = len(uuids)
+			}
+			if err := j.pause(batches > 0); err != nil {
+				return err
+			}
+			batches++
+			report, _ := j.service.ForceNotify(j.ctx, uuids[start:end], j.status.TransactionID)
+			j.record(report)
+		}
+		return nil
+	})
+
+	finished := time.Now()
+	j.update(func(s *RepublishStatus) {
+		s.Finished = &finished
+		s.Cancelling = false
+		switch {
+		case errors.Is(err, errJobCancelled), errors.Is(err, context.Canceled):
+			s.State = JobCancelled
+		case err != nil:
+			s.State = JobFailed
+			s.Error = err.Error()
+		default:
+			s.State = JobCompleted
+		}
+	})
+	status := j.Status()
+	entry.WithField("state", status.State).WithField("published", status.Published).WithField("failed", status.Failed).
+		Info("Finished republishing all the concepts")
+}
+
+// pause throttles the job, waiting for the configured interval between batches, unless the job gets cancelled.
+func (j *RepublishJob) pause(wait bool) error {
+	if j.ctx.Err() != nil {
+		return errJobCancelled
+	}
+	if !wait || j.interval <= 0 {
+		return nil
+	}
+	select {
+	case <-j.ctx.Done():
+		return errJobCancelled
+	case <-time.After(j.interval):
+		return nil
+	}
+}
+
+func (j *RepublishJob) record(report Report) {
+	j.update(func(s *RepublishStatus) {
+		for _, c := range report.Concepts {
+			if c.Status == StatusFailed {
+				s.Failed++
+				if len(s.FailedUUIDs) < maxReportedFailures {
+					s.FailedUUIDs = append(s.FailedUUIDs, c.UUID)
+				}
+				continue
+			}
+			s.Published++
+		}
+	})
+}
+
+func (j *RepublishJob) update(f func(*RepublishStatus)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f(&j.status)
+}
+
+// Republisher runs at most one republish job per model at a time.
+type Republisher struct {
+	batchSize int
+	interval  time.Duration
+
+	mu   sync.Mutex
+	jobs map[string]*RepublishJob
+}
+
+// NewRepublisher creates a republisher notifying batchSize concepts at once and waiting interval between batches.
+func NewRepublisher(batchSize int, interval time.Duration) *Republisher {
+	if batchSize <= 0 {
+		batchSize = DefaultRepublishBatchSize
+	}
+	return &Republisher{
+		batchSize: batchSize,
+		interval:  interval,
+		jobs:      map[string]*RepublishJob{},
+	}
+}
+
+// Start starts republishing all the concepts of the model, unless a job is already running for it.
+// The job outlives the caller, but is cancelled once ctx is done.
+func (r *Republisher) Start(ctx context.Context, model string, service Servicer) (*RepublishJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if job, ok := r.jobs[model]; ok && job.running() {
+		return job, ErrJobRunning
+	}
+	job := newRepublishJob(ctx, model, service, r.batchSize, r.interval)
+	r.jobs[model] = job
+	go job.run()
+	return job, nil
+}
+
+// Job returns the latest job started for the model.
+func (r *Republisher) Job(model string) (*RepublishJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[model]
+	if !ok {
+		return nil, ErrNoJob
+	}
+	return job, nil
+}
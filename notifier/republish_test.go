@@ -0,0 +1,118 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newListingService(pages [][]string, failing map[string]bool) (*mockService, *[][]string) {
+	var mu sync.Mutex
+	var batches [][]string
+	service := &mockService{
+		listConcepts: func(visit func([]string) error) error {
+			for _, page := range pages {
+				if err := visit(page); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		forceNotify: func(uuids []string, transactionID string) (Report, error) {
+			mu.Lock()
+			batches = append(batches, append([]string(nil), uuids...))
+			mu.Unlock()
+			report := Report{}
+			for _, uuid := range uuids {
+				status := StatusPublished
+				if failing[uuid] {
+					status = StatusFailed
+				}
+				report.Concepts = append(report.Concepts, ConceptOutcome{UUID: uuid, Status: status})
+			}
+			return report, nil
+		},
+	}
+	return service, &batches
+}
+
+func TestRepublisher_Completes(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	service, batches := newListingService([][]string{{"1", "2", "3"}, {"4", "5"}}, map[string]bool{"4": true})
+
+	job, err := NewRepublisher(2, time.Millisecond).Start(context.Background(), "FTModel", service)
+	assert.NoError(t, err)
+	job.Wait()
+
+	status := job.Status()
+	assert.Equal(t, JobCompleted, status.State)
+	assert.Equal(t, "FTModel", status.Model)
+	assert.Equal(t, 5, status.Listed)
+	assert.Equal(t, 4, status.Published)
+	assert.Equal(t, 1, status.Failed)
+	assert.Equal(t, []string{"4"}, status.FailedUUIDs)
+	assert.NotNil(t, status.Finished)
+	assert.Equal(t, [][]string{{"1", "2"}, {"3"}, {"4", "5"}}, *batches)
+}
+
+func TestRepublisher_ListingFails(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	service, _ := newListingService(nil, nil)
+	service.listConcepts = func(visit func([]string) error) error {
+		return errors.New("smartlogic is down")
+	}
+
+	job, err := NewRepublisher(2, 0).Start(context.Background(), "FTModel", service)
+	assert.NoError(t, err)
+	job.Wait()
+
+	assert.Equal(t, JobFailed, job.Status().State)
+	assert.Equal(t, "smartlogic is down", job.Status().Error)
+}
+
+func TestRepublisher_CancelAndRestart(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	var pages [][]string
+	for i := 0; i < 100; i++ {
+		pages = append(pages, []string{fmt.Sprintf("uuid%d", i)})
+	}
+	service, _ := newListingService(pages, nil)
+	republisher := NewRepublisher(1, 10*time.Millisecond)
+
+	job, err := republisher.Start(context.Background(), "FTModel", service)
+	assert.NoError(t, err)
+
+	running, err := republisher.Start(context.Background(), "FTModel", service)
+	assert.Equal(t, ErrJobRunning, err)
+	assert.True(t, job == running, "the running job should be returned")
+
+	_, err = republisher.Start(context.Background(), "Locations", service)
+	assert.NoError(t, err, "jobs of different models run independently")
+
+	job.Cancel()
+	job.Wait()
+	status := job.Status()
+	assert.Equal(t, JobCancelled, status.State)
+	assert.False(t, status.Cancelling)
+	assert.True(t, status.Published < 100)
+
+	latest, err := republisher.Job("FTModel")
+	assert.NoError(t, err)
+	assert.True(t, job == latest, "the latest job should be returned")
+
+	restarted, err := republisher.Start(context.Background(), "FTModel", service)
+	assert.NoError(t, err)
+	assert.True(t, job != restarted, "a new job should be started")
+	restarted.Cancel()
+	restarted.Wait()
+
+	_, err = republisher.Job("Unknown")
+	assert.Equal(t, ErrNoJob, err)
+}
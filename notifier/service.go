@@ -1,46 +1,192 @@
 package notifier
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
 	"time"
 
-	"github.com/Financial-Times/kafka-client-go/kafka"
 	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
 	transactionidutils "github.com/Financial-Times/transactionid-utils-go"
 	log "github.com/sirupsen/logrus"
 )
 
 type Servicer interface {
-	GetConcept(uuid string) ([]byte, error)
-	GetChangedConceptList(lastChange time.Time) ([]string, error)
-	Notify(lastChange time.Time, transactionID string) error
-	ForceNotify(UUIDs []string, transactionID string) error
-	CheckKafkaConnectivity() error
+	GetConcept(ctx context.Context, uuid string) ([]byte, error)
+	GetChangedConceptList(ctx context.Context, lastChange time.Time) ([]string, error)
+	GetChangedConcepts(ctx context.Context, lastChange time.Time) ([]smartlogic.ChangedConcept, error)
+	Notify(ctx context.Context, lastChange time.Time, transactionID string) error
+	ForceNotify(ctx context.Context, UUIDs []string, transactionID string) (Report, error)
+	ListConcepts(ctx context.Context, visit func(uuids []string) error) error
+	GetProjection(ctx context.Context, uuid string) (smartlogic.EffectiveProjection, error)
+	// DeadLetters returns the queue of the concepts which failed to be published, or nil if they aren't recorded.
+	DeadLetters() *DeadLetterQueue
+	// Sinks returns the sinks the concepts are published to.
+	Sinks() []Sink
 }
 
+// ErrNoChangedConcepts is returned when Smartlogic returns no changed concepts for a notification, even after waiting.
+var ErrNoChangedConcepts = errors.New("no changed concepts were returned")
+
+// notificationError is the error of a notification which failed for some of its concepts.
+type notificationError struct {
+	msg   string
+	cause error
+	// retryable is set when notifying again may publish the failed concepts, see Service.retryable.
+	retryable bool
+}
+
+func (e *notificationError) Error() string {
+	if e.cause == nil {
+		return e.msg
+	}
+	return e.msg + ": " + e.cause.Error()
+}
+
+func (e *notificationError) Unwrap() error {
+	return e.cause
+}
+
+// retryable tells whether a notification which failed with the error should be notified again as a whole. It isn't
+// when Smartlogic returned no changes, nor when the failed concepts are either retried by the dead letter queue or
+// failed in a way retrying can't fix.
+func retryable(err error) bool {
+	var notificationErr *notificationError
+	if errors.As(err, &notificationErr) {
+		return notificationErr.retryable
+	}
+	return !errors.Is(err, ErrNoChangedConcepts)
+}
+
+// Kafka header telling consumers whether a message carries a concept or announces its deletion.
+const (
+	MessageTypeHeader   = "Message-Type"
+	MessageTypeConcept  = "concept-update"
+	MessageTypeDeletion = "concept-deletion"
+)
+
+// Kafka headers telling consumers how recent a message is, so they can discard a message older than the last one
+// they got for the concept. The version, in nanoseconds since the epoch, increases with each message published.
+// The commit timestamp is the time of the latest Smartlogic change of the concept, when it was notified by a change.
+const (
+	MessageVersionHeader  = "Message-Version"
+	CommitTimestampHeader = "Commit-Timestamp"
+)
+
 type Service struct {
-	kafka      kafka.Producer
-	smartlogic smartlogic.Clienter
+	sink             Sink
+	smartlogic       smartlogic.Clienter
+	parallelism      int
+	publishDeletions bool
+	validator        *Validator
+	cascade          *Cascade
+	hashes           HashStore
+	deadLetters      *DeadLetterQueue
+	versions         *MessageVersions
+}
+
+// WithDeletionEvents makes the service publish a deletion message for the concepts in the change list
+// which no longer exist in Smartlogic.
+func WithDeletionEvents(enabled bool) func(*Service) {
+	return func(s *Service) {
+		s.publishDeletions = enabled
+	}
+}
+
+// WithValidator makes the service validate the concepts before they are published.
+func WithValidator(validator *Validator) func(*Service) {
+	return func(s *Service) {
+		s.validator = validator
+	}
+}
+
+// WithCascade makes the service also notify the concepts related to the notified ones along the relations of the cascade.
+func WithCascade(cascade *Cascade) func(*Service) {
+	return func(s *Service) {
+		s.cascade = cascade
+	}
+}
+
+// WithHashStore makes the service skip publishing the concepts whose payload is unchanged since they were last
+// published, keeping the content hashes of the payloads in the store.
+func WithHashStore(store HashStore) func(*Service) {
+	return func(s *Service) {
+		s.hashes = store
+	}
+}
+
+// WithDeadLetterQueue makes the service record the concepts which fail to be published in the queue, and forget
+// them once they are published.
+func WithDeadLetterQueue(queue *DeadLetterQueue) func(*Service) {
+	return func(s *Service) {
+		s.deadLetters = queue
+	}
+}
+
+// WithMessageVersions sets the versions of the messages. The services of all the models should share them, as a
+// concept may be published by any of them.
+func WithMessageVersions(versions *MessageVersions) func(*Service) {
+	return func(s *Service) {
+		s.versions = versions
+	}
+}
+
+// DefaultParallelism is the number of concepts notified concurrently when none is configured.
+const DefaultParallelism = 1
+
+// WithParallelism sets the number of concepts which are fetched and published concurrently.
+func WithParallelism(parallelism int) func(*Service) {
+	return func(s *Service) {
+		if parallelism > 0 {
+			s.parallelism = parallelism
+		}
+	}
 }
 
-func NewNotifierService(kafka kafka.Producer, smartlogic smartlogic.Clienter) Servicer {
-	return &Service{
-		kafka:      kafka,
-		smartlogic: smartlogic,
+// NewNotifierService creates a service publishing the concepts of the Smartlogic model to the sink.
+func NewNotifierService(sink Sink, smartlogic smartlogic.Clienter, opts ...func(*Service)) Servicer {
+	s := &Service{
+		sink:        sink,
+		smartlogic:  smartlogic,
+		parallelism: DefaultParallelism,
+		versions:    NewMessageVersions(NewMemoryVersionStore()),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *Service) GetConcept(ctx context.Context, uuid string) ([]byte, error) {
+	return s.smartlogic.GetConcept(ctx, uuid)
+}
+
+func (s *Service) GetChangedConceptList(ctx context.Context, lastChange time.Time) (uuids []string, err error) {
+	return s.smartlogic.GetChangedConceptList(ctx, lastChange)
+}
+
+func (s *Service) GetChangedConcepts(ctx context.Context, lastChange time.Time) ([]smartlogic.ChangedConcept, error) {
+	return s.smartlogic.GetChangedConcepts(ctx, lastChange)
+}
+
+func (s *Service) ListConcepts(ctx context.Context, visit func(uuids []string) error) error {
+	return s.smartlogic.ListConcepts(ctx, visit)
 }
 
-func (s *Service) GetConcept(uuid string) ([]byte, error) {
-	return s.smartlogic.GetConcept(uuid)
+func (s *Service) GetProjection(ctx context.Context, uuid string) (smartlogic.EffectiveProjection, error) {
+	return s.smartlogic.GetProjection(ctx, uuid)
 }
 
-func (s *Service) GetChangedConceptList(lastChange time.Time) (uuids []string, err error) {
-	return s.smartlogic.GetChangedConceptList(lastChange)
+func (s *Service) DeadLetters() *DeadLetterQueue {
+	return s.deadLetters
 }
 
-func (s *Service) Notify(lastChange time.Time, transactionID string) error {
-	changedConcepts, err := s.smartlogic.GetChangedConceptList(lastChange)
+func (s *Service) Notify(ctx context.Context, lastChange time.Time, transactionID string) error {
+	changedConcepts, err := s.smartlogic.GetChangedConcepts(ctx, lastChange)
 	if err != nil {
 		return fmt.Errorf("failed to fetch the list of changed concepts: %w", err)
 	}
@@ -48,58 +194,367 @@ func (s *Service) Notify(lastChange time.Time, transactionID string) error {
 	if len(changedConcepts) == 0 {
 		// After some time interval retry getting the changed concept list,
 		// because Smartlogic sometimes notify us before the data is available to be retrieved.
-		time.Sleep(time.Second * 5)
-		changedConcepts, err = s.smartlogic.GetChangedConceptList(lastChange)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second * 5):
+		}
+		changedConcepts, err = s.smartlogic.GetChangedConcepts(ctx, lastChange)
 		if err != nil {
 			return fmt.Errorf("failed while retrying to fetch the list of changed concepts: %w", err)
 		}
 	}
 
 	if len(changedConcepts) == 0 {
-		return fmt.Errorf("no changed concepts since %v were returned for transaction id %s", lastChange, transactionID)
+		return fmt.Errorf("%w since %v for transaction id %s", ErrNoChangedConcepts, lastChange, transactionID)
 	}
 
-	return s.ForceNotify(changedConcepts, transactionID)
+	uuids := make([]string, 0, len(changedConcepts))
+	changes := map[string]smartlogic.ChangedConcept{}
+	for _, c := range changedConcepts {
+		uuids = append(uuids, c.UUID)
+		changes[c.UUID] = c
+	}
+	_, err = s.notify(ctx, uuids, transactionID, changes)
+	return err
 }
 
-func (s *Service) ForceNotify(UUIDs []string, transactionID string) error {
-	errorMap := map[string]error{}
+// ForceNotify fetches and publishes the concepts with the given UUIDs, and the concepts related to them when the
+// service cascades. When the context is done, the concepts not notified yet are reported as failed.
+func (s *Service) ForceNotify(ctx context.Context, UUIDs []string, transactionID string) (Report, error) {
+	return s.notify(ctx, UUIDs, transactionID, nil)
+}
 
-	for _, conceptUUID := range UUIDs {
-		concept, err := s.smartlogic.GetConcept(conceptUUID)
-		if err != nil {
-			errorMap[conceptUUID] = err
+// notify fetches and publishes the concepts with the given UUIDs, then cascades to their related concepts.
+// Only the concepts with a change in changes are known to have existed, so only for them a deletion message
+// is published when they no longer exist.
+func (s *Service) notify(ctx context.Context, UUIDs []string, transactionID string, changes map[string]smartlogic.ChangedConcept) (Report, error) {
+	outcomes, causes := s.notifyAll(ctx, UUIDs, transactionID, changes)
+	report := Report{Concepts: outcomes}
+	if s.cascade != nil && cascades(ctx) {
+		outcomes, cascadeCauses := s.notifyCascade(ctx, UUIDs, outcomes, transactionID)
+		report.Concepts = append(report.Concepts, outcomes...)
+		causes = append(causes, cascadeCauses...)
+	}
+	if s.deadLetters != nil {
+		s.deadLetters.record(report.Concepts, causes, transactionID)
+	}
+
+	if failed := report.Failed(); len(failed) > 0 {
+		errorMsg := fmt.Sprintf("There was an error with %d concept ingestions", len(failed))
+		log.WithField("failed", failed).Error(errorMsg)
+		return report, &notificationError{msg: errorMsg, cause: failureCause(causes), retryable: s.retryable(report.Concepts, causes)}
+	}
+	if len(UUIDs) > 0 {
+		log.WithField("uuids", UUIDs).Info("Completed notification of concepts")
+	}
+	return report, nil
+}
+
+// retryable tells whether some of the failed concepts may be published by notifying them again: the ones abandoned with
+// the notification, and, when there is no dead letter queue retrying them, the ones which didn't fail terminally.
+func (s *Service) retryable(outcomes []ConceptOutcome, causes []error) bool {
+	for i, outcome := range outcomes {
+		if outcome.Status != StatusFailed {
 			continue
 		}
+		var cause error
+		if i < len(causes) {
+			cause = causes[i]
+		}
+		if abandoned(cause) || (s.deadLetters == nil && !terminal(cause)) {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyCascade notifies the concepts related to the published ones, one relation further at a time, up to the depth
+// of the cascade. Each concept is notified at most once, so the concepts already notified are skipped. The related
+// concepts are published even when their own payload is unchanged, as downstream denormalises the published ones into
+// them.
+func (s *Service) notifyCascade(ctx context.Context, UUIDs []string, outcomes []ConceptOutcome, transactionID string) ([]ConceptOutcome, []error) {
+	notified := map[string]bool{}
+	for _, conceptUUID := range UUIDs {
+		notified[conceptUUID] = true
+	}
+
+	ctx = WithoutDeduplication(ctx)
+	var cascaded []ConceptOutcome
+	var causes []error
+	wave := outcomes
+	for depth := 1; depth <= s.cascade.maxDepth; depth++ {
+		var related, from []string
+		for i := range wave {
+			for _, conceptUUID := range wave[i].related {
+				if notified[conceptUUID] {
+					continue
+				}
+				notified[conceptUUID] = true
+				related = append(related, conceptUUID)
+				from = append(from, wave[i].UUID)
+			}
+			wave[i].related = nil
+		}
+		if len(related) == 0 {
+			return cascaded, causes
+		}
+
+		log.WithField("request_transaction_id", transactionID).WithField("uuids", related).WithField("depth", depth).
+			Info("Cascading the notification to the related concepts")
+		var waveCauses []error
+		wave, waveCauses = s.notifyAll(ctx, related, transactionID, nil)
+		for i := range wave {
+			wave[i].CascadedFrom = from[i]
+		}
+		cascaded = append(cascaded, wave...)
+		causes = append(causes, waveCauses...)
+	}
+	for i := range cascaded {
+		cascaded[i].related = nil
+	}
+	return cascaded, causes
+}
+
+// notifyAll fetches and publishes the concepts with the given UUIDs concurrently. It returns the outcome of each
+// concept and the cause of its failure, if it failed, in the order of the UUIDs.
+func (s *Service) notifyAll(ctx context.Context, UUIDs []string, transactionID string, changes map[string]smartlogic.ChangedConcept) ([]ConceptOutcome, []error) {
+	outcomes := make([]ConceptOutcome, len(UUIDs))
+	causes := make([]error, len(UUIDs))
+
+	workers := s.parallelism
+	if workers > len(UUIDs) {
+		workers = len(UUIDs)
+	}
+	// Every UUID is always handled by the same worker, so the notifications of a concept are published in the requested order.
+	queues := make([]chan int, workers)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan int, len(UUIDs))
+		wg.Add(1)
+		go func(queue chan int) {
+			defer wg.Done()
+			for idx := range queue {
+				change, changed := changes[UUIDs[idx]]
+				outcomes[idx], causes[idx] = s.notifyConcept(ctx, UUIDs[idx], transactionID, change, changed)
+			}
+		}(queues[i])
+	}
+	for idx, conceptUUID := range UUIDs {
+		queues[workerFor(conceptUUID, workers)] <- idx
+	}
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+	return outcomes, causes
+}
 
-		newTransactionID := transactionidutils.NewTransactionID()
+// failureCause returns the cause the notification failed because of: a failure of Smartlogic, rather than some of
+// the concepts missing, or else a concept blocked by validation. It returns nil when the concepts failed for other reasons.
+func failureCause(causes []error) error {
+	var invalid error
+	for _, cause := range causes {
+		if code := smartlogic.ErrorCode(cause); code != "" && code != smartlogic.CodeConceptNotFound {
+			return cause
+		}
+		if invalid == nil && errors.Is(cause, ErrInvalidConcept) {
+			invalid = cause
+		}
+	}
+	return invalid
+}
 
-		message := kafka.NewFTMessage(map[string]string{
-			transactionidutils.TransactionIDHeader: newTransactionID,
-		}, string(concept))
+// notifyConcept publishes the concept with the given UUID. When it fails, it also returns the cause of the failure.
+func (s *Service) notifyConcept(ctx context.Context, conceptUUID string, transactionID string, change smartlogic.ChangedConcept, changed bool) (ConceptOutcome, error) {
+	outcome := ConceptOutcome{UUID: conceptUUID, Status: StatusFailed}
+	if err := ctx.Err(); err != nil {
+		return outcome.failed(err)
+	}
 
-		log.WithFields(log.Fields{
-			"request_transaction_id": transactionID,
-			"concept_transaction_id": newTransactionID,
-			"concept_uuid":           conceptUUID,
-		}).Info("Sending message to Kafka")
-		err = s.kafka.SendMessage(message)
+	concept, namespace, err := s.getConcept(ctx, conceptUUID, change, changed)
+	if errors.Is(err, smartlogic.ErrorConceptDoesNotExist) && changed && s.publishDeletions {
+		return s.publishDeletion(ctx, change, transactionID)
+	}
+	if err != nil {
+		return outcome.failed(err)
+	}
+	outcome.Namespace = namespace.Prefix
+
+	if s.validator != nil {
+		outcome.Violations, err = s.validator.Validate(ctx, s.smartlogic, concept)
 		if err != nil {
-			errorMap[conceptUUID] = err
+			return outcome.failed(err)
+		}
+		logViolations(conceptUUID, transactionID, outcome.Violations)
+		if err := blockingError(outcome.Violations); err != nil {
+			return outcome.failed(err)
 		}
 	}
 
-	if len(errorMap) > 0 {
-		errorMsg := fmt.Sprintf("There was an error with %d concept ingestions", len(errorMap))
-		log.WithField("errorMap", errorMap).Error(errorMsg)
-		return errors.New(errorMsg)
+	var hash string
+	if s.hashes != nil {
+		hash = contentHash(concept.Raw)
+		if deduplicates(ctx) && s.unchanged(conceptUUID, hash) {
+			log.WithField("request_transaction_id", transactionID).WithField("concept_uuid", conceptUUID).
+				Info("Skipping the concept, which is unchanged since it was last published")
+			outcome.Status = StatusUnchanged
+			return outcome, nil
+		}
 	}
-	if len(UUIDs) > 0 {
-		log.WithField("uuids", UUIDs).Info("Completed notification of concepts")
+
+	newTransactionID := transactionidutils.NewTransactionID()
+
+	message := Message{
+		Topic:   namespace.Topic,
+		Key:     conceptUUID,
+		Headers: messageHeaders(newTransactionID, MessageTypeConcept, change, changed),
+		Body:    string(concept.Raw),
+	}
+
+	log.WithFields(log.Fields{
+		"request_transaction_id": transactionID,
+		"concept_transaction_id": newTransactionID,
+		"concept_uuid":           conceptUUID,
+		"concept_namespace":      namespace.Prefix,
+	}).Infof("Sending message to %s", s.sink.Name())
+	err = s.publish(ctx, message, change, changed)
+	if err != nil {
+		return outcome.failed(err)
+	}
+	outcome.Status = StatusPublished
+	if s.hashes != nil {
+		if err := s.hashes.Put(conceptUUID, hash); err != nil {
+			log.WithError(err).WithField("concept_uuid", conceptUUID).Warn("Failed to store the content hash of the concept")
+		}
+	}
+	if s.cascade != nil && cascades(ctx) {
+		outcome.related = s.cascade.related(concept)
+	}
+	return outcome, nil
+}
+
+// getConcept gets the concept from Smartlogic. A changed concept is got in the namespace of its change, while the
+// other concepts, known only by their UUID, are looked up in each namespace until they are found.
+func (s *Service) getConcept(ctx context.Context, conceptUUID string, change smartlogic.ChangedConcept, changed bool) (*smartlogic.Concept, smartlogic.Namespace, error) {
+	if !changed || change.Namespace.Prefix == "" {
+		return s.smartlogic.ResolveConcept(ctx, conceptUUID)
+	}
+	concept, err := s.smartlogic.GetConceptInNamespace(ctx, change.Namespace, conceptUUID)
+	if err != nil {
+		return nil, smartlogic.Namespace{}, err
+	}
+	return concept, change.Namespace, nil
+}
+
+// deletionMessage is the body of the message announcing the deletion of a concept.
+type deletionMessage struct {
+	UUID      string    `json:"uuid"`
+	URI       string    `json:"uri"`
+	Deleted   bool      `json:"deleted"`
+	Committed time.Time `json:"committed"`
+}
+
+func (s *Service) publishDeletion(ctx context.Context, change smartlogic.ChangedConcept, transactionID string) (ConceptOutcome, error) {
+	outcome := ConceptOutcome{UUID: change.UUID, Status: StatusFailed, Namespace: change.Namespace.Prefix}
+
+	body, err := json.Marshal(deletionMessage{UUID: change.UUID, URI: change.URI, Deleted: true, Committed: change.Committed})
+	if err != nil {
+		return outcome.failed(err)
 	}
-	return nil
+
+	newTransactionID := transactionidutils.NewTransactionID()
+	message := Message{
+		Topic:   change.Namespace.Topic,
+		Key:     change.UUID,
+		Headers: messageHeaders(newTransactionID, MessageTypeDeletion, change, true),
+		Body:    string(body),
+	}
+
+	log.WithFields(log.Fields{
+		"request_transaction_id": transactionID,
+		"concept_transaction_id": newTransactionID,
+		"concept_uuid":           change.UUID,
+		"concept_namespace":      change.Namespace.Prefix,
+	}).Infof("Sending deletion message to %s", s.sink.Name())
+	if err := s.publish(ctx, message, change, true); err != nil {
+		return outcome.failed(err)
+	}
+	outcome.Status = StatusDeleted
+	// The concept is published again if it is ever restored, whatever its payload.
+	if s.hashes != nil {
+		if err := s.hashes.Delete(change.UUID); err != nil {
+			log.WithError(err).WithField("concept_uuid", change.UUID).Warn("Failed to delete the content hash of the concept")
+		}
+	}
+	return outcome, nil
 }
 
-func (s *Service) CheckKafkaConnectivity() error {
-	return s.kafka.ConnectivityCheck()
+// messageHeaders returns the headers of a message of the given type, but its version, which is set when it is published.
+func messageHeaders(transactionID string, messageType string, change smartlogic.ChangedConcept, changed bool) map[string]string {
+	headers := map[string]string{
+		transactionidutils.TransactionIDHeader: transactionID,
+		MessageTypeHeader:                      messageType,
+	}
+	if changed && !change.Committed.IsZero() {
+		headers[CommitTimestampHeader] = change.Committed.UTC().Format(time.RFC3339Nano)
+	}
+	return headers
+}
+
+// publish sets the version of the message and publishes it to the sink. The messages of a concept are versioned and
+// published one at a time, in the order they are built, as they are all built by the same worker.
+func (s *Service) publish(ctx context.Context, message Message, change smartlogic.ChangedConcept, changed bool) error {
+	var committed time.Time
+	if changed {
+		committed = change.Committed
+	}
+	return s.versions.publish(message.Key, committed, func(version int64) error {
+		message.Headers[MessageVersionHeader] = strconv.FormatInt(version, 10)
+		return sendMessage(ctx, s.sink, message)
+	})
+}
+
+// unchanged returns whether the hash is the one of the payload last published for the concept. When the hash store
+// fails, the concept is deemed changed, as publishing it again is harmless.
+func (s *Service) unchanged(conceptUUID string, hash string) bool {
+	previous, ok, err := s.hashes.Get(conceptUUID)
+	if err != nil {
+		log.WithError(err).WithField("concept_uuid", conceptUUID).Warn("Failed to get the content hash of the concept")
+		return false
+	}
+	return ok && previous == hash
+}
+
+// sendMessage publishes the message to the sink unless the context is done first. As the sinks can't abort a publish,
+// the message may still be delivered after the context error is returned.
+func sendMessage(ctx context.Context, sink Sink, message Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- sink.Publish(message)
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// workerFor returns the index of the worker the concept with the given UUID is assigned to.
+func workerFor(conceptUUID string, workers int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(conceptUUID))
+	return int(h.Sum32() % uint32(workers))
+}
+
+// Sinks returns the sink of the service, or the sinks it fans out to.
+func (s *Service) Sinks() []Sink {
+	if fanOut, ok := s.sink.(*FanOutSink); ok {
+		return fanOut.Sinks()
+	}
+	return []Sink{s.sink}
 }
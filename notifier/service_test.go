@@ -1,9 +1,18 @@
 package notifier
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/Financial-Times/kafka-client-go/kafka"
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -11,7 +20,7 @@ func TestNewNotifierService(t *testing.T) {
 	kc := &mockKafkaClient{}
 	sl := &mockSmartlogicClient{}
 
-	service := NewNotifierService(kc, sl)
+	service := NewNotifierService(NewKafkaSink(kc), sl)
 	assert.IsType(t, &Service{}, service)
 }
 
@@ -27,9 +36,9 @@ func TestService_GetConcept(t *testing.T) {
 		},
 	}
 
-	service := NewNotifierService(kc, sl)
+	service := NewNotifierService(NewKafkaSink(kc), sl)
 
-	concept, err := service.GetConcept("uuid2")
+	concept, err := service.GetConcept(context.Background(), "uuid2")
 	assert.NoError(t, err)
 	assert.EqualValues(t, "concept2", string(concept))
 }
@@ -46,14 +55,41 @@ func TestService_Notify(t *testing.T) {
 		},
 	}
 
-	service := NewNotifierService(kc, sl)
+	service := NewNotifierService(NewKafkaSink(kc), sl)
 
-	err := service.Notify(time.Now(), "transactionID")
+	err := service.Notify(context.Background(), time.Now(), "transactionID")
 
 	assert.NoError(t, err)
 	assert.Equal(t, 1, kc.sentCount)
 }
 
+func TestService_Notify_ChangeNamespace(t *testing.T) {
+	locations := smartlogic.Namespace{Prefix: "http://www.ft.com/ontology/managedlocation/", Kind: "managedlocation", Topic: "Locations"}
+	var fetched []smartlogic.Namespace
+	sl := &mockSmartlogicClient{
+		getChangedConceptsFunc: func(changeDate time.Time) ([]smartlogic.ChangedConcept, error) {
+			return []smartlogic.ChangedConcept{{UUID: "uuid1", ChangeType: smartlogic.ChangeTypeUpdated, Namespace: locations}}, nil
+		},
+		resolveConceptFunc: func(uuid string) (*smartlogic.Concept, smartlogic.Namespace, error) {
+			t.Errorf("the changed concept %s shouldn't be looked up in every namespace", uuid)
+			return nil, smartlogic.Namespace{}, smartlogic.ErrorConceptDoesNotExist
+		},
+		getConceptInNamespaceFunc: func(ns smartlogic.Namespace, uuid string) (*smartlogic.Concept, error) {
+			fetched = append(fetched, ns)
+			return &smartlogic.Concept{UUID: uuid, Raw: []byte("location1")}, nil
+		},
+	}
+	sink := &mockSink{}
+	service := NewNotifierService(sink, sl)
+
+	err := service.Notify(context.Background(), time.Now(), "transactionID")
+	assert.NoError(t, err)
+	assert.Equal(t, []smartlogic.Namespace{locations}, fetched)
+	published := sink.getPublished()
+	assert.Len(t, published, 1)
+	assert.Equal(t, "Locations", published[0].Topic)
+}
+
 func TestService_RetryNotify(t *testing.T) {
 	var isGetFuncCalled bool
 	kc := &mockKafkaClient{}
@@ -72,9 +108,9 @@ func TestService_RetryNotify(t *testing.T) {
 		},
 	}
 
-	service := NewNotifierService(kc, sl)
+	service := NewNotifierService(NewKafkaSink(kc), sl)
 
-	err := service.Notify(time.Now(), "transactionID")
+	err := service.Notify(context.Background(), time.Now(), "transactionID")
 
 	assert.NoError(t, err)
 	assert.Equal(t, 1, kc.sentCount)
@@ -92,10 +128,537 @@ func TestService_ForceNotify(t *testing.T) {
 		},
 	}
 
-	service := NewNotifierService(kc, sl)
+	service := NewNotifierService(NewKafkaSink(kc), sl)
 
-	err := service.ForceNotify([]string{"uuid1"}, "transactionID")
+	report, err := service.ForceNotify(context.Background(), []string{"uuid1"}, "transactionID")
 
 	assert.NoError(t, err)
 	assert.Equal(t, 1, kc.sentCount)
+	assert.Equal(t, []ConceptOutcome{{UUID: "uuid1", Status: StatusPublished}}, report.Concepts)
+}
+
+func TestService_ForceNotify_NamespaceTopic(t *testing.T) {
+	kc := &mockKafkaClient{}
+	locationsKafka := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		concepts: map[string]string{
+			"uuid1": "concept1",
+			"uuid2": "location2",
+			"uuid3": "other3",
+		},
+		namespaces: map[string]smartlogic.Namespace{
+			"uuid2": {Prefix: "http://www.ft.com/ontology/managedlocation/", Topic: "Locations"},
+			"uuid3": {Prefix: "http://www.ft.com/other/", Topic: "Unknown"},
+		},
+	}
+
+	service := NewNotifierService(NewKafkaSink(kc, WithTopicProducers(map[string]kafka.Producer{"Locations": locationsKafka})), sl)
+
+	_, err := service.ForceNotify(context.Background(), []string{"uuid1", "uuid2"}, "transactionID")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, kc.getSentCount())
+	assert.Equal(t, 1, locationsKafka.getSentCount())
+
+	_, err = service.ForceNotify(context.Background(), []string{"uuid3"}, "transactionID")
+	assert.Error(t, err, "concepts of namespaces without a producer can't be published")
+}
+
+func TestService_ForceNotify_Parallel(t *testing.T) {
+	kc := &mockKafkaClient{}
+	concepts := map[string]string{}
+	var uuids []string
+	for i := 0; i < 50; i++ {
+		uuid := fmt.Sprintf("uuid%d", i)
+		concepts[uuid] = "concept" + uuid
+		uuids = append(uuids, uuid)
+	}
+	sl := &mockSmartlogicClient{concepts: concepts}
+
+	service := NewNotifierService(NewKafkaSink(kc), sl, WithParallelism(8))
+
+	report, err := service.ForceNotify(context.Background(), append(uuids, "missing"), "transactionID")
+	assert.EqualError(t, err, "There was an error with 1 concept ingestions")
+	assert.Equal(t, 50, kc.getSentCount())
+	assert.Equal(t, 50, report.Published())
+	assert.Len(t, report.Concepts, 51)
+	for i, uuid := range uuids {
+		assert.Equal(t, ConceptOutcome{UUID: uuid, Status: StatusPublished}, report.Concepts[i])
+	}
+	assert.Equal(t, []ConceptOutcome{{UUID: "missing", Status: StatusFailed, Error: "can't find concept"}}, report.Failed())
+}
+
+func TestService_ForceNotify_PreservesOrderPerConcept(t *testing.T) {
+	kc := &mockKafkaClient{}
+	var mu sync.Mutex
+	versions := map[string]int{}
+	sl := &mockSmartlogicClient{
+		resolveConceptFunc: func(uuid string) (*smartlogic.Concept, smartlogic.Namespace, error) {
+			mu.Lock()
+			versions[uuid]++
+			version := versions[uuid]
+			mu.Unlock()
+			// give the other workers the chance to overtake
+			time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+			return &smartlogic.Concept{UUID: uuid, Raw: []byte(fmt.Sprintf("%s-%d", uuid, version))}, smartlogic.Namespace{}, nil
+		},
+	}
+
+	service := NewNotifierService(NewKafkaSink(kc), sl, WithParallelism(4))
+
+	uuids := []string{"uuid1", "uuid2", "uuid1", "uuid3", "uuid1", "uuid2", "uuid4", "uuid1"}
+	_, err := service.ForceNotify(context.Background(), uuids, "transactionID")
+	assert.NoError(t, err)
+
+	var sent []string
+	for _, body := range kc.getSent() {
+		if strings.HasPrefix(body, "uuid1-") {
+			sent = append(sent, body)
+		}
+	}
+	assert.Equal(t, []string{"uuid1-1", "uuid1-2", "uuid1-3", "uuid1-4"}, sent)
+	assert.Len(t, kc.getSent(), len(uuids))
+}
+
+func TestService_Notify_Deletions(t *testing.T) {
+	committed := time.Date(2020, 4, 27, 10, 0, 0, 0, time.UTC)
+	newSmartlogic := func() *mockSmartlogicClient {
+		return &mockSmartlogicClient{
+			getChangedConceptsFunc: func(changeDate time.Time) ([]smartlogic.ChangedConcept, error) {
+				return []smartlogic.ChangedConcept{
+					{UUID: "uuid1", URI: "http://www.ft.com/thing/uuid1", ChangeType: smartlogic.ChangeTypeUpdated},
+					{UUID: "uuid2", URI: "http://www.ft.com/thing/uuid2", ChangeType: smartlogic.ChangeTypeDeleted, Committed: committed},
+				}, nil
+			},
+			resolveConceptFunc: func(uuid string) (*smartlogic.Concept, smartlogic.Namespace, error) {
+				if uuid == "uuid1" {
+					return &smartlogic.Concept{UUID: uuid, Raw: []byte("concept1")}, smartlogic.Namespace{}, nil
+				}
+				return nil, smartlogic.Namespace{}, smartlogic.ErrorConceptDoesNotExist
+			},
+		}
+	}
+
+	t.Run("Enabled", func(t *testing.T) {
+		kc := &mockKafkaClient{}
+		service := NewNotifierService(NewKafkaSink(kc), newSmartlogic(), WithDeletionEvents(true))
+
+		err := service.Notify(context.Background(), time.Now(), "transactionID")
+		assert.NoError(t, err)
+
+		messages := kc.getSentMessages()
+		assert.Len(t, messages, 2)
+		types := map[string]string{}
+		for _, m := range messages {
+			types[m.Body] = m.Headers[MessageTypeHeader]
+		}
+		assert.Equal(t, MessageTypeConcept, types["concept1"])
+		assert.Equal(t, MessageTypeDeletion, types[`{"uuid":"uuid2","uri":"http://www.ft.com/thing/uuid2","deleted":true,"committed":"2020-04-27T10:00:00Z"}`])
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		kc := &mockKafkaClient{}
+		service := NewNotifierService(NewKafkaSink(kc), newSmartlogic())
+
+		err := service.Notify(context.Background(), time.Now(), "transactionID")
+		assert.EqualError(t, err, "There was an error with 1 concept ingestions")
+		assert.Equal(t, 1, kc.getSentCount())
+	})
+
+	t.Run("Force notify", func(t *testing.T) {
+		kc := &mockKafkaClient{}
+		service := NewNotifierService(NewKafkaSink(kc), newSmartlogic(), WithDeletionEvents(true))
+
+		report, err := service.ForceNotify(context.Background(), []string{"uuid2"}, "transactionID")
+		assert.Error(t, err, "concepts which are not in the change list are never reported as deleted")
+		assert.Equal(t, StatusFailed, report.Concepts[0].Status)
+		assert.Equal(t, 0, kc.getSentCount())
+	})
+}
+
+func TestService_Notify_KeysAndVersions(t *testing.T) {
+	committed := time.Date(2020, 4, 27, 10, 0, 0, 0, time.UTC)
+	sl := &mockSmartlogicClient{
+		getChangedConceptsFunc: func(changeDate time.Time) ([]smartlogic.ChangedConcept, error) {
+			return []smartlogic.ChangedConcept{
+				{UUID: "uuid1", URI: "http://www.ft.com/thing/uuid1", ChangeType: smartlogic.ChangeTypeUpdated, Committed: committed},
+				{UUID: "uuid2", URI: "http://www.ft.com/thing/uuid2", ChangeType: smartlogic.ChangeTypeDeleted, Committed: committed},
+			}, nil
+		},
+		resolveConceptFunc: func(uuid string) (*smartlogic.Concept, smartlogic.Namespace, error) {
+			if uuid == "uuid1" {
+				return &smartlogic.Concept{UUID: uuid, Raw: []byte("concept1")}, smartlogic.Namespace{}, nil
+			}
+			return nil, smartlogic.Namespace{}, smartlogic.ErrorConceptDoesNotExist
+		},
+	}
+	sink := &mockSink{}
+	service := NewNotifierService(sink, sl, WithDeletionEvents(true))
+
+	assert.NoError(t, service.Notify(context.Background(), time.Now(), "transactionID"))
+	_, err := service.ForceNotify(context.Background(), []string{"uuid1"}, "transactionID")
+	assert.NoError(t, err)
+
+	messages := sink.getPublished()
+	assert.Len(t, messages, 3)
+	versions := map[string][]int64{}
+	for _, m := range messages {
+		version, err := strconv.ParseInt(m.Headers[MessageVersionHeader], 10, 64)
+		assert.NoError(t, err)
+		versions[m.Key] = append(versions[m.Key], version)
+		if len(versions[m.Key]) == 1 {
+			assert.Equal(t, "2020-04-27T10:00:00Z", m.Headers[CommitTimestampHeader], "the notified changes should carry their commit timestamp")
+		}
+	}
+	assert.Len(t, versions["uuid1"], 2)
+	assert.Len(t, versions["uuid2"], 1)
+	assert.True(t, versions["uuid1"][0] < versions["uuid1"][1], "the versions of a concept should increase")
+	assert.NotContains(t, messages[2].Headers, CommitTimestampHeader, "the concepts notified by force have no known commit")
+}
+
+func TestService_ForceNotify_Cancelled(t *testing.T) {
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{concepts: map[string]string{"uuid1": "concept1", "uuid2": "concept2"}}
+	service := NewNotifierService(NewKafkaSink(kc), sl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err := service.ForceNotify(ctx, []string{"uuid1", "uuid2"}, "transactionID")
+	assert.Error(t, err)
+	assert.Len(t, report.Failed(), 2)
+	assert.Equal(t, context.Canceled.Error(), report.Concepts[0].Error)
+	assert.Equal(t, 0, kc.getSentCount())
+}
+
+func TestService_Notify_CancelledWhileRetrying(t *testing.T) {
+	sl := &mockSmartlogicClient{
+		getChangedConceptListFunc: func(changeDate time.Time) ([]string, error) {
+			return nil, nil
+		},
+	}
+	service := NewNotifierService(NewKafkaSink(&mockKafkaClient{}), sl)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := service.Notify(ctx, time.Now(), "transactionID")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 1, sl.getChangedConceptListCallCount())
+}
+
+type blockingProducer struct {
+	mockKafkaClient
+	release chan struct{}
+}
+
+func (p *blockingProducer) SendMessage(message kafka.FTMessage) error {
+	<-p.release
+	return p.mockKafkaClient.SendMessage(message)
+}
+
+func TestSendMessage_Cancelled(t *testing.T) {
+	producer := &blockingProducer{release: make(chan struct{})}
+	defer close(producer.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := sendMessage(ctx, NewKafkaSink(producer), Message{Body: "concept"})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestService_ForceNotify_CircuitOpen(t *testing.T) {
+	sl := &mockSmartlogicClient{
+		concepts: map[string]string{"uuid1": "concept1"},
+		resolveConceptFunc: func(uuid string) (*smartlogic.Concept, smartlogic.Namespace, error) {
+			if uuid == "uuid1" {
+				return &smartlogic.Concept{UUID: uuid, Raw: []byte("concept1")}, smartlogic.Namespace{}, nil
+			}
+			return nil, smartlogic.Namespace{}, smartlogic.ErrCircuitOpen
+		},
+	}
+	service := NewNotifierService(NewKafkaSink(&mockKafkaClient{}), sl)
+
+	report, err := service.ForceNotify(context.Background(), []string{"uuid1", "uuid2"}, "transactionID")
+	assert.True(t, errors.Is(err, smartlogic.ErrCircuitOpen))
+	assert.Equal(t, 1, report.Published())
+	assert.Equal(t, []ConceptOutcome{{UUID: "uuid2", Status: StatusFailed, Error: smartlogic.ErrCircuitOpen.Error()}}, report.Failed())
+}
+
+func TestService_ForceNotify_Validation(t *testing.T) {
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		resolveConceptFunc: func(uuid string) (*smartlogic.Concept, smartlogic.Namespace, error) {
+			concept := &smartlogic.Concept{UUID: uuid, Raw: []byte(uuid)}
+			if uuid == "labelled" {
+				concept.PrefLabels = []smartlogic.Literal{{Value: "label"}}
+			}
+			return concept, smartlogic.Namespace{}, nil
+		},
+	}
+	validator := NewValidator([]ValidationRule{
+		{Name: "label", Check: CheckPrefLabel, Severity: SeverityBlock},
+		{Name: "type", Check: CheckType, Severity: SeverityWarn},
+	}, nil)
+	service := NewNotifierService(NewKafkaSink(kc), sl, WithValidator(validator))
+
+	report, err := service.ForceNotify(context.Background(), []string{"labelled", "unlabelled"}, "transactionID")
+	assert.True(t, errors.Is(err, ErrInvalidConcept))
+	assert.Equal(t, []string{"labelled"}, kc.getSent(), "only the concepts passing the blocking rules should be published")
+	assert.Equal(t, []ConceptOutcome{
+		{
+			UUID:       "labelled",
+			Status:     StatusPublished,
+			Violations: []Violation{{Rule: "type", Severity: SeverityWarn, Message: "the concept has no type"}},
+		},
+		{
+			UUID:   "unlabelled",
+			Status: StatusFailed,
+			Error:  "concept failed validation: the concept has no prefLabel",
+			Violations: []Violation{
+				{Rule: "label", Severity: SeverityBlock, Message: "the concept has no prefLabel"},
+				{Rule: "type", Severity: SeverityWarn, Message: "the concept has no type"},
+			},
+		},
+	}, report.Concepts)
+}
+
+func TestService_ForceNotify_Cascade(t *testing.T) {
+	subBrands := map[string][]string{
+		"brand":         {"sub-brand-1", "sub-brand-2"},
+		"sub-brand-1":   {"sub-sub-brand", "brand"},
+		"sub-brand-2":   {"sub-brand-1", "missing"},
+		"sub-sub-brand": {"too-deep"},
+	}
+	sl := &mockSmartlogicClient{
+		resolveConceptFunc: func(uuid string) (*smartlogic.Concept, smartlogic.Namespace, error) {
+			if uuid == "missing" {
+				return nil, smartlogic.Namespace{}, smartlogic.ErrorConceptDoesNotExist
+			}
+			concept := &smartlogic.Concept{UUID: uuid, Raw: []byte(uuid), Relations: map[string][]string{}}
+			for _, sub := range subBrands[uuid] {
+				concept.Relations["hasSubBrand"] = append(concept.Relations["hasSubBrand"], "http://www.ft.com/thing/"+sub)
+			}
+			return concept, smartlogic.Namespace{}, nil
+		},
+	}
+	namespaces, err := smartlogic.NewNamespaceRegistry(smartlogic.DefaultNamespaces()...)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name             string
+		uuids            []string
+		depth            int
+		expectedOutcomes []ConceptOutcome
+	}{
+		{
+			name:  "Depth",
+			uuids: []string{"brand"},
+			depth: 2,
+			expectedOutcomes: []ConceptOutcome{
+				{UUID: "brand", Status: StatusPublished},
+				{UUID: "sub-brand-1", Status: StatusPublished, CascadedFrom: "brand"},
+				{UUID: "sub-brand-2", Status: StatusPublished, CascadedFrom: "brand"},
+				{UUID: "sub-sub-brand", Status: StatusPublished, CascadedFrom: "sub-brand-1"},
+				{UUID: "missing", Status: StatusFailed, Error: "concept does not exist", CascadedFrom: "sub-brand-2"},
+			},
+		},
+		{
+			name:  "Requested concepts aren't cascaded to",
+			uuids: []string{"brand", "sub-brand-2"},
+			depth: 1,
+			expectedOutcomes: []ConceptOutcome{
+				{UUID: "brand", Status: StatusPublished},
+				{UUID: "sub-brand-2", Status: StatusPublished},
+				{UUID: "sub-brand-1", Status: StatusPublished, CascadedFrom: "brand"},
+				{UUID: "missing", Status: StatusFailed, Error: "concept does not exist", CascadedFrom: "sub-brand-2"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kc := &mockKafkaClient{}
+			service := NewNotifierService(NewKafkaSink(kc), sl, WithParallelism(2), WithCascade(NewCascade([]string{"hasSubBrand"}, test.depth, namespaces)))
+
+			report, err := service.ForceNotify(context.Background(), test.uuids, "transactionID")
+			assert.Error(t, err, "the cascaded concepts which fail should fail the notification")
+			assert.Equal(t, test.expectedOutcomes, report.Concepts)
+			assert.Equal(t, report.Published(), len(kc.getSent()))
+		})
+	}
+}
+
+func TestService_Notify_Cascade(t *testing.T) {
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{
+		getChangedConceptListFunc: func(changeDate time.Time) ([]string, error) {
+			return []string{"brand"}, nil
+		},
+		resolveConceptFunc: func(uuid string) (*smartlogic.Concept, smartlogic.Namespace, error) {
+			concept := &smartlogic.Concept{UUID: uuid, Raw: []byte(uuid)}
+			if uuid == "brand" {
+				concept.Relations = map[string][]string{"hasSubBrand": {"http://www.ft.com/thing/sub-brand"}}
+			}
+			return concept, smartlogic.Namespace{}, nil
+		},
+	}
+	namespaces, err := smartlogic.NewNamespaceRegistry(smartlogic.DefaultNamespaces()...)
+	assert.NoError(t, err)
+	service := NewNotifierService(NewKafkaSink(kc), sl, WithCascade(NewCascade([]string{"hasSubBrand"}, 1, namespaces)))
+
+	err = service.Notify(context.Background(), time.Now(), "transactionID")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"brand", "sub-brand"}, kc.getSent())
+
+	report, err := service.ForceNotify(WithoutCascade(context.Background()), []string{"brand"}, "transactionID")
+	assert.NoError(t, err)
+	assert.Equal(t, []ConceptOutcome{{UUID: "brand", Status: StatusPublished}}, report.Concepts)
+	assert.Empty(t, report.Cascaded())
+}
+
+func TestService_ForceNotify_CascadeWithHashStore(t *testing.T) {
+	var mu sync.Mutex
+	payloads := map[string]string{"brand": `{"label": "brand"}`, "sub-brand": `{"label": "sub-brand"}`}
+	sl := &mockSmartlogicClient{
+		resolveConceptFunc: func(uuid string) (*smartlogic.Concept, smartlogic.Namespace, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			concept := &smartlogic.Concept{UUID: uuid, Raw: []byte(payloads[uuid])}
+			if uuid == "brand" {
+				concept.Relations = map[string][]string{"hasSubBrand": {"http://www.ft.com/thing/sub-brand"}}
+			}
+			return concept, smartlogic.Namespace{}, nil
+		},
+	}
+	namespaces, err := smartlogic.NewNamespaceRegistry(smartlogic.DefaultNamespaces()...)
+	assert.NoError(t, err)
+	kc := &mockKafkaClient{}
+	service := NewNotifierService(NewKafkaSink(kc), sl, WithHashStore(NewMemoryHashStore()),
+		WithCascade(NewCascade([]string{"hasSubBrand"}, 1, namespaces)))
+
+	_, err = service.ForceNotify(context.Background(), []string{"brand"}, "transactionID")
+	assert.NoError(t, err)
+	report, err := service.ForceNotify(context.Background(), []string{"brand"}, "transactionID")
+	assert.NoError(t, err)
+	assert.Equal(t, []ConceptOutcome{{UUID: "brand", Status: StatusUnchanged}}, report.Concepts,
+		"an unchanged concept shouldn't be cascaded from")
+
+	mu.Lock()
+	payloads["brand"] = `{"label": "brand renamed"}`
+	mu.Unlock()
+	report, err = service.ForceNotify(context.Background(), []string{"brand"}, "transactionID")
+	assert.NoError(t, err)
+	assert.Equal(t, []ConceptOutcome{
+		{UUID: "brand", Status: StatusPublished},
+		{UUID: "sub-brand", Status: StatusPublished, CascadedFrom: "brand"},
+	}, report.Concepts, "the related concepts should be published again even when their payload is unchanged")
+	assert.Equal(t, []string{`{"label": "brand"}`, `{"label": "sub-brand"}`, `{"label": "brand renamed"}`, `{"label": "sub-brand"}`}, kc.getSent())
+}
+
+func TestService_ForceNotify_Deduplication(t *testing.T) {
+	payloads := map[string]string{"uuid1": `{"label": "one", "uuid": "uuid1"}`, "uuid2": `{"label": "two"}`}
+	var mu sync.Mutex
+	sl := &mockSmartlogicClient{
+		resolveConceptFunc: func(uuid string) (*smartlogic.Concept, smartlogic.Namespace, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return &smartlogic.Concept{UUID: uuid, Raw: []byte(payloads[uuid])}, smartlogic.Namespace{}, nil
+		},
+	}
+	kc := &mockKafkaClient{}
+	service := NewNotifierService(NewKafkaSink(kc), sl, WithHashStore(NewMemoryHashStore()))
+
+	report, err := service.ForceNotify(context.Background(), []string{"uuid1", "uuid2"}, "transactionID")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Published())
+
+	mu.Lock()
+	payloads["uuid1"] = `{"uuid": "uuid1",  "label": "one"}`
+	payloads["uuid2"] = `{"label": "two, edited"}`
+	mu.Unlock()
+	report, err = service.ForceNotify(context.Background(), []string{"uuid1", "uuid2"}, "transactionID")
+	assert.NoError(t, err)
+	assert.Equal(t, []ConceptOutcome{
+		{UUID: "uuid1", Status: StatusUnchanged},
+		{UUID: "uuid2", Status: StatusPublished},
+	}, report.Concepts)
+	assert.Equal(t, 1, report.Published())
+
+	report, err = service.ForceNotify(WithoutDeduplication(context.Background()), []string{"uuid1", "uuid2"}, "transactionID")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Published(), "unchanged concepts should be published when deduplication is bypassed")
+	assert.Len(t, kc.getSent(), 5)
+}
+
+func TestService_Notify_DeletionResetsHash(t *testing.T) {
+	deleted := true
+	sl := &mockSmartlogicClient{
+		getChangedConceptsFunc: func(changeDate time.Time) ([]smartlogic.ChangedConcept, error) {
+			return []smartlogic.ChangedConcept{{UUID: "uuid1", ChangeType: smartlogic.ChangeTypeUpdated}}, nil
+		},
+		resolveConceptFunc: func(uuid string) (*smartlogic.Concept, smartlogic.Namespace, error) {
+			if deleted {
+				return nil, smartlogic.Namespace{}, smartlogic.ErrorConceptDoesNotExist
+			}
+			return &smartlogic.Concept{UUID: uuid, Raw: []byte(`{}`)}, smartlogic.Namespace{}, nil
+		},
+	}
+	hashes := NewMemoryHashStore()
+	hashes.Put("uuid1", contentHash([]byte(`{}`)))
+	kc := &mockKafkaClient{}
+	service := NewNotifierService(NewKafkaSink(kc), sl, WithHashStore(hashes), WithDeletionEvents(true))
+
+	assert.NoError(t, service.Notify(context.Background(), time.Now(), "transactionID"))
+	deleted = false
+	assert.NoError(t, service.Notify(context.Background(), time.Now(), "transactionID"))
+	assert.Len(t, kc.getSent(), 2, "a restored concept should be published even if it is unchanged since before its deletion")
+}
+
+func TestService_ForceNotify_FanOutPartialFailure(t *testing.T) {
+	first := &mockSink{name: "first"}
+	second := &mockSink{name: "second", err: errors.New("broken pipe")}
+	sl := &mockSmartlogicClient{concepts: map[string]string{"uuid1": "concept1"}}
+	queue := NewDeadLetterQueue(NewMemoryDeadLetterStore(), DefaultRetryPolicy)
+	service := NewNotifierService(NewFanOutSink(first, second), sl, WithDeadLetterQueue(queue))
+
+	report, err := service.ForceNotify(context.Background(), []string{"uuid1"}, "transactionID")
+	assert.Error(t, err)
+	assert.Equal(t, StatusFailed, report.Concepts[0].Status, "the concept should fail when one of the sinks fails")
+	letter, err := queue.Get("uuid1")
+	assert.NoError(t, err)
+	assert.Equal(t, "failed to publish to second: broken pipe", letter.Error)
+	assert.Len(t, first.getPublished(), 1)
+
+	second.err = nil
+	report, err = queue.Retry(context.Background(), service, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []ConceptOutcome{{UUID: "uuid1", Status: StatusPublished}}, report.Concepts)
+	assert.Len(t, first.getPublished(), 1, "the retry shouldn't publish the concept again to the sink which got it")
+	assert.Len(t, second.getPublished(), 1)
+	_, err = queue.Get("uuid1")
+	assert.True(t, errors.Is(err, ErrNoDeadLetter))
+}
+
+func TestService_ForceNotify_DeadLetters(t *testing.T) {
+	kc := &mockKafkaClient{}
+	sl := &mockSmartlogicClient{concepts: map[string]string{"uuid1": "concept1"}}
+	queue := NewDeadLetterQueue(NewMemoryDeadLetterStore(), DefaultRetryPolicy)
+	service := NewNotifierService(NewKafkaSink(kc), sl, WithDeadLetterQueue(queue))
+	assert.Equal(t, queue, service.DeadLetters())
+
+	_, err := service.ForceNotify(context.Background(), []string{"uuid1", "uuid2"}, "transactionID")
+	assert.Error(t, err)
+	letters, err := queue.List()
+	assert.NoError(t, err)
+	assert.Len(t, letters, 1)
+	assert.Equal(t, "uuid2", letters[0].UUID)
+	assert.Equal(t, "can't find concept", letters[0].Error)
+	assert.Equal(t, "transactionID", letters[0].TransactionID)
+	assert.Equal(t, 1, letters[0].Attempts)
+
+	sl.concepts["uuid2"] = "concept2"
+	report, err := queue.Retry(context.Background(), service, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []ConceptOutcome{{UUID: "uuid2", Status: StatusPublished}}, report.Concepts)
+	letters, err = queue.List()
+	assert.NoError(t, err)
+	assert.Empty(t, letters, "the concept should be forgotten once it is published")
 }
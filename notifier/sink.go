@@ -0,0 +1,331 @@
+package notifier
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/kafka-client-go/kafka"
+)
+
+// Message is a message published for a concept: its payload, or the announcement of its deletion.
+type Message struct {
+	// Topic is the Kafka topic of the namespace of the concept, or empty for the default topic.
+	Topic string
+	// Key is the UUID of the concept. The messages with the same key are kept in order by Kafka.
+	Key     string
+	Headers map[string]string
+	Body    string
+}
+
+// ErrSinkClosed is returned when publishing to a sink which was closed.
+var ErrSinkClosed = errors.New("sink closed")
+
+// Sink is where the messages of the concepts are published to.
+type Sink interface {
+	// Name identifies the sink in the logs and in the health checks.
+	Name() string
+	Publish(message Message) error
+	// Check returns an error when the messages can't be published to the sink.
+	Check() error
+	Close() error
+}
+
+// Kinds of sinks which can be configured.
+const (
+	SinkKafka   = "kafka"
+	SinkStdout  = "stdout"
+	SinkFile    = "file"
+	SinkDir     = "dir"
+	SinkWebhook = "webhook"
+)
+
+// SinkSpec configures a sink: its kind and, for the sinks which need one, their target, i.e. the path of the file
+// or of the directory, or the URL of the webhook.
+type SinkSpec struct {
+	Kind   string
+	Target string
+}
+
+// ParseSinkSpecs reads the comma separated list of sinks, each given as kind or kind:target, e.g.
+// kafka,file:/tmp/concepts.ndjson,webhook:http://localhost:9000/concepts.
+func ParseSinkSpecs(value string) ([]SinkSpec, error) {
+	var specs []SinkSpec
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		spec := SinkSpec{Kind: s}
+		if i := strings.Index(s, ":"); i >= 0 {
+			spec = SinkSpec{Kind: s[:i], Target: s[i+1:]}
+		}
+		switch spec.Kind {
+		case SinkKafka, SinkStdout:
+			if spec.Target != "" {
+				return nil, fmt.Errorf("the %s sink doesn't take a target", spec.Kind)
+			}
+		case SinkFile, SinkDir, SinkWebhook:
+			if spec.Target == "" {
+				return nil, fmt.Errorf("a target is required for the %s sink", spec.Kind)
+			}
+		default:
+			return nil, fmt.Errorf("unknown sink %q", spec.Kind)
+		}
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		return nil, errors.New("at least one sink should be configured")
+	}
+	return specs, nil
+}
+
+// BuildSink creates the sinks of the specs, fanning out to all of them when there are several. The Kafka sink is
+// built by kafkaSink, so that the Kafka producers are only created when Kafka is one of the sinks.
+func BuildSink(specs []SinkSpec, kafkaSink func() (Sink, error)) (Sink, error) {
+	var sinks []Sink
+	for _, spec := range specs {
+		var sink Sink
+		var err error
+		switch spec.Kind {
+		case SinkKafka:
+			sink, err = kafkaSink()
+		case SinkStdout:
+			sink = NewStdoutSink()
+		case SinkFile:
+			sink, err = NewFileSink(spec.Target)
+		case SinkDir:
+			sink, err = NewDirSink(spec.Target)
+		case SinkWebhook:
+			sink, err = NewWebhookSink(spec.Target, &http.Client{Timeout: DefaultWebhookTimeout})
+		default:
+			err = fmt.Errorf("unknown sink %q", spec.Kind)
+		}
+		if err != nil {
+			for _, s := range sinks {
+				_ = s.Close()
+			}
+			return nil, fmt.Errorf("failed to create the %s sink: %w", spec.Kind, err)
+		}
+		sinks = append(sinks, sink)
+	}
+	if len(sinks) == 1 {
+		return sinks[0], nil
+	}
+	return NewFanOutSink(sinks...), nil
+}
+
+// Limits of the partial deliveries remembered by a FanOutSink. They are kept long enough for the dead letter queue to
+// retry the concepts, and are forgotten past the limits, as the concepts may never be retried, e.g. once discarded.
+const (
+	FanOutDeliveryRetention = 24 * time.Hour
+	FanOutMaxDeliveries     = 10000
+)
+
+// FanOutSink publishes every message to all of its sinks.
+type FanOutSink struct {
+	sinks []Sink
+
+	// delivered holds, by concept, the sinks a message which failed to be published to some of them was published to.
+	mu            sync.Mutex
+	delivered     map[string]delivery
+	retention     time.Duration
+	maxDeliveries int
+	now           func() time.Time
+}
+
+// delivery is a message published to some of the sinks of a FanOutSink only.
+type delivery struct {
+	topic  string
+	body   string
+	sinks  []bool
+	failed time.Time
+}
+
+func NewFanOutSink(sinks ...Sink) *FanOutSink {
+	return &FanOutSink{
+		sinks:         sinks,
+		delivered:     map[string]delivery{},
+		retention:     FanOutDeliveryRetention,
+		maxDeliveries: FanOutMaxDeliveries,
+		now:           time.Now,
+	}
+}
+
+func (s *FanOutSink) Name() string {
+	names := make([]string, 0, len(s.sinks))
+	for _, sink := range s.sinks {
+		names = append(names, sink.Name())
+	}
+	return strings.Join(names, ", ")
+}
+
+// Publish publishes the message to each sink, even when some of them fail. The concept then fails, so it is
+// dead-lettered and retried like any other failure, and the sinks it was published to are remembered: when the
+// concept is published again with the same payload, it is only published to the sinks which failed. A message whose
+// payload changed meanwhile is published to all the sinks. As the sinks are only remembered in memory, and for a
+// limited time, a restart or a late retry publishes the message again to all of them, so they get it at least once.
+func (s *FanOutSink) Publish(message Message) error {
+	delivered := s.deliveredTo(message)
+	var failed []string
+	var firstErr error
+	for i, sink := range s.sinks {
+		if delivered[i] {
+			continue
+		}
+		if err := sink.Publish(message); err != nil {
+			failed = append(failed, sink.Name())
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		delivered[i] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if firstErr != nil {
+		if message.Key != "" {
+			s.remember(message, delivered)
+		}
+		return fmt.Errorf("failed to publish to %s: %w", strings.Join(failed, ", "), firstErr)
+	}
+	delete(s.delivered, message.Key)
+	return nil
+}
+
+// deliveredTo returns which sinks the message was already published to, when it was published to some of them only.
+func (s *FanOutSink) deliveredTo(message Message) []bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delivered := make([]bool, len(s.sinks))
+	d, ok := s.delivered[message.Key]
+	if ok && d.topic == message.Topic && d.body == message.Body && s.now().Sub(d.failed) <= s.retention {
+		copy(delivered, d.sinks)
+	}
+	return delivered
+}
+
+// remember keeps the sinks the message was published to, forgetting the deliveries past the retention, and the oldest
+// ones when there are too many. It is called with the mutex held.
+func (s *FanOutSink) remember(message Message, sinks []bool) {
+	now := s.now()
+	delete(s.delivered, message.Key)
+	var oldestKey string
+	var oldest time.Time
+	for key, d := range s.delivered {
+		if now.Sub(d.failed) > s.retention {
+			delete(s.delivered, key)
+			continue
+		}
+		if oldestKey == "" || d.failed.Before(oldest) {
+			oldestKey, oldest = key, d.failed
+		}
+	}
+	if len(s.delivered) >= s.maxDeliveries && oldestKey != "" {
+		delete(s.delivered, oldestKey)
+	}
+	s.delivered[message.Key] = delivery{topic: message.Topic, body: message.Body, sinks: sinks, failed: now}
+}
+
+func (s *FanOutSink) Check() error {
+	for _, sink := range s.sinks {
+		if err := sink.Check(); err != nil {
+			return fmt.Errorf("%s: %w", sink.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (s *FanOutSink) Close() error {
+	var firstErr error
+	for _, sink := range s.sinks {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Sinks returns the sinks the messages are fanned out to.
+func (s *FanOutSink) Sinks() []Sink {
+	return append([]Sink(nil), s.sinks...)
+}
+
+// KafkaSink publishes the messages to Kafka, to the topic of the namespace of their concept.
+type KafkaSink struct {
+	producer       kafka.Producer
+	topicProducers map[string]kafka.Producer
+}
+
+// WithTopicProducers sets the producers of the Kafka topics the concepts of some namespaces are published to.
+func WithTopicProducers(producers map[string]kafka.Producer) func(*KafkaSink) {
+	return func(s *KafkaSink) {
+		s.topicProducers = producers
+	}
+}
+
+// NewKafkaSink creates a sink publishing the messages with the producer of the default topic, or of the topic of
+// their namespace.
+func NewKafkaSink(producer kafka.Producer, opts ...func(*KafkaSink)) *KafkaSink {
+	s := &KafkaSink{producer: producer}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *KafkaSink) Name() string {
+	return "Kafka"
+}
+
+func (s *KafkaSink) Publish(message Message) error {
+	producer, err := s.producerFor(message.Topic)
+	if err != nil {
+		return err
+	}
+	ftMessage := kafka.NewFTMessage(message.Headers, message.Body)
+	if keyed, ok := producer.(KeyedProducer); ok {
+		return keyed.SendKeyedMessage(message.Key, ftMessage)
+	}
+	return producer.SendMessage(ftMessage)
+}
+
+func (s *KafkaSink) producerFor(topic string) (kafka.Producer, error) {
+	if topic == "" {
+		return s.producer, nil
+	}
+	producer, ok := s.topicProducers[topic]
+	if !ok {
+		return nil, fmt.Errorf("no Kafka producer is configured for topic %s", topic)
+	}
+	return producer, nil
+}
+
+func (s *KafkaSink) Check() error {
+	if err := s.producer.ConnectivityCheck(); err != nil {
+		return err
+	}
+	for topic, producer := range s.topicProducers {
+		if producer == s.producer {
+			continue
+		}
+		if err := producer.ConnectivityCheck(); err != nil {
+			return fmt.Errorf("failed connectivity check for topic %s: %w", topic, err)
+		}
+	}
+	return nil
+}
+
+func (s *KafkaSink) Close() error {
+	s.producer.Shutdown()
+	for _, producer := range s.topicProducers {
+		if producer != s.producer {
+			producer.Shutdown()
+		}
+	}
+	return nil
+}
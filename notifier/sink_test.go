@@ -0,0 +1,237 @@
+package notifier
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/kafka-client-go/kafka"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSinkSpecs(t *testing.T) {
+	tests := []struct {
+		value         string
+		expectedSpecs []SinkSpec
+		expectedErr   string
+	}{
+		{value: "kafka", expectedSpecs: []SinkSpec{{Kind: SinkKafka}}},
+		{
+			value: " kafka, stdout,file:/tmp/concepts.ndjson,dir:/tmp/concepts, webhook:http://localhost:9000/concepts?token=a:b ",
+			expectedSpecs: []SinkSpec{
+				{Kind: SinkKafka},
+				{Kind: SinkStdout},
+				{Kind: SinkFile, Target: "/tmp/concepts.ndjson"},
+				{Kind: SinkDir, Target: "/tmp/concepts"},
+				{Kind: SinkWebhook, Target: "http://localhost:9000/concepts?token=a:b"},
+			},
+		},
+		{value: "", expectedErr: "at least one sink should be configured"},
+		{value: "file", expectedErr: "a target is required for the file sink"},
+		{value: "stdout:/tmp", expectedErr: "the stdout sink doesn't take a target"},
+		{value: "kinesis", expectedErr: `unknown sink "kinesis"`},
+	}
+	for _, test := range tests {
+		specs, err := ParseSinkSpecs(test.value)
+		if test.expectedErr != "" {
+			assert.EqualError(t, err, test.expectedErr, test.value)
+			continue
+		}
+		assert.NoError(t, err, test.value)
+		assert.Equal(t, test.expectedSpecs, specs, test.value)
+	}
+}
+
+func TestBuildSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sinks")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	kafkaBuilt := false
+	kafkaSink := func() (Sink, error) {
+		kafkaBuilt = true
+		return NewKafkaSink(&mockKafkaClient{}), nil
+	}
+
+	sink, err := BuildSink([]SinkSpec{{Kind: SinkStdout}}, kafkaSink)
+	assert.NoError(t, err)
+	assert.Equal(t, "stdout", sink.Name())
+	assert.False(t, kafkaBuilt, "the Kafka sink should only be built when it is configured")
+
+	sink, err = BuildSink([]SinkSpec{{Kind: SinkKafka}, {Kind: SinkDir, Target: dir}}, kafkaSink)
+	assert.NoError(t, err)
+	assert.True(t, kafkaBuilt)
+	assert.IsType(t, &FanOutSink{}, sink)
+	assert.Equal(t, "Kafka, directory "+dir, sink.Name())
+	assert.NoError(t, sink.Close())
+
+	_, err = BuildSink([]SinkSpec{{Kind: SinkKafka}}, func() (Sink, error) {
+		return nil, errors.New("no brokers")
+	})
+	assert.EqualError(t, err, "failed to create the kafka sink: no brokers")
+}
+
+func TestFanOutSink(t *testing.T) {
+	first := &mockSink{name: "first", check: func() error { return nil }}
+	second := &mockSink{name: "second", check: func() error { return errors.New("unreachable") }}
+	third := &mockSink{name: "third"}
+	sink := NewFanOutSink(first, second, third)
+	assert.Equal(t, []Sink{first, second, third}, sink.Sinks())
+
+	assert.NoError(t, sink.Publish(Message{Body: "concept1"}))
+	second.err = errors.New("broken pipe")
+	third.err = errors.New("timeout")
+	assert.EqualError(t, sink.Publish(Message{Body: "concept2"}), "failed to publish to second, third: broken pipe")
+	assert.Equal(t, []Message{{Body: "concept1"}, {Body: "concept2"}}, first.getPublished(),
+		"the message should be published to the other sinks when one of them fails")
+
+	assert.EqualError(t, sink.Check(), "second: unreachable")
+}
+
+func TestFanOutSink_PartialFailure(t *testing.T) {
+	first := &mockSink{name: "first"}
+	second := &mockSink{name: "second", err: errors.New("broken pipe")}
+	sink := NewFanOutSink(first, second)
+
+	message := Message{Key: "uuid1", Headers: map[string]string{"X-Request-Id": "tid_1"}, Body: "concept1"}
+	assert.EqualError(t, sink.Publish(message), "failed to publish to second: broken pipe")
+	assert.Len(t, first.getPublished(), 1)
+
+	second.err = nil
+	retried := Message{Key: "uuid1", Headers: map[string]string{"X-Request-Id": "tid_1", "Message-Version": "2"}, Body: "concept1"}
+	assert.NoError(t, sink.Publish(retried))
+	assert.Len(t, first.getPublished(), 1, "the retried message shouldn't be published again to the sinks it was published to")
+	assert.Equal(t, []Message{retried}, second.getPublished())
+
+	assert.NoError(t, sink.Publish(retried))
+	assert.Len(t, first.getPublished(), 2, "the message should be published to all the sinks once it was published to all of them")
+	assert.Len(t, second.getPublished(), 2)
+
+	second.err = errors.New("broken pipe")
+	assert.Error(t, sink.Publish(Message{Key: "uuid1", Body: "concept1"}))
+	second.err = nil
+	updated := Message{Key: "uuid1", Body: "concept1 updated"}
+	assert.NoError(t, sink.Publish(updated))
+	assert.Equal(t, updated, first.getPublished()[3], "a message whose payload changed should be published to all the sinks")
+	assert.Equal(t, updated, second.getPublished()[2])
+}
+
+func TestFanOutSink_ForgetsDeliveries(t *testing.T) {
+	first := &mockSink{name: "first"}
+	second := &mockSink{name: "second", err: errors.New("broken pipe")}
+	sink := NewFanOutSink(first, second)
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	sink.now = func() time.Time { return now }
+	sink.maxDeliveries = 2
+
+	for _, key := range []string{"uuid1", "uuid2", "uuid3"} {
+		assert.Error(t, sink.Publish(Message{Key: key, Body: key}))
+		now = now.Add(time.Minute)
+	}
+	assert.Len(t, sink.delivered, 2, "the oldest delivery should be forgotten when there are too many")
+	assert.NotContains(t, sink.delivered, "uuid1")
+
+	now = now.Add(FanOutDeliveryRetention)
+	second.err = nil
+	assert.NoError(t, sink.Publish(Message{Key: "uuid2", Body: "uuid2"}))
+	assert.Len(t, first.getPublished(), 4, "a delivery past the retention should be published again to all the sinks")
+	second.err = errors.New("broken pipe")
+	assert.Error(t, sink.Publish(Message{Key: "uuid4", Body: "uuid4"}))
+	assert.Equal(t, []string{"uuid4"}, deliveryKeys(sink), "the deliveries past the retention should be forgotten")
+}
+
+func deliveryKeys(sink *FanOutSink) []string {
+	var keys []string
+	for key := range sink.delivered {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+type failingProducer struct {
+	mockKafkaClient
+}
+
+func (p *failingProducer) ConnectivityCheck() error {
+	return errors.New("no brokers")
+}
+
+func TestKafkaSink(t *testing.T) {
+	kc := &mockKafkaClient{}
+	locations := &failingProducer{}
+	sink := NewKafkaSink(kc, WithTopicProducers(map[string]kafka.Producer{"SmartlogicConcept": kc, "Locations": locations}))
+
+	assert.NoError(t, sink.Publish(Message{Headers: map[string]string{"Message-Type": "concept-update"}, Body: "concept"}))
+	assert.NoError(t, sink.Publish(Message{Topic: "Locations", Body: "location"}))
+	assert.EqualError(t, sink.Publish(Message{Topic: "Unknown", Body: "other"}), "no Kafka producer is configured for topic Unknown")
+	assert.Equal(t, []kafka.FTMessage{{Headers: map[string]string{"Message-Type": "concept-update"}, Body: "concept"}}, kc.getSentMessages())
+	assert.Equal(t, []string{"location"}, locations.getSent())
+
+	assert.EqualError(t, sink.Check(), "failed connectivity check for topic Locations: no brokers")
+}
+
+func TestKafkaSink_Keyed(t *testing.T) {
+	sp := &mockSyncProducer{}
+	sink := NewKafkaSink(newSaramaProducer("SmartlogicConcept", sp, nil))
+
+	assert.NoError(t, sink.Publish(Message{Key: "uuid1", Headers: map[string]string{"Message-Type": "concept-update"}, Body: "concept"}))
+	assert.Len(t, sp.sent, 1)
+	assert.Equal(t, "uuid1", encoded(t, sp.sent[0].Key), "the messages should be keyed when the producer supports it")
+	message := kafka.NewFTMessage(map[string]string{"Message-Type": "concept-update"}, "concept")
+	assert.Equal(t, message.Build(), encoded(t, sp.sent[0].Value))
+}
+
+func TestNDJSONSinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sinks")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	messages := []Message{
+		{Headers: map[string]string{"X-Request-Id": "tid_1"}, Body: "{\n  \"@id\": \"http://www.ft.com/thing/1\"\n}"},
+		{Topic: "Locations", Headers: map[string]string{"X-Request-Id": "tid_2"}, Body: "not json"},
+	}
+	expectedLines := []string{
+		`{"headers":{"X-Request-Id":"tid_1"},"body":{"@id":"http://www.ft.com/thing/1"}}`,
+		`{"topic":"Locations","headers":{"X-Request-Id":"tid_2"},"body":"not json"}`,
+	}
+
+	fileSink, err := NewFileSink(filepath.Join(dir, "concepts.ndjson"))
+	assert.NoError(t, err)
+	for _, m := range messages {
+		assert.NoError(t, fileSink.Publish(m))
+	}
+	assert.NoError(t, fileSink.Check())
+	assert.NoError(t, fileSink.Close())
+	data, err := ioutil.ReadFile(filepath.Join(dir, "concepts.ndjson"))
+	assert.NoError(t, err)
+	assert.Equal(t, expectedLines[0]+"\n"+expectedLines[1]+"\n", string(data))
+
+	_, err = NewFileSink(filepath.Join(dir, "missing", "concepts.ndjson"))
+	assert.Error(t, err, "a file in a missing directory can't be written")
+
+	dirSink, err := NewDirSink(filepath.Join(dir, "topics"))
+	assert.NoError(t, err)
+	for _, m := range messages {
+		assert.NoError(t, dirSink.Publish(m))
+	}
+	assert.NoError(t, dirSink.Check())
+	assert.NoError(t, dirSink.Close())
+	data, err = ioutil.ReadFile(filepath.Join(dir, "topics", "default.ndjson"))
+	assert.NoError(t, err)
+	assert.Equal(t, expectedLines[0]+"\n", string(data))
+	data, err = ioutil.ReadFile(filepath.Join(dir, "topics", "Locations.ndjson"))
+	assert.NoError(t, err)
+	assert.Equal(t, expectedLines[1]+"\n", string(data))
+
+	for _, sink := range []*NDJSONSink{fileSink, dirSink} {
+		err := sink.Publish(Message{Topic: "People", Body: "{}"})
+		assert.True(t, errors.Is(err, ErrSinkClosed), "a closed sink should reject the messages rather than reopen its files")
+		assert.True(t, errors.Is(sink.Check(), ErrSinkClosed))
+		assert.NoError(t, sink.Close())
+	}
+	_, err = os.Stat(filepath.Join(dir, "topics", "People.ndjson"))
+	assert.True(t, os.IsNotExist(err), "a closed directory sink shouldn't create files")
+}
@@ -0,0 +1,207 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
+	log "github.com/sirupsen/logrus"
+)
+
+// Severities of the validation rules. The concepts violating a blocking rule are not published,
+// while the violations of the other rules are only reported.
+const (
+	SeverityBlock = "block"
+	SeverityWarn  = "warn"
+)
+
+// Checks the validation rules can run on a concept.
+const (
+	// CheckPrefLabel requires a non empty preferred label.
+	CheckPrefLabel = "prefLabel"
+	// CheckType requires a non empty type.
+	CheckType = "type"
+	// CheckRelations requires the related concepts to exist in Smartlogic.
+	CheckRelations = "relations"
+)
+
+// ErrInvalidConcept is the cause of the failure of the concepts blocked by a validation rule.
+var ErrInvalidConcept = errors.New("concept failed validation")
+
+// ValidationRule is a check run on the concepts before they are published.
+type ValidationRule struct {
+	// Name identifies the rule in the reports. It defaults to the name of the check.
+	Name     string `json:"name,omitempty"`
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	// Types restricts the rule to the concepts of any of the types, given by IRI or local name.
+	// Without types, the rule applies to all the concepts.
+	Types []string `json:"types,omitempty"`
+	// Properties are the relations checked by the relations check. Without properties, all the relations are checked.
+	Properties []string `json:"properties,omitempty"`
+}
+
+func (r ValidationRule) Validate() error {
+	switch r.Check {
+	case CheckPrefLabel, CheckType, CheckRelations:
+	default:
+		return fmt.Errorf("unknown check %q of validation rule %s", r.Check, r.Name)
+	}
+	if r.Severity != SeverityBlock && r.Severity != SeverityWarn {
+		return fmt.Errorf("severity of validation rule %s should be %s or %s", r.Name, SeverityBlock, SeverityWarn)
+	}
+	return nil
+}
+
+// appliesTo returns whether the concept is of one of the types of the rule.
+func (r ValidationRule) appliesTo(concept *smartlogic.Concept) bool {
+	if len(r.Types) == 0 {
+		return true
+	}
+	for _, t := range r.Types {
+		if concept.HasType(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseValidationRules reads the list of validation rules from its JSON representation.
+func ParseValidationRules(data string) ([]ValidationRule, error) {
+	var rules []ValidationRule
+	if err := json.Unmarshal([]byte(data), &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse the validation rules: %w", err)
+	}
+	for i := range rules {
+		if rules[i].Name == "" {
+			rules[i].Name = rules[i].Check
+		}
+		if err := rules[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// Violation is the failure of a concept to satisfy a validation rule.
+type Violation struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// Validator checks the concepts against the validation rules before they are published.
+type Validator struct {
+	rules      []ValidationRule
+	namespaces *smartlogic.NamespaceRegistry
+}
+
+// NewValidator creates a validator of the rules. The namespaces tell which relations point to Smartlogic concepts.
+func NewValidator(rules []ValidationRule, namespaces *smartlogic.NamespaceRegistry) *Validator {
+	return &Validator{rules: rules, namespaces: namespaces}
+}
+
+// Validate returns the rules the concept violates. The related concepts are looked up with the client, and
+// an error is only returned when that fails.
+func (v *Validator) Validate(ctx context.Context, client smartlogic.Clienter, concept *smartlogic.Concept) ([]Violation, error) {
+	var violations []Violation
+	for _, rule := range v.rules {
+		if !rule.appliesTo(concept) {
+			continue
+		}
+		messages, err := v.check(ctx, client, rule, concept)
+		if err != nil {
+			return violations, err
+		}
+		for _, msg := range messages {
+			violations = append(violations, Violation{Rule: rule.Name, Severity: rule.Severity, Message: msg})
+		}
+	}
+	return violations, nil
+}
+
+// check runs the check of the rule on the concept and returns a message for each of its failures.
+func (v *Validator) check(ctx context.Context, client smartlogic.Clienter, rule ValidationRule, concept *smartlogic.Concept) ([]string, error) {
+	switch rule.Check {
+	case CheckPrefLabel:
+		if strings.TrimSpace(concept.PrefLabel("")) == "" {
+			return []string{"the concept has no prefLabel"}, nil
+		}
+	case CheckType:
+		for _, t := range concept.Types {
+			if strings.TrimSpace(t) != "" {
+				return nil, nil
+			}
+		}
+		return []string{"the concept has no type"}, nil
+	case CheckRelations:
+		return v.checkRelations(ctx, client, rule, concept)
+	}
+	return nil, nil
+}
+
+// checkRelations returns a message for each related concept which doesn't exist in Smartlogic.
+// The relations to resources outside of the namespaces are not checked.
+func (v *Validator) checkRelations(ctx context.Context, client smartlogic.Clienter, rule ValidationRule, concept *smartlogic.Concept) ([]string, error) {
+	properties := rule.Properties
+	if len(properties) == 0 {
+		for property := range concept.Relations {
+			properties = append(properties, property)
+		}
+		sort.Strings(properties)
+	}
+
+	var messages []string
+	checked := map[string]bool{}
+	for _, property := range properties {
+		for _, uri := range concept.Related(property) {
+			_, uuid, ok := v.namespaces.Match(uri)
+			if !ok || checked[uuid] {
+				continue
+			}
+			checked[uuid] = true
+			_, _, err := client.ResolveConcept(ctx, uuid)
+			if errors.Is(err, smartlogic.ErrorConceptDoesNotExist) {
+				messages = append(messages, fmt.Sprintf("the concept %s related via %s does not exist", uri, property))
+				continue
+			}
+			if err != nil {
+				return messages, fmt.Errorf("failed to check the concept %s related via %s: %w", uri, property, err)
+			}
+		}
+	}
+	return messages, nil
+}
+
+// blockingError returns the error the concept isn't published because of, if any of the violations is blocking.
+func blockingError(violations []Violation) error {
+	var messages []string
+	for _, violation := range violations {
+		if violation.Severity == SeverityBlock {
+			messages = append(messages, violation.Message)
+		}
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidConcept, strings.Join(messages, "; "))
+}
+
+func logViolations(conceptUUID string, transactionID string, violations []Violation) {
+	for _, violation := range violations {
+		entry := log.WithFields(log.Fields{
+			"request_transaction_id": transactionID,
+			"concept_uuid":           conceptUUID,
+			"rule":                   violation.Rule,
+		})
+		if violation.Severity == SeverityBlock {
+			entry.Errorf("Concept blocked by validation: %s", violation.Message)
+		} else {
+			entry.Warnf("Concept failed validation: %s", violation.Message)
+		}
+	}
+}
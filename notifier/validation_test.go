@@ -0,0 +1,152 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseValidationRules(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          string
+		expected      []ValidationRule
+		expectedError bool
+	}{
+		{
+			name: "Rules",
+			data: `[{"check": "prefLabel", "severity": "block"}, {"name": "brand-parents", "check": "relations", "types": ["Brand"], "properties": ["hasParentBrand"], "severity": "warn"}]`,
+			expected: []ValidationRule{
+				{Name: "prefLabel", Check: CheckPrefLabel, Severity: SeverityBlock},
+				{Name: "brand-parents", Check: CheckRelations, Severity: SeverityWarn, Types: []string{"Brand"}, Properties: []string{"hasParentBrand"}},
+			},
+		},
+		{
+			name:          "Unknown check",
+			data:          `[{"check": "altLabel", "severity": "block"}]`,
+			expectedError: true,
+		},
+		{
+			name:          "Missing severity",
+			data:          `[{"check": "type"}]`,
+			expectedError: true,
+		},
+		{
+			name:          "Invalid JSON",
+			data:          `{"check": "type"`,
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules, err := ParseValidationRules(test.data)
+			if test.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, rules)
+		})
+	}
+}
+
+func TestValidator_Validate(t *testing.T) {
+	namespaces, _ := smartlogic.NewNamespaceRegistry(smartlogic.DefaultNamespaces()...)
+	sl := &mockSmartlogicClient{concepts: map[string]string{"parent": "parent"}}
+	rules := []ValidationRule{
+		{Name: "label", Check: CheckPrefLabel, Severity: SeverityBlock},
+		{Name: "type", Check: CheckType, Severity: SeverityWarn},
+		{Name: "brand-parents", Check: CheckRelations, Severity: SeverityWarn, Types: []string{"Brand"}, Properties: []string{"hasParentBrand"}},
+	}
+	validator := NewValidator(rules, namespaces)
+
+	tests := []struct {
+		name     string
+		concept  *smartlogic.Concept
+		expected []Violation
+	}{
+		{
+			name: "Valid concept",
+			concept: &smartlogic.Concept{
+				Types:      []string{"http://www.ft.com/ontology/product/Brand"},
+				PrefLabels: []smartlogic.Literal{{Value: "FT"}},
+				Relations:  map[string][]string{"hasParentBrand": {"http://www.ft.com/thing/parent"}},
+			},
+		},
+		{
+			name:    "Missing label and type",
+			concept: &smartlogic.Concept{PrefLabels: []smartlogic.Literal{{Value: " "}}},
+			expected: []Violation{
+				{Rule: "label", Severity: SeverityBlock, Message: "the concept has no prefLabel"},
+				{Rule: "type", Severity: SeverityWarn, Message: "the concept has no type"},
+			},
+		},
+		{
+			name: "Dangling relation",
+			concept: &smartlogic.Concept{
+				Types:      []string{"Brand"},
+				PrefLabels: []smartlogic.Literal{{Value: "FT"}},
+				Relations: map[string][]string{"hasParentBrand": {
+					"http://www.ft.com/thing/parent",
+					"http://www.ft.com/thing/missing",
+					"http://www.ft.com/thing/missing",
+					"http://example.com/external",
+				}},
+			},
+			expected: []Violation{
+				{Rule: "brand-parents", Severity: SeverityWarn, Message: "the concept http://www.ft.com/thing/missing related via hasParentBrand does not exist"},
+			},
+		},
+		{
+			name: "Rule of another type",
+			concept: &smartlogic.Concept{
+				Types:      []string{"Person"},
+				PrefLabels: []smartlogic.Literal{{Value: "Jane Doe"}},
+				Relations:  map[string][]string{"hasParentBrand": {"http://www.ft.com/thing/missing"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sl.resolveConceptFunc = func(uuid string) (*smartlogic.Concept, smartlogic.Namespace, error) {
+				if uuid != "parent" {
+					return nil, smartlogic.Namespace{}, smartlogic.ErrorConceptDoesNotExist
+				}
+				return &smartlogic.Concept{UUID: uuid}, smartlogic.Namespace{}, nil
+			}
+			violations, err := validator.Validate(context.Background(), sl, test.concept)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, violations)
+		})
+	}
+}
+
+func TestValidator_Validate_LookupError(t *testing.T) {
+	namespaces, _ := smartlogic.NewNamespaceRegistry(smartlogic.DefaultNamespaces()...)
+	sl := &mockSmartlogicClient{
+		resolveConceptFunc: func(uuid string) (*smartlogic.Concept, smartlogic.Namespace, error) {
+			return nil, smartlogic.Namespace{}, smartlogic.ErrCircuitOpen
+		},
+	}
+	validator := NewValidator([]ValidationRule{{Name: "relations", Check: CheckRelations, Severity: SeverityWarn}}, namespaces)
+
+	concept := &smartlogic.Concept{Relations: map[string][]string{"broader": {"http://www.ft.com/thing/parent"}}}
+	_, err := validator.Validate(context.Background(), sl, concept)
+	assert.True(t, errors.Is(err, smartlogic.ErrCircuitOpen))
+}
+
+func TestBlockingError(t *testing.T) {
+	assert.NoError(t, blockingError([]Violation{{Rule: "type", Severity: SeverityWarn, Message: "the concept has no type"}}))
+
+	err := blockingError([]Violation{
+		{Rule: "label", Severity: SeverityBlock, Message: "the concept has no prefLabel"},
+		{Rule: "type", Severity: SeverityWarn, Message: "the concept has no type"},
+	})
+	assert.True(t, errors.Is(err, ErrInvalidConcept))
+	assert.EqualError(t, err, "concept failed validation: the concept has no prefLabel")
+}
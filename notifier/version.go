@@ -0,0 +1,164 @@
+package notifier
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/smartlogic-notifier/internal/fileutil"
+	log "github.com/sirupsen/logrus"
+)
+
+// VersionStore keeps the version of the latest message published for each concept.
+type VersionStore interface {
+	// Get returns the version of the concept, or false if there is none.
+	Get(conceptUUID string) (int64, bool, error)
+	Put(conceptUUID string, version int64) error
+}
+
+// MessageVersions issues the versions of the messages of the concepts. A message notified by a change is versioned
+// with the time the change was committed in Smartlogic, in nanoseconds since the epoch, and a message notified by
+// force, which has no commit, with the time it is built. The version is increased when needed to be greater than the
+// last one published for the concept, which is kept in the store so that the versions keep increasing across restarts.
+// The replicas of the notifier thus publish a change with the same version, unless one of them already published a
+// later version of the concept, e.g. by force, and has to increase it.
+type MessageVersions struct {
+	store VersionStore
+	now   func() time.Time
+
+	// locks serialise the messages of each concept, whose last version is read before being written.
+	locks keyedMutex
+}
+
+// NewMessageVersions creates the versions of the messages, keeping the latest version of each concept in the store.
+func NewMessageVersions(store VersionStore) *MessageVersions {
+	return &MessageVersions{store: store, now: time.Now, locks: keyedMutex{locks: map[string]*keyLock{}}}
+}
+
+// publish issues the version of the next message of the concept and publishes the message with it. The version is
+// only kept once the message is published, so a failed message doesn't use it up and its retry gets the same one.
+// When the store fails, the version is derived from the commit or the current time only, as failing the message would
+// be worse than the rare version going backwards.
+func (v *MessageVersions) publish(conceptUUID string, committed time.Time, publish func(version int64) error) error {
+	version := v.now().UnixNano()
+	if !committed.IsZero() {
+		version = committed.UnixNano()
+	}
+
+	unlock := v.locks.lock(conceptUUID)
+	defer unlock()
+	entry := log.WithField("concept_uuid", conceptUUID)
+	last, ok, err := v.store.Get(conceptUUID)
+	if err != nil {
+		entry.WithError(err).Warn("Failed to get the last message version of the concept")
+	}
+	if ok && version <= last {
+		version = last + 1
+	}
+	if err := publish(version); err != nil {
+		return err
+	}
+	if err := v.store.Put(conceptUUID, version); err != nil {
+		entry.WithError(err).Warn("Failed to keep the message version of the concept")
+	}
+	return nil
+}
+
+// keyedMutex is a mutex per key, held only while some goroutine uses it.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks the mutex of the key, and returns the function unlocking it.
+func (m *keyedMutex) lock(key string) func() {
+	m.mu.Lock()
+	l, ok := m.locks[key]
+	if !ok {
+		l = &keyLock{}
+		m.locks[key] = l
+	}
+	l.refs++
+	m.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if l.refs--; l.refs == 0 {
+			delete(m.locks, key)
+		}
+	}
+}
+
+// MemoryVersionStore is a VersionStore held in memory, so it starts empty every time the service starts.
+type MemoryVersionStore struct {
+	mu       sync.RWMutex
+	versions map[string]int64
+}
+
+func NewMemoryVersionStore() *MemoryVersionStore {
+	return &MemoryVersionStore{versions: map[string]int64{}}
+}
+
+func (s *MemoryVersionStore) Get(conceptUUID string) (int64, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	version, ok := s.versions[conceptUUID]
+	return version, ok, nil
+}
+
+func (s *MemoryVersionStore) Put(conceptUUID string, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.versions[conceptUUID] = version
+	return nil
+}
+
+// FileVersionStore is a VersionStore keeping a file per concept in a directory, so the versions survive restarts.
+// The files are written on every message, so they aren't synced to disk: a crash of the host may lose the latest
+// versions, which are then derived from the commits or the time only.
+type FileVersionStore struct {
+	dir string
+}
+
+// NewFileVersionStore creates a store in the directory, which is created if it doesn't exist.
+func NewFileVersionStore(dir string) (*FileVersionStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create the version store directory: %w", err)
+	}
+	return &FileVersionStore{dir: dir}, nil
+}
+
+func (s *FileVersionStore) Get(conceptUUID string) (int64, bool, error) {
+	data, err := ioutil.ReadFile(s.path(conceptUUID))
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	version, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid message version: %w", err)
+	}
+	return version, true, nil
+}
+
+func (s *FileVersionStore) Put(conceptUUID string, version int64) error {
+	return fileutil.ReplaceFile(s.path(conceptUUID), []byte(strconv.FormatInt(version, 10)), 0644)
+}
+
+func (s *FileVersionStore) path(conceptUUID string) string {
+	return conceptFile(s.dir, conceptUUID, ".version")
+}
@@ -0,0 +1,118 @@
+package notifier
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageVersions(t *testing.T) {
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	versions := NewMessageVersions(NewMemoryVersionStore())
+	versions.now = func() time.Time { return now }
+
+	committed := time.Date(2020, 5, 1, 11, 0, 0, 0, time.UTC)
+	assert.Equal(t, committed.UnixNano(), publishVersion(t, versions, "uuid1", committed), "a change should be versioned with its commit")
+	assert.Equal(t, now.UnixNano(), publishVersion(t, versions, "uuid1", time.Time{}), "a forced notification should be versioned with the time")
+	assert.Equal(t, now.UnixNano()+1, publishVersion(t, versions, "uuid1", time.Time{}), "the versions should increase when the clock doesn't")
+	assert.Equal(t, now.UnixNano()+2, publishVersion(t, versions, "uuid1", committed), "the versions should increase when an older change is notified")
+	assert.Equal(t, committed.UnixNano(), publishVersion(t, versions, "uuid2", committed), "the versions should be issued per concept")
+
+	replica := NewMessageVersions(NewMemoryVersionStore())
+	assert.Equal(t, committed.UnixNano(), publishVersion(t, replica, "uuid2", committed), "the replicas should publish a change with the same version")
+}
+
+func TestMessageVersions_FailedPublish(t *testing.T) {
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	versions := NewMessageVersions(NewMemoryVersionStore())
+	versions.now = func() time.Time { return now }
+
+	var failed int64
+	err := versions.publish("uuid1", time.Time{}, func(version int64) error {
+		failed = version
+		return errors.New("sink down")
+	})
+	assert.EqualError(t, err, "sink down")
+	assert.Equal(t, failed, publishVersion(t, versions, "uuid1", time.Time{}), "a failed message shouldn't use up its version")
+	assert.Equal(t, failed+1, publishVersion(t, versions, "uuid1", time.Time{}))
+}
+
+func TestMessageVersions_Concurrent(t *testing.T) {
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	versions := NewMessageVersions(NewMemoryVersionStore())
+	versions.now = func() time.Time { return now }
+
+	// a concept held by a slow publish doesn't hold up the others
+	held := make(chan struct{})
+	release := make(chan struct{})
+	go versions.publish("uuid1", time.Time{}, func(int64) error {
+		close(held)
+		<-release
+		return nil
+	})
+	<-held
+	assert.Equal(t, now.UnixNano(), publishVersion(t, versions, "uuid2", time.Time{}))
+	close(release)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	published := map[int64]bool{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			version := publishVersion(t, versions, "uuid1", time.Time{})
+			mu.Lock()
+			defer mu.Unlock()
+			published[version] = true
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, published, 10, "the messages of a concept should get distinct versions")
+	assert.Empty(t, versions.locks.locks, "the locks should be released")
+}
+
+// publishVersion publishes a message of the concept successfully, and returns its version.
+func publishVersion(t *testing.T, versions *MessageVersions, conceptUUID string, committed time.Time) int64 {
+	var published int64
+	err := versions.publish(conceptUUID, committed, func(version int64) error {
+		published = version
+		return nil
+	})
+	assert.NoError(t, err)
+	return published
+}
+
+func TestFileVersionStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "versions")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileVersionStore(filepath.Join(dir, "versions"))
+	assert.NoError(t, err)
+	_, ok, err := store.Get("uuid1")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	versions := NewMessageVersions(store)
+	versions.now = func() time.Time { return now }
+	first := publishVersion(t, versions, "../uuid1", time.Time{})
+
+	// a restart with a clock running late still issues greater versions
+	restarted, err := NewFileVersionStore(filepath.Join(dir, "versions"))
+	assert.NoError(t, err)
+	versions = NewMessageVersions(restarted)
+	versions.now = func() time.Time { return now.Add(-time.Minute) }
+	assert.Equal(t, first+1, publishVersion(t, versions, "../uuid1", time.Time{}))
+	version, ok, err := restarted.Get("../uuid1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, first+1, version)
+}
@@ -0,0 +1,87 @@
+package notifier
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultWebhookTimeout bounds how long a webhook may take to accept a message.
+const DefaultWebhookTimeout = 10 * time.Second
+
+// HTTP headers telling a webhook the Kafka topic of the namespace of the concept, and the Kafka key of the message.
+const (
+	TopicHeader = "X-Topic"
+	KeyHeader   = "X-Key"
+)
+
+// WebhookSink POSTs the body of each message to a URL, with the headers of the message as HTTP headers.
+type WebhookSink struct {
+	url    string
+	name   string
+	client *http.Client
+}
+
+// NewWebhookSink creates a sink posting the messages to the URL with the client.
+func NewWebhookSink(rawURL string, client *http.Client) (*WebhookSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("the webhook URL %s should be absolute, with the http or https scheme", rawURL)
+	}
+	// the credentials of the URL aren't logged nor reported by the health checks
+	u.User = nil
+	return &WebhookSink{url: rawURL, name: "webhook " + u.String(), client: client}, nil
+}
+
+func (s *WebhookSink) Name() string {
+	return s.name
+}
+
+// Publish posts the message. Any status but 2xx fails the message, so that it is retried.
+func (s *WebhookSink) Publish(message Message) error {
+	req, err := http.NewRequest("POST", s.url, strings.NewReader(message.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range message.Headers {
+		req.Header.Set(name, value)
+	}
+	if message.Topic != "" {
+		req.Header.Set(TopicHeader, message.Topic)
+	}
+	if message.Key != "" {
+		req.Header.Set(KeyHeader, message.Key)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post the message to the %s: %w", s.name, err)
+	}
+	defer resp.Body.Close()
+	// drain the body, so that the connection is reused
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("the %s responded with status %d", s.name, resp.StatusCode)
+	}
+	return nil
+}
+
+// Check makes a HEAD request to the webhook. Whatever the status, a response tells it is reachable.
+func (s *WebhookSink) Check() error {
+	resp, err := s.client.Head(s.url)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *WebhookSink) Close() error {
+	return nil
+}
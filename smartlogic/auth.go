@@ -0,0 +1,166 @@
+package smartlogic
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultTokenURL is the token endpoint of Smartlogic Cloud.
+const DefaultTokenURL = "https://cloud.smartlogic.com/token"
+
+// Supported values for the authentication type of the Smartlogic client.
+const (
+	AuthTypeAPIKey            = "apikey"
+	AuthTypeClientCredentials = "client-credentials"
+	AuthTypeBearer            = "bearer"
+	AuthTypeNone              = "none"
+)
+
+// Authenticator obtains the access token which the client sends to Smartlogic as a bearer token.
+// The client calls it again whenever the token is about to expire or has been rejected.
+type Authenticator interface {
+	Token(client HTTPClient) (TokenResponse, error)
+}
+
+// APIKeyAuth exchanges a Smartlogic API key for an access token using the "apikey" grant.
+type APIKeyAuth struct {
+	TokenURL string
+	APIKey   string
+}
+
+func (a APIKeyAuth) Token(client HTTPClient) (TokenResponse, error) {
+	data := url.Values{}
+	data.Set("grant_type", "apikey")
+	data.Set("key", a.APIKey)
+
+	return requestToken(client, a.TokenURL, data, nil)
+}
+
+// ClientCredentialsAuth obtains an access token using the OAuth2 client credentials grant.
+type ClientCredentialsAuth struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scope        string
+}
+
+func (a ClientCredentialsAuth) Token(client HTTPClient) (TokenResponse, error) {
+	data := url.Values{}
+	data.Set("grant_type", "client_credentials")
+	if a.Scope != "" {
+		data.Set("scope", a.Scope)
+	}
+
+	return requestToken(client, a.TokenURL, data, func(req *http.Request) {
+		req.SetBasicAuth(url.QueryEscape(a.ClientID), url.QueryEscape(a.ClientSecret))
+	})
+}
+
+// BearerTokenAuth uses a static, externally provisioned access token that never gets refreshed.
+type BearerTokenAuth struct {
+	AccessToken string
+}
+
+func (a BearerTokenAuth) Token(_ HTTPClient) (TokenResponse, error) {
+	return TokenResponse{AccessToken: a.AccessToken, TokenType: "bearer"}, nil
+}
+
+// NoAuth sends requests without any credentials, which is useful against local Smartlogic stubs.
+type NoAuth struct{}
+
+func (NoAuth) Token(_ HTTPClient) (TokenResponse, error) {
+	return TokenResponse{}, nil
+}
+
+// AuthConfig holds the settings from which NewAuthenticator builds an Authenticator.
+type AuthConfig struct {
+	Type         string
+	TokenURL     string
+	APIKey       string
+	ClientID     string
+	ClientSecret string
+	Scope        string
+	BearerToken  string
+}
+
+// NewAuthenticator returns the Authenticator for the configured authentication type.
+// The token URL defaults to the Smartlogic Cloud one when empty.
+func NewAuthenticator(config AuthConfig) (Authenticator, error) {
+	tokenURL := config.TokenURL
+	if tokenURL == "" {
+		tokenURL = DefaultTokenURL
+	}
+	switch config.Type {
+	case AuthTypeAPIKey, "":
+		if config.APIKey == "" {
+			return nil, fmt.Errorf("an API key is required for %s authentication", AuthTypeAPIKey)
+		}
+		return APIKeyAuth{TokenURL: tokenURL, APIKey: config.APIKey}, nil
+	case AuthTypeClientCredentials:
+		if config.ClientID == "" || config.ClientSecret == "" {
+			return nil, fmt.Errorf("a client id and secret are required for %s authentication", AuthTypeClientCredentials)
+		}
+		return ClientCredentialsAuth{
+			TokenURL:     tokenURL,
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			Scope:        config.Scope,
+		}, nil
+	case AuthTypeBearer:
+		if config.BearerToken == "" {
+			return nil, fmt.Errorf("a token is required for %s authentication", AuthTypeBearer)
+		}
+		return BearerTokenAuth{AccessToken: config.BearerToken}, nil
+	case AuthTypeNone:
+		return NoAuth{}, nil
+	}
+	return nil, fmt.Errorf("unknown authentication type %q", config.Type)
+}
+
+func requestToken(client HTTPClient, tokenURL string, data url.Values, prepare func(*http.Request)) (TokenResponse, error) {
+	entry := log.WithField("method", "GenerateToken").WithField("tokenURL", tokenURL)
+
+	req, err := http.NewRequest("POST", tokenURL, bytes.NewBufferString(data.Encode()))
+	if err != nil {
+		entry.WithError(err).Error("Error creating the request")
+		return TokenResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if prepare != nil {
+		prepare(req)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		entry.WithError(err).Error("Error making the request")
+		return TokenResponse{}, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err = responseError(resp.StatusCode, fmt.Errorf("smartlogic returned status %v generating the access token", resp.StatusCode))
+		entry.WithError(err).Error("Error response returned")
+		return TokenResponse{}, err
+	}
+
+	var tokenResponse TokenResponse
+	dec := json.NewDecoder(resp.Body)
+	err = dec.Decode(&tokenResponse)
+	if err != nil {
+		entry.WithError(err).Error("Error decoding the response body")
+		return TokenResponse{}, err
+	}
+	if tokenResponse.AccessToken == "" {
+		err = &Error{Kind: ErrMalformedResponse, Err: errors.New("smartlogic returned no access token")}
+		entry.WithError(err).Error("Error decoding the response body")
+		return TokenResponse{}, err
+	}
+	return tokenResponse, nil
+}
@@ -0,0 +1,154 @@
+package smartlogic
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticators(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        AuthConfig
+		expectedType  Authenticator
+		expectedToken string
+		checkRequest  func(t *testing.T, req *http.Request)
+	}{
+		{
+			name:          "api key",
+			config:        AuthConfig{Type: AuthTypeAPIKey, TokenURL: "http://semaphore.local/token", APIKey: "secret-key"},
+			expectedType:  APIKeyAuth{},
+			expectedToken: "issued-token",
+			checkRequest: func(t *testing.T, req *http.Request) {
+				assert.Equal(t, "http://semaphore.local/token", req.URL.String())
+				assert.NoError(t, req.ParseForm())
+				assert.Equal(t, "apikey", req.PostForm.Get("grant_type"))
+				assert.Equal(t, "secret-key", req.PostForm.Get("key"))
+			},
+		},
+		{
+			name:          "api key with default token url",
+			config:        AuthConfig{APIKey: "secret-key"},
+			expectedType:  APIKeyAuth{},
+			expectedToken: "issued-token",
+			checkRequest: func(t *testing.T, req *http.Request) {
+				assert.Equal(t, DefaultTokenURL, req.URL.String())
+			},
+		},
+		{
+			name: "client credentials",
+			config: AuthConfig{
+				Type:         AuthTypeClientCredentials,
+				TokenURL:     "http://semaphore.local/oauth/token",
+				ClientID:     "client",
+				ClientSecret: "secret",
+				Scope:        "read",
+			},
+			expectedType:  ClientCredentialsAuth{},
+			expectedToken: "issued-token",
+			checkRequest: func(t *testing.T, req *http.Request) {
+				user, pass, ok := req.BasicAuth()
+				assert.True(t, ok)
+				assert.Equal(t, "client", user)
+				assert.Equal(t, "secret", pass)
+				assert.NoError(t, req.ParseForm())
+				assert.Equal(t, "client_credentials", req.PostForm.Get("grant_type"))
+				assert.Equal(t, "read", req.PostForm.Get("scope"))
+			},
+		},
+		{
+			name:          "static bearer token",
+			config:        AuthConfig{Type: AuthTypeBearer, BearerToken: "static-token"},
+			expectedType:  BearerTokenAuth{},
+			expectedToken: "static-token",
+		},
+		{
+			name:          "no authentication",
+			config:        AuthConfig{Type: AuthTypeNone},
+			expectedType:  NoAuth{},
+			expectedToken: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auth, err := NewAuthenticator(test.config)
+			assert.NoError(t, err)
+			assert.IsType(t, test.expectedType, auth)
+
+			client := mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+				if test.checkRequest == nil {
+					t.Error("unexpected request to the token endpoint")
+				} else {
+					test.checkRequest(t, req)
+				}
+				return newMockResponse(http.StatusOK, `{"access_token": "issued-token", "expires_in": 3600}`), nil
+			})
+
+			token, err := auth.Token(client)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedToken, token.AccessToken)
+		})
+	}
+}
+
+func TestAuthenticators_InvalidTokenResponse(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		body         string
+		expectedKind error
+	}{
+		{name: "rejected credentials", status: http.StatusUnauthorized, body: `{"error": "invalid_client"}`, expectedKind: ErrUnauthorized},
+		{name: "server error", status: http.StatusInternalServerError, body: `{"access_token": "issued-token"}`, expectedKind: ErrUpstream},
+		{name: "no access token", status: http.StatusOK, body: `{"expires_in": 3600}`, expectedKind: ErrMalformedResponse},
+		{name: "empty access token", status: http.StatusOK, body: `{"access_token": "", "expires_in": 3600}`, expectedKind: ErrMalformedResponse},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+				return newMockResponse(test.status, test.body), nil
+			})
+			auths := []Authenticator{
+				APIKeyAuth{TokenURL: "http://semaphore.local/token", APIKey: "secret-key"},
+				ClientCredentialsAuth{TokenURL: "http://semaphore.local/token", ClientID: "client", ClientSecret: "secret"},
+			}
+			for _, auth := range auths {
+				_, err := auth.Token(client)
+				assert.True(t, errors.Is(err, test.expectedKind), "%T: %v", auth, err)
+			}
+		})
+	}
+}
+
+func TestNewAuthenticator_InvalidConfig(t *testing.T) {
+	configs := map[string]AuthConfig{
+		"api key without key":               {Type: AuthTypeAPIKey},
+		"client credentials without secret": {Type: AuthTypeClientCredentials, ClientID: "client"},
+		"bearer without token":              {Type: AuthTypeBearer},
+		"unknown type":                      {Type: "kerberos"},
+	}
+	for name, config := range configs {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewAuthenticator(config)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestClient_NoAuthSendsNoAuthorizationHeader(t *testing.T) {
+	client := mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		assert.Empty(t, req.Header.Get("Authorization"))
+		return newMockResponse(http.StatusOK, "response"), nil
+	})
+	sl, err := NewSmartlogicClient(client, "http://base/url", "modelName", NoAuth{}, "conceptUriPrefix")
+	assert.NoError(t, err)
+
+	resp, err := sl.(*Client).makeRequest(context.Background(), "GET", "http://a/url")
+	assert.NoError(t, err)
+	resp.Body.Close()
+}
@@ -0,0 +1,198 @@
+package smartlogic
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// States of a circuit breaker.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// Defaults of the circuit breaker.
+const (
+	DefaultFailureThreshold = 5
+	DefaultOpenTimeout      = 30 * time.Second
+	DefaultHalfOpenRequests = 1
+)
+
+// ErrCircuitOpen is returned without calling Smartlogic while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("smartlogic is unavailable, the circuit breaker is open")
+
+// CircuitStatus is a snapshot of the state of a circuit breaker.
+type CircuitStatus struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	OpenedAt            *time.Time `json:"openedAt,omitempty"`
+}
+
+// CircuitBreaker is an HTTP client which stops calling Smartlogic after a number of consecutive failures.
+// A request fails when it returns an error or a 5xx response. Once open, the breaker fails every request with
+// ErrCircuitOpen until the open timeout elapses. It then lets a few trial requests through, half-open,
+// and closes again if all of them succeed, or opens again as soon as one of them fails.
+type CircuitBreaker struct {
+	client           HTTPClient
+	failureThreshold int
+	openTimeout      time.Duration
+	halfOpenRequests int
+	now              func() time.Time
+
+	mu        sync.Mutex
+	state     string
+	failures  int
+	openedAt  time.Time
+	trials    int
+	successes int
+}
+
+// WithFailureThreshold sets the number of consecutive failures opening the circuit.
+func WithFailureThreshold(threshold int) func(*CircuitBreaker) {
+	return func(b *CircuitBreaker) {
+		if threshold > 0 {
+			b.failureThreshold = threshold
+		}
+	}
+}
+
+// WithOpenTimeout sets how long the circuit stays open before trial requests are let through.
+func WithOpenTimeout(timeout time.Duration) func(*CircuitBreaker) {
+	return func(b *CircuitBreaker) {
+		if timeout > 0 {
+			b.openTimeout = timeout
+		}
+	}
+}
+
+// WithHalfOpenRequests sets the number of successful trial requests closing the circuit again.
+func WithHalfOpenRequests(requests int) func(*CircuitBreaker) {
+	return func(b *CircuitBreaker) {
+		if requests > 0 {
+			b.halfOpenRequests = requests
+		}
+	}
+}
+
+// NewCircuitBreaker creates a closed circuit breaker in front of the client.
+func NewCircuitBreaker(client HTTPClient, opts ...func(*CircuitBreaker)) *CircuitBreaker {
+	b := &CircuitBreaker{
+		client:           client,
+		failureThreshold: DefaultFailureThreshold,
+		openTimeout:      DefaultOpenTimeout,
+		halfOpenRequests: DefaultHalfOpenRequests,
+		now:              time.Now,
+		state:            CircuitClosed,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+func (b *CircuitBreaker) Do(req *http.Request) (*http.Response, error) {
+	trial, err := b.allow()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.client.Do(req)
+	switch {
+	case err != nil && req.Context().Err() != nil:
+		// the caller gave up, which says nothing about the health of Smartlogic
+		b.abandon(trial)
+	case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+		b.failure(trial)
+	default:
+		b.success(trial)
+	}
+	return resp, err
+}
+
+// Status returns the current state of the breaker.
+func (b *CircuitBreaker) Status() CircuitStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := CircuitStatus{State: b.currentState(), ConsecutiveFailures: b.failures}
+	if status.State != CircuitClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
+
+// currentState returns the state of the breaker, which becomes half-open once the open timeout elapsed.
+func (b *CircuitBreaker) currentState() string {
+	if b.state == CircuitOpen && !b.now().Before(b.openedAt.Add(b.openTimeout)) {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// allow returns whether a request can be made and whether it is a trial request of the half-open breaker.
+func (b *CircuitBreaker) allow() (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.currentState() {
+	case CircuitClosed:
+		return false, nil
+	case CircuitHalfOpen:
+		if b.state == CircuitOpen {
+			b.state = CircuitHalfOpen
+			b.trials, b.successes = 0, 0
+			log.Info("Smartlogic circuit breaker is half-open, letting trial requests through")
+		}
+		if b.trials < b.halfOpenRequests-b.successes {
+			b.trials++
+			return true, nil
+		}
+	}
+	return false, ErrCircuitOpen
+}
+
+func (b *CircuitBreaker) success(trial bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	if !trial || b.state != CircuitHalfOpen {
+		return
+	}
+	b.trials--
+	b.successes++
+	if b.successes >= b.halfOpenRequests {
+		b.state = CircuitClosed
+		log.Info("Smartlogic circuit breaker is closed")
+	}
+}
+
+func (b *CircuitBreaker) failure(trial bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if trial && b.state == CircuitHalfOpen {
+		b.trials--
+		b.open()
+		return
+	}
+	if b.state == CircuitClosed && b.failures >= b.failureThreshold {
+		b.open()
+	}
+}
+
+func (b *CircuitBreaker) abandon(trial bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if trial && b.state == CircuitHalfOpen {
+		b.trials--
+	}
+}
+
+func (b *CircuitBreaker) open() {
+	b.state = CircuitOpen
+	b.openedAt = b.now()
+	log.WithField("failures", b.failures).Warnf("Smartlogic circuit breaker is open for %v", b.openTimeout)
+}
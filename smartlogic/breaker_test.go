@@ -0,0 +1,162 @@
+package smartlogic
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type scriptedClient struct {
+	mu       sync.Mutex
+	statuses []int
+	calls    int
+}
+
+// Do returns the next scripted status, where 0 stands for a connection error.
+func (c *scriptedClient) Do(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := c.statuses[c.calls%len(c.statuses)]
+	c.calls++
+	if status == 0 {
+		return nil, errors.New("connection refused")
+	}
+	return newMockResponse(status, ""), nil
+}
+
+func (c *scriptedClient) callCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+func newTestBreaker(client HTTPClient, opts ...func(*CircuitBreaker)) (*CircuitBreaker, *time.Time) {
+	now := time.Date(2020, 4, 27, 12, 0, 0, 0, time.UTC)
+	b := NewCircuitBreaker(client, opts...)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func doRequests(b *CircuitBreaker, n int) []error {
+	var errs []error
+	for i := 0; i < n; i++ {
+		req, _ := http.NewRequest("GET", "http://smartlogic/url", nil)
+		resp, err := b.Do(req)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+func TestCircuitBreaker_Opens(t *testing.T) {
+	client := &scriptedClient{statuses: []int{http.StatusInternalServerError, 0, http.StatusBadGateway}}
+	b, _ := newTestBreaker(client, WithFailureThreshold(3))
+
+	doRequests(b, 3)
+	assert.Equal(t, CircuitOpen, b.Status().State)
+	assert.Equal(t, 3, b.Status().ConsecutiveFailures)
+
+	errs := doRequests(b, 2)
+	assert.Equal(t, []error{ErrCircuitOpen, ErrCircuitOpen}, errs)
+	assert.Equal(t, 3, client.callCount(), "requests should fail fast while the circuit is open")
+}
+
+func TestCircuitBreaker_SuccessResetsFailures(t *testing.T) {
+	client := &scriptedClient{statuses: []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusNotFound}}
+	b, _ := newTestBreaker(client, WithFailureThreshold(3))
+
+	doRequests(b, 6)
+	assert.Equal(t, CircuitClosed, b.Status().State, "client errors shouldn't count as failures")
+	assert.Nil(t, b.Status().OpenedAt)
+}
+
+func TestCircuitBreaker_HalfOpen(t *testing.T) {
+	tests := []struct {
+		name          string
+		trialStatuses []int
+		expectedState string
+	}{
+		{
+			name:          "Trial requests succeed",
+			trialStatuses: []int{http.StatusOK, http.StatusOK},
+			expectedState: CircuitClosed,
+		},
+		{
+			name:          "Trial request fails",
+			trialStatuses: []int{http.StatusOK, http.StatusServiceUnavailable},
+			expectedState: CircuitOpen,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &scriptedClient{statuses: []int{0}}
+			b, now := newTestBreaker(client, WithFailureThreshold(1), WithOpenTimeout(time.Minute), WithHalfOpenRequests(2))
+
+			doRequests(b, 1)
+			assert.Equal(t, CircuitOpen, b.Status().State)
+
+			*now = now.Add(time.Minute)
+			assert.Equal(t, CircuitHalfOpen, b.Status().State)
+
+			client.statuses = test.trialStatuses
+			client.calls = 0
+			doRequests(b, 2)
+			assert.Equal(t, test.expectedState, b.Status().State)
+		})
+	}
+}
+
+func TestCircuitBreaker_HalfOpenLimitsTrialRequests(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	client := mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/fail" {
+			return nil, errors.New("connection refused")
+		}
+		started <- struct{}{}
+		<-release
+		return newMockResponse(http.StatusOK, ""), nil
+	})
+	b, now := newTestBreaker(client, WithFailureThreshold(1))
+
+	req, _ := http.NewRequest("GET", "http://smartlogic/fail", nil)
+	_, _ = b.Do(req)
+	*now = now.Add(DefaultOpenTimeout)
+
+	done := make(chan error)
+	go func() {
+		req, _ := http.NewRequest("GET", "http://smartlogic/trial", nil)
+		_, err := b.Do(req)
+		done <- err
+	}()
+	<-started
+	req, _ = http.NewRequest("GET", "http://smartlogic/trial", nil)
+	_, err := b.Do(req)
+	assert.Equal(t, ErrCircuitOpen, err, "only one trial request should be in flight")
+
+	close(release)
+	assert.NoError(t, <-done)
+	assert.Equal(t, CircuitClosed, b.Status().State)
+}
+
+func TestCircuitBreaker_CancelledRequestsAreNotFailures(t *testing.T) {
+	client := mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, req.Context().Err()
+	})
+	b, _ := newTestBreaker(client, WithFailureThreshold(1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", "http://smartlogic/url", nil)
+	_, err := b.Do(req)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, CircuitClosed, b.Status().State)
+}
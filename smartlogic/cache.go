@@ -0,0 +1,260 @@
+package smartlogic
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// Defaults of the concept cache.
+const (
+	DefaultCacheTTL        = 5 * time.Minute
+	DefaultCacheMaxEntries = 10000
+)
+
+// CachedClient is a read-through cache of the concepts got from Smartlogic. The cached concepts expire after a TTL and
+// the least recently used ones are evicted once the cache is full. The concepts in the changes returned by
+// GetChangedConceptList and GetChangedConcepts are invalidated, so the next notification of a changed concept
+// fetches it again. The cache is bypassed in the contexts returned by WithoutCache.
+type CachedClient struct {
+	Clienter
+	ttl        time.Duration
+	maxEntries int
+	serveStale bool
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+
+	registry      metrics.Registry
+	metricsPrefix string
+	hits          metrics.Counter
+	misses        metrics.Counter
+	stale         metrics.Counter
+	bypasses      metrics.Counter
+	evictions     metrics.Counter
+	invalidations metrics.Counter
+	size          metrics.Gauge
+}
+
+type cacheEntry struct {
+	uuid      string
+	concept   *Concept
+	namespace Namespace
+	expires   time.Time
+}
+
+// WithCacheTTL sets how long a concept is served from the cache before it is fetched again.
+func WithCacheTTL(ttl time.Duration) func(*CachedClient) {
+	return func(c *CachedClient) {
+		if ttl > 0 {
+			c.ttl = ttl
+		}
+	}
+}
+
+// WithCacheMaxEntries sets the number of concepts kept in the cache.
+func WithCacheMaxEntries(maxEntries int) func(*CachedClient) {
+	return func(c *CachedClient) {
+		if maxEntries > 0 {
+			c.maxEntries = maxEntries
+		}
+	}
+}
+
+// WithStaleOnError makes the cache serve an expired concept when Smartlogic fails to return it.
+func WithStaleOnError(enabled bool) func(*CachedClient) {
+	return func(c *CachedClient) {
+		c.serveStale = enabled
+	}
+}
+
+// WithCacheMetrics registers the metrics of the cache in the registry, with names starting with the prefix.
+func WithCacheMetrics(registry metrics.Registry, prefix string) func(*CachedClient) {
+	return func(c *CachedClient) {
+		c.registry = registry
+		c.metricsPrefix = prefix
+	}
+}
+
+// NewCachedClient creates a concept cache in front of the client. Its metrics are registered in the default registry
+// unless configured otherwise.
+func NewCachedClient(client Clienter, opts ...func(*CachedClient)) *CachedClient {
+	c := &CachedClient{
+		Clienter:      client,
+		ttl:           DefaultCacheTTL,
+		maxEntries:    DefaultCacheMaxEntries,
+		now:           time.Now,
+		entries:       map[string]*list.Element{},
+		lru:           list.New(),
+		registry:      metrics.DefaultRegistry,
+		metricsPrefix: "smartlogic.cache",
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.registerMetrics()
+	return c
+}
+
+func (c *CachedClient) registerMetrics() {
+	registry, prefix := c.registry, c.metricsPrefix
+	c.hits = metrics.GetOrRegisterCounter(prefix+".hits", registry)
+	c.misses = metrics.GetOrRegisterCounter(prefix+".misses", registry)
+	c.stale = metrics.GetOrRegisterCounter(prefix+".stale", registry)
+	c.bypasses = metrics.GetOrRegisterCounter(prefix+".bypasses", registry)
+	c.evictions = metrics.GetOrRegisterCounter(prefix+".evictions", registry)
+	c.invalidations = metrics.GetOrRegisterCounter(prefix+".invalidations", registry)
+	c.size = metrics.GetOrRegisterGauge(prefix+".size", registry)
+}
+
+// GetConcept returns the json-ld Smartlogic representation of a concept, from the cache if it is there.
+func (c *CachedClient) GetConcept(ctx context.Context, uuid string) ([]byte, error) {
+	concept, _, err := c.ResolveConcept(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	return concept.Raw, nil
+}
+
+// ResolveConcept returns the concept from the cache if it is there and not expired, otherwise it gets it from Smartlogic.
+func (c *CachedClient) ResolveConcept(ctx context.Context, uuid string) (*Concept, Namespace, error) {
+	return c.get(ctx, uuid, func(*cacheEntry) bool { return true }, func() (*Concept, Namespace, error) {
+		return c.Clienter.ResolveConcept(ctx, uuid)
+	})
+}
+
+// GetConceptInNamespace returns the concept from the cache if it is there, in the namespace and not expired, otherwise
+// it gets it from Smartlogic.
+func (c *CachedClient) GetConceptInNamespace(ctx context.Context, ns Namespace, uuid string) (*Concept, error) {
+	inNamespace := func(entry *cacheEntry) bool { return entry.namespace.Prefix == ns.Prefix }
+	concept, _, err := c.get(ctx, uuid, inNamespace, func() (*Concept, Namespace, error) {
+		concept, err := c.Clienter.GetConceptInNamespace(ctx, ns, uuid)
+		return concept, ns, err
+	})
+	return concept, err
+}
+
+// get returns the cached concept if its entry matches and is not expired, otherwise it fetches the concept and caches it.
+// When the cache is bypassed, the concept is always fetched, and the cached one is never served instead.
+func (c *CachedClient) get(ctx context.Context, uuid string, matches func(*cacheEntry) bool, fetch func() (*Concept, Namespace, error)) (*Concept, Namespace, error) {
+	entry, fresh := c.lookup(uuid)
+	if !cached(ctx) {
+		c.bypasses.Inc(1)
+		entry, fresh = nil, false
+	}
+	if entry != nil && !matches(entry) {
+		entry, fresh = nil, false
+	}
+	if fresh {
+		c.hits.Inc(1)
+		return entry.concept, entry.namespace, nil
+	}
+	c.misses.Inc(1)
+
+	concept, ns, err := fetch()
+	switch {
+	case errors.Is(err, ErrorConceptDoesNotExist):
+		c.Invalidate(uuid)
+		return nil, Namespace{}, err
+	case err != nil && entry != nil && c.serveStale && ctx.Err() == nil:
+		c.stale.Inc(1)
+		log.WithError(err).WithField("uuid", uuid).Warn("Serving a stale concept as Smartlogic failed to return it")
+		return entry.concept, entry.namespace, nil
+	case err != nil:
+		return nil, Namespace{}, err
+	}
+	c.store(uuid, concept, ns)
+	return concept, ns, nil
+}
+
+type noCacheKey struct{}
+
+// WithoutCache returns a context in which the concepts are got from Smartlogic rather than from the cache, e.g. when
+// they are forced to be published again. The concepts got are still cached for the other requests.
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+func cached(ctx context.Context) bool {
+	bypassed, _ := ctx.Value(noCacheKey{}).(bool)
+	return !bypassed
+}
+
+// GetChangedConceptList returns the uuids of the concepts changed since the given time and invalidates them.
+func (c *CachedClient) GetChangedConceptList(ctx context.Context, changeDate time.Time) ([]string, error) {
+	uuids, err := c.Clienter.GetChangedConceptList(ctx, changeDate)
+	if err != nil {
+		return nil, err
+	}
+	c.Invalidate(uuids...)
+	return uuids, nil
+}
+
+// GetChangedConcepts returns the latest change of the concepts changed since the given time and invalidates them.
+func (c *CachedClient) GetChangedConcepts(ctx context.Context, changeDate time.Time) ([]ChangedConcept, error) {
+	changes, err := c.Clienter.GetChangedConcepts(ctx, changeDate)
+	if err != nil {
+		return nil, err
+	}
+	uuids := make([]string, 0, len(changes))
+	for _, change := range changes {
+		uuids = append(uuids, change.UUID)
+	}
+	c.Invalidate(uuids...)
+	return changes, nil
+}
+
+// Invalidate removes the concepts with the given uuids from the cache.
+func (c *CachedClient) Invalidate(uuids ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, uuid := range uuids {
+		if elem, ok := c.entries[uuid]; ok {
+			c.remove(elem)
+			c.invalidations.Inc(1)
+		}
+	}
+	c.size.Update(int64(c.lru.Len()))
+}
+
+// lookup returns the cached entry of the concept, if any, and whether it is not expired yet.
+func (c *CachedClient) lookup(uuid string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[uuid]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	entry := elem.Value.(*cacheEntry)
+	return entry, c.now().Before(entry.expires)
+}
+
+func (c *CachedClient) store(uuid string, concept *Concept, ns Namespace) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &cacheEntry{uuid: uuid, concept: concept, namespace: ns, expires: c.now().Add(c.ttl)}
+	if elem, ok := c.entries[uuid]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[uuid] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+		c.evictions.Inc(1)
+	}
+	c.size.Update(int64(c.lru.Len()))
+}
+
+func (c *CachedClient) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).uuid)
+}
@@ -0,0 +1,218 @@
+package smartlogic
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingClient struct {
+	Clienter
+
+	mu      sync.Mutex
+	fetches map[string]int
+	err     error
+	changed []string
+}
+
+func (c *countingClient) ResolveConcept(_ context.Context, uuid string) (*Concept, Namespace, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fetches[uuid]++
+	if c.err != nil {
+		return nil, Namespace{}, c.err
+	}
+	return &Concept{UUID: uuid, Raw: []byte(uuid)}, Namespace{Prefix: thingURIPrefix}, nil
+}
+
+func (c *countingClient) GetConceptInNamespace(ctx context.Context, ns Namespace, uuid string) (*Concept, error) {
+	concept, _, err := c.ResolveConcept(ctx, uuid)
+	return concept, err
+}
+
+func (c *countingClient) GetChangedConcepts(_ context.Context, _ time.Time) ([]ChangedConcept, error) {
+	var changes []ChangedConcept
+	for _, uuid := range c.changed {
+		changes = append(changes, ChangedConcept{UUID: uuid})
+	}
+	return changes, nil
+}
+
+func (c *countingClient) GetChangedConceptList(_ context.Context, _ time.Time) ([]string, error) {
+	return c.changed, nil
+}
+
+func (c *countingClient) fetchCount(uuid string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fetches[uuid]
+}
+
+func newTestCache(client Clienter, opts ...func(*CachedClient)) (*CachedClient, *time.Time, metrics.Registry) {
+	now := time.Date(2020, 4, 27, 12, 0, 0, 0, time.UTC)
+	registry := metrics.NewRegistry()
+	cache := NewCachedClient(client, append([]func(*CachedClient){WithCacheMetrics(registry, "cache")}, opts...)...)
+	cache.now = func() time.Time { return now }
+	return cache, &now, registry
+}
+
+func counter(registry metrics.Registry, name string) int64 {
+	return metrics.GetOrRegisterCounter(name, registry).Count()
+}
+
+func TestCachedClient_ReadThrough(t *testing.T) {
+	client := &countingClient{fetches: map[string]int{}}
+	cache, now, registry := newTestCache(client, WithCacheTTL(time.Minute))
+
+	for i := 0; i < 3; i++ {
+		concept, err := cache.GetConcept(context.Background(), "uuid1")
+		assert.NoError(t, err)
+		assert.Equal(t, "uuid1", string(concept))
+	}
+	assert.Equal(t, 1, client.fetchCount("uuid1"))
+	assert.Equal(t, int64(2), counter(registry, "cache.hits"))
+	assert.Equal(t, int64(1), counter(registry, "cache.misses"))
+
+	*now = now.Add(time.Minute)
+	_, _, err := cache.ResolveConcept(context.Background(), "uuid1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, client.fetchCount("uuid1"), "expired concepts should be fetched again")
+}
+
+func TestCachedClient_GetConceptInNamespace(t *testing.T) {
+	client := &countingClient{fetches: map[string]int{}}
+	cache, _, _ := newTestCache(client)
+
+	_, ns, err := cache.ResolveConcept(context.Background(), "uuid1")
+	assert.NoError(t, err)
+	assert.Equal(t, thingURIPrefix, ns.Prefix)
+
+	_, err = cache.GetConceptInNamespace(context.Background(), Namespace{Prefix: thingURIPrefix}, "uuid1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, client.fetchCount("uuid1"), "the concept cached in the namespace should be served from the cache")
+
+	_, err = cache.GetConceptInNamespace(context.Background(), Namespace{Prefix: managedLocationURIPrefix}, "uuid1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, client.fetchCount("uuid1"), "the concept cached in another namespace should be fetched")
+	_, ns, err = cache.ResolveConcept(context.Background(), "uuid1")
+	assert.NoError(t, err)
+	assert.Equal(t, managedLocationURIPrefix, ns.Prefix)
+}
+
+func TestCachedClient_MaxEntries(t *testing.T) {
+	client := &countingClient{fetches: map[string]int{}}
+	cache, _, registry := newTestCache(client, WithCacheMaxEntries(2))
+
+	for _, uuid := range []string{"uuid1", "uuid2", "uuid1", "uuid3", "uuid1", "uuid2"} {
+		_, err := cache.GetConcept(context.Background(), uuid)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 1, client.fetchCount("uuid1"), "recently used concepts should be kept")
+	assert.Equal(t, 2, client.fetchCount("uuid2"), "least recently used concepts should be evicted")
+	assert.Equal(t, int64(2), counter(registry, "cache.evictions"))
+	assert.Equal(t, int64(2), metrics.GetOrRegisterGauge("cache.size", registry).Value())
+}
+
+func TestCachedClient_InvalidatesChangedConcepts(t *testing.T) {
+	tests := []struct {
+		name    string
+		changes func(*CachedClient) error
+	}{
+		{
+			name: "Changed concept list",
+			changes: func(c *CachedClient) error {
+				_, err := c.GetChangedConceptList(context.Background(), time.Now())
+				return err
+			},
+		},
+		{
+			name: "Changed concepts",
+			changes: func(c *CachedClient) error {
+				_, err := c.GetChangedConcepts(context.Background(), time.Now())
+				return err
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &countingClient{fetches: map[string]int{}, changed: []string{"uuid1"}}
+			cache, _, registry := newTestCache(client)
+
+			for _, uuid := range []string{"uuid1", "uuid2"} {
+				_, err := cache.GetConcept(context.Background(), uuid)
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, test.changes(cache))
+			for _, uuid := range []string{"uuid1", "uuid2"} {
+				_, err := cache.GetConcept(context.Background(), uuid)
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, 2, client.fetchCount("uuid1"))
+			assert.Equal(t, 1, client.fetchCount("uuid2"))
+			assert.Equal(t, int64(1), counter(registry, "cache.invalidations"))
+		})
+	}
+}
+
+func TestCachedClient_WithoutCache(t *testing.T) {
+	client := &countingClient{fetches: map[string]int{}}
+	cache, _, registry := newTestCache(client, WithStaleOnError(true))
+
+	_, err := cache.GetConcept(context.Background(), "uuid1")
+	assert.NoError(t, err)
+	_, err = cache.GetConcept(WithoutCache(context.Background()), "uuid1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, client.fetchCount("uuid1"), "the concept should be fetched when the cache is bypassed")
+	assert.Equal(t, int64(1), counter(registry, "cache.bypasses"))
+
+	_, err = cache.GetConcept(context.Background(), "uuid1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, client.fetchCount("uuid1"), "the concept fetched bypassing the cache should still be cached")
+
+	client.err = errors.New("smartlogic is down")
+	_, err = cache.GetConcept(WithoutCache(context.Background()), "uuid1")
+	assert.EqualError(t, err, "smartlogic is down", "the cached concept shouldn't be served when the cache is bypassed")
+}
+
+func TestCachedClient_Metrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	NewCachedClient(&countingClient{}, WithCacheMetrics(registry, "smartlogic.cache.model"))
+
+	assert.NotNil(t, registry.Get("smartlogic.cache.model.hits"))
+	assert.Nil(t, metrics.DefaultRegistry.Get("smartlogic.cache.hits"), "the default metrics shouldn't be registered when others are configured")
+}
+
+func TestCachedClient_StaleOnError(t *testing.T) {
+	for _, serveStale := range []bool{false, true} {
+		client := &countingClient{fetches: map[string]int{}}
+		cache, now, registry := newTestCache(client, WithCacheTTL(time.Minute), WithStaleOnError(serveStale))
+
+		_, err := cache.GetConcept(context.Background(), "uuid1")
+		assert.NoError(t, err)
+
+		client.err = errors.New("smartlogic is down")
+		*now = now.Add(2 * time.Minute)
+		concept, err := cache.GetConcept(context.Background(), "uuid1")
+		if serveStale {
+			assert.NoError(t, err)
+			assert.Equal(t, "uuid1", string(concept))
+			assert.Equal(t, int64(1), counter(registry, "cache.stale"))
+		} else {
+			assert.EqualError(t, err, "smartlogic is down", "stale concepts should only be served when enabled")
+		}
+
+		client.err = ErrorConceptDoesNotExist
+		_, err = cache.GetConcept(context.Background(), "uuid1")
+		assert.Equal(t, ErrorConceptDoesNotExist, err, "deleted concepts should never be served stale")
+		client.err = errors.New("smartlogic is down")
+		_, err = cache.GetConcept(context.Background(), "uuid1")
+		assert.Error(t, err)
+	}
+}
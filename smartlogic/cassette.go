@@ -0,0 +1,322 @@
+package smartlogic
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Redacted replaces the credentials and access tokens in the recorded interactions.
+const Redacted = "REDACTED"
+
+// ErrNoInteraction is returned when replaying a request which is not in the cassette, or whose interactions have
+// all been replayed already.
+var ErrNoInteraction = errors.New("no recorded interaction matches the request")
+
+var (
+	redactedHeaders    = []string{"Authorization", "Cookie", "Set-Cookie"}
+	redactedFormFields = []string{"key", "client_id", "client_secret", "password"}
+	redactedJSONFields = []string{"access_token", "refresh_token", "id_token"}
+)
+
+// Cassette is a list of HTTP interactions with Smartlogic, in the order they happened.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a request made to Smartlogic and the response it got, or the error if it got none.
+type Interaction struct {
+	Request  RecordedRequest   `json:"request"`
+	Response *RecordedResponse `json:"response,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// LoadCassette reads a cassette written by a RecordingClient, which holds an interaction per line. A last interaction
+// cut short, by a crash of the service while it was recording, is skipped.
+func LoadCassette(path string) (*Cassette, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the cassette: %w", err)
+	}
+	defer file.Close()
+
+	var cassette Cassette
+	dec := json.NewDecoder(file)
+	dec.DisallowUnknownFields()
+	for {
+		var interaction Interaction
+		err := dec.Decode(&interaction)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return &cassette, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the cassette %s: %w", path, err)
+		}
+		cassette.Interactions = append(cassette.Interactions, interaction)
+	}
+}
+
+// RecordingClient wraps a HTTPClient recording every request it makes and the response it gets. Each interaction is
+// appended to the cassette file as a line of JSON once it is over, so a long recording isn't held in memory and
+// survives a crash. The credentials sent to the token endpoint, the access tokens it returns and the Authorization
+// headers are redacted, so the cassette can be shared and committed as a test fixture.
+type RecordingClient struct {
+	client HTTPClient
+	path   string
+
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+	// err is the first error writing the cassette, returned by Close.
+	err error
+}
+
+// NewRecordingClient returns a client recording the interactions to the file at path, which is created or truncated.
+func NewRecordingClient(client HTTPClient, path string) (*RecordingClient, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the cassette: %w", err)
+	}
+	// The URLs and bodies are kept readable, without escaping their & < and >.
+	enc := json.NewEncoder(file)
+	enc.SetEscapeHTML(false)
+	return &RecordingClient{client: client, path: path, file: file, enc: enc}, nil
+}
+
+func (c *RecordingClient) Do(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+	interaction := Interaction{Request: RecordedRequest{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: redactHeader(req.Header),
+		Body:   redactForm(req.Header.Get("Content-Type"), reqBody),
+	}}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		interaction.Error = err.Error()
+		c.record(interaction)
+		return resp, err
+	}
+
+	var respBody []byte
+	if resp.Body != nil {
+		var readErr error
+		respBody, readErr = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		// Hand the body back as it was read, failing where the original one failed.
+		var body io.Reader = bytes.NewReader(respBody)
+		if readErr != nil {
+			body = io.MultiReader(body, errorReader{readErr})
+			interaction.Error = readErr.Error()
+		}
+		resp.Body = ioutil.NopCloser(body)
+	}
+	interaction.Response = &RecordedResponse{
+		StatusCode: resp.StatusCode,
+		Header:     redactHeader(resp.Header),
+		Body:       redactJSON(respBody),
+	}
+	c.record(interaction)
+	return resp, nil
+}
+
+// Close closes the cassette file, returning the first error writing it.
+func (c *RecordingClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.file.Close(); err != nil && c.err == nil {
+		c.err = err
+	}
+	if c.err != nil {
+		return fmt.Errorf("failed to write the cassette %s: %w", c.path, c.err)
+	}
+	return nil
+}
+
+// record appends the interaction to the cassette. Failing to write it doesn't fail the request, it is logged and the
+// error is returned by Close.
+func (c *RecordingClient) record(interaction Interaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.enc.Encode(interaction); err != nil {
+		log.WithError(err).WithField("cassette", c.path).Error("Failed to record the Smartlogic interaction")
+		if c.err == nil {
+			c.err = err
+		}
+	}
+}
+
+// ReplayingClient serves the responses of a cassette instead of calling Smartlogic. A request is matched with the
+// first interaction not replayed yet with the same method, path and query, whatever the scheme and host, so a
+// cassette recorded in production can be replayed against a test base URL. Each interaction is replayed once.
+type ReplayingClient struct {
+	mu           sync.Mutex
+	interactions []Interaction
+	replayed     []bool
+}
+
+// NewReplayingClient returns a client replaying the interactions of the cassette.
+func NewReplayingClient(cassette *Cassette) *ReplayingClient {
+	return &ReplayingClient{
+		interactions: cassette.Interactions,
+		replayed:     make([]bool, len(cassette.Interactions)),
+	}
+}
+
+func (c *ReplayingClient) Do(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	interaction, ok := c.next(req)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, req.URL.RequestURI())
+	}
+	if interaction.Response == nil {
+		return nil, errors.New(interaction.Error)
+	}
+	var body io.Reader = strings.NewReader(interaction.Response.Body)
+	if interaction.Error != "" {
+		body = io.MultiReader(body, errorReader{errors.New(interaction.Error)})
+	}
+	header := interaction.Response.Header
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+		StatusCode: interaction.Response.StatusCode,
+		Header:     header.Clone(),
+		Body:       ioutil.NopCloser(body),
+		Request:    req,
+	}, nil
+}
+
+// Remaining returns the number of interactions not replayed yet.
+func (c *ReplayingClient) Remaining() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	remaining := 0
+	for _, replayed := range c.replayed {
+		if !replayed {
+			remaining++
+		}
+	}
+	return remaining
+}
+
+func (c *ReplayingClient) next(req *http.Request) (Interaction, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, interaction := range c.interactions {
+		if c.replayed[i] || interaction.Request.Method != req.Method {
+			continue
+		}
+		u, err := url.Parse(interaction.Request.URL)
+		if err != nil || u.RequestURI() != req.URL.RequestURI() {
+			continue
+		}
+		c.replayed[i] = true
+		return interaction, true
+	}
+	return Interaction{}, false
+}
+
+func redactHeader(header http.Header) http.Header {
+	if len(header) == 0 {
+		return nil
+	}
+	redacted := header.Clone()
+	for _, name := range redactedHeaders {
+		values := redacted[name]
+		for i, value := range values {
+			// Keep the authentication scheme, which tells how the client authenticated.
+			if scheme := strings.Index(value, " "); scheme > 0 && name == "Authorization" {
+				values[i] = value[:scheme+1] + Redacted
+				continue
+			}
+			values[i] = Redacted
+		}
+	}
+	return redacted
+}
+
+// redactForm redacts the credentials of the form encoded bodies sent to the token endpoint.
+func redactForm(contentType string, body []byte) string {
+	if !strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		return string(body)
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return Redacted
+	}
+	for _, field := range redactedFormFields {
+		if _, ok := form[field]; ok {
+			form.Set(field, Redacted)
+		}
+	}
+	return form.Encode()
+}
+
+// redactJSON redacts the tokens of the JSON objects returned by the token endpoint. Other bodies are left untouched.
+func redactJSON(body []byte) string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return string(body)
+	}
+	redacted := false
+	for _, field := range redactedJSONFields {
+		if _, ok := fields[field]; ok {
+			fields[field] = json.RawMessage(`"` + Redacted + `"`)
+			redacted = true
+		}
+	}
+	if !redacted {
+		return string(body)
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return Redacted
+	}
+	return string(data)
+}
+
+type errorReader struct {
+	err error
+}
+
+func (r errorReader) Read(_ []byte) (int, error) {
+	return 0, r.err
+}
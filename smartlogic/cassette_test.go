@@ -0,0 +1,173 @@
+package smartlogic
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordingClient_RedactsCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassette")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cassette.ndjson")
+
+	recorder, err := NewRecordingClient(mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/token" {
+			body, _ := ioutil.ReadAll(req.Body)
+			assert.Equal(t, "grant_type=apikey&key=secret-key", string(body), "the request should be sent unredacted")
+			return newMockResponse(http.StatusOK, `{"access_token": "secret-token", "expires_in": 3600}`), nil
+		}
+		assert.Equal(t, "Bearer secret-token", req.Header.Get("Authorization"))
+		return newMockResponse(http.StatusOK, `{"@graph": []}`), nil
+	}), path)
+	assert.NoError(t, err)
+
+	client, err := NewSmartlogicClient(recorder, "http://base/url", "modelName",
+		APIKeyAuth{TokenURL: "http://base/token", APIKey: "secret-key"}, "http://www.ft.com/thing/")
+	assert.NoError(t, err)
+	assert.Equal(t, "secret-token", client.AccessToken(), "the response should be returned unredacted")
+	client.GetConcept(context.Background(), "2d3e16e0-61cb-4322-8aff-3b01c59f4daa")
+
+	cassette, err := LoadCassette(path)
+	assert.NoError(t, err)
+	assert.Len(t, cassette.Interactions, 2, "the interactions should be written as they happen")
+	assert.NoError(t, recorder.Close())
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "secret")
+	assert.Len(t, strings.Split(strings.TrimSpace(string(data)), "\n"), 2, "each interaction should be a line")
+
+	token := cassette.Interactions[0]
+	assert.Equal(t, "http://base/token", token.Request.URL)
+	assert.Equal(t, "grant_type=apikey&key=REDACTED", token.Request.Body)
+	assert.JSONEq(t, `{"access_token": "REDACTED", "expires_in": 3600}`, token.Response.Body)
+	concept := cassette.Interactions[1]
+	assert.Equal(t, "Bearer REDACTED", concept.Request.Header.Get("Authorization"))
+	assert.Equal(t, `{"@graph": []}`, concept.Response.Body)
+}
+
+func TestRecordingClient_RecordsErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassette")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cassette.ndjson")
+	recorder, err := NewRecordingClient(mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	}), path)
+	assert.NoError(t, err)
+	req, _ := http.NewRequest("GET", "http://base/url", nil)
+	_, err = recorder.Do(req)
+	assert.EqualError(t, err, "connection refused")
+	assert.NoError(t, recorder.Close())
+
+	cassette, err := LoadCassette(path)
+	assert.NoError(t, err)
+	replayer := NewReplayingClient(cassette)
+	_, err = replayer.Do(req)
+	assert.EqualError(t, err, "connection refused")
+}
+
+func TestRecordingClient_WriteFails(t *testing.T) {
+	_, err := NewRecordingClient(nil, filepath.Join("testdata", "does-not-exist", "cassette.ndjson"))
+	assert.Error(t, err)
+
+	dir, err := ioutil.TempDir("", "cassette")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	recorder, err := NewRecordingClient(mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		return newMockResponse(http.StatusOK, `{"@graph": []}`), nil
+	}), filepath.Join(dir, "cassette.ndjson"))
+	assert.NoError(t, err)
+	recorder.file.Close()
+	req, _ := http.NewRequest("GET", "http://base/url", nil)
+	_, err = recorder.Do(req)
+	assert.NoError(t, err, "failing to write the cassette shouldn't fail the requests")
+
+	err = recorder.Close()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to write the cassette")
+}
+
+func TestReplayingClient_MatchesRequests(t *testing.T) {
+	replayer := NewReplayingClient(&Cassette{Interactions: []Interaction{
+		{Request: RecordedRequest{Method: "GET", URL: "http://recorded/api?path=a"}, Response: &RecordedResponse{StatusCode: http.StatusOK, Body: "first a"}},
+		{Request: RecordedRequest{Method: "GET", URL: "http://recorded/api?path=b"}, Response: &RecordedResponse{StatusCode: http.StatusNotFound, Body: "b"}},
+		{Request: RecordedRequest{Method: "GET", URL: "http://recorded/api?path=a"}, Response: &RecordedResponse{StatusCode: http.StatusOK, Body: "second a"}},
+	}})
+
+	tests := []struct {
+		url          string
+		expectedBody string
+		expectedErr  error
+	}{
+		{url: "http://replayed/api?path=b", expectedBody: "b"},
+		{url: "http://replayed/api?path=a", expectedBody: "first a"},
+		{url: "http://replayed/api?path=a", expectedBody: "second a"},
+		{url: "http://replayed/api?path=a", expectedErr: ErrNoInteraction},
+		{url: "http://replayed/api?path=c", expectedErr: ErrNoInteraction},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", test.url, nil)
+		resp, err := replayer.Do(req)
+		if test.expectedErr != nil {
+			assert.True(t, errors.Is(err, test.expectedErr), test.url)
+			continue
+		}
+		assert.NoError(t, err)
+		body, _ := ioutil.ReadAll(resp.Body)
+		assert.Equal(t, test.expectedBody, string(body))
+	}
+	assert.Equal(t, 0, replayer.Remaining())
+}
+
+func TestReplayingClient_Fixture(t *testing.T) {
+	cassette, err := LoadCassette("testdata/cassettes/get-concept.ndjson")
+	assert.NoError(t, err)
+	replayer := NewReplayingClient(cassette)
+
+	client, err := NewSmartlogicClient(replayer, "http://localhost/api", "FTModel",
+		APIKeyAuth{TokenURL: "http://localhost/token", APIKey: "apiKey"}, "http://www.ft.com/thing/")
+	assert.NoError(t, err)
+
+	concept, _, err := client.ResolveConcept(context.Background(), "2d3e16e0-61cb-4322-8aff-3b01c59f4daa")
+	assert.NoError(t, err)
+	assert.Equal(t, "Lex", concept.PrefLabel("en"))
+	_, err = client.GetConcept(context.Background(), "a4a5c1f5-1a2b-4c4e-8d5f-4b6f6c0b1e2a")
+	assert.Equal(t, ErrorConceptDoesNotExist, err)
+	assert.Equal(t, 0, replayer.Remaining())
+}
+
+func TestLoadCassette_Invalid(t *testing.T) {
+	_, err := LoadCassette("testdata/does-not-exist.json")
+	assert.Error(t, err)
+
+	file, err := ioutil.TempFile("", "cassette")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	file.WriteString(`{"interactions": []}`)
+	file.Close()
+	_, err = LoadCassette(file.Name())
+	assert.True(t, strings.HasPrefix(err.Error(), "failed to parse the cassette"))
+}
+
+func TestLoadCassette_Truncated(t *testing.T) {
+	file, err := ioutil.TempFile("", "cassette")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	file.WriteString(`{"request": {"method": "GET", "url": "http://base/url"}, "error": "connection refused"}` + "\n")
+	file.WriteString(`{"request": {"method": "GET", "url": "http://ba`)
+	file.Close()
+
+	cassette, err := LoadCassette(file.Name())
+	assert.NoError(t, err, "an interaction cut short by a crash should be skipped")
+	assert.Equal(t, []Interaction{{Request: RecordedRequest{Method: "GET", URL: "http://base/url"}, Error: "connection refused"}}, cassette.Interactions)
+}
@@ -0,0 +1,173 @@
+package smartlogic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// changesAPIProperties are the properties of the teamwork:Change resources requested from the changes API.
+// The subjects and predicates of the added and deleted statements tell whether a concept was created, updated or deleted.
+const changesAPIProperties = "sem:about,sem:committed,sioc:has_creator," +
+	"teamwork:added/teamwork:subject,teamwork:added/teamwork:predicate," +
+	"teamwork:deleted/teamwork:subject,teamwork:deleted/teamwork:predicate"
+
+// changeWindow is a time range of the Smartlogic change log. A zero to means the range is open ended.
+type changeWindow struct {
+	from time.Time
+	to   time.Time
+}
+
+// WithChangesWindow splits the time range requested by GetChangedConceptList into windows of at most the given
+// duration, which are requested one after another, so a large bulk edit doesn't have to be returned in one response.
+func WithChangesWindow(window time.Duration) func(*Client) {
+	return func(c *Client) {
+		c.changesWindow = window
+	}
+}
+
+// WithChangesPageSize makes GetChangedConceptList request the change sets of each window in pages of the given size.
+func WithChangesPageSize(size int) func(*Client) {
+	return func(c *Client) {
+		c.changesPageSize = size
+	}
+}
+
+// changeWindows splits the time since the change date in windows of the configured duration.
+// The last window is left open ended, so changes committed while paging through the windows are not missed.
+func (c *Client) changeWindows(changeDate time.Time) []changeWindow {
+	if c.changesWindow <= 0 {
+		return []changeWindow{{from: changeDate}}
+	}
+	now := c.now()
+	var windows []changeWindow
+	from := changeDate
+	for {
+		to := from.Add(c.changesWindow)
+		if !to.Before(now) {
+			return append(windows, changeWindow{from: from})
+		}
+		windows = append(windows, changeWindow{from: from, to: to})
+		from = to
+	}
+}
+
+// getChangesPage requests a page of the change sets committed in the given window and passes each of them to visit.
+// It returns the number of change sets in the page.
+func (c *Client) getChangesPage(ctx context.Context, window changeWindow, offset int, visit func(Changeset)) (int, error) {
+	reqURL := c.baseURL
+	reqURL.RawQuery = c.buildChangesAPIQueryParams(window, offset).Encode()
+
+	log.Debugf("Smartlogic Change List Request URL: %v", reqURL.String())
+	resp, err := c.makeRequest(ctx, "GET", reqURL.String())
+	if err != nil {
+		log.WithError(err).WithField("method", "GetChangedConceptList").Error("Error creating the request")
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = responseError(resp.StatusCode, fmt.Errorf("smartlogic returned status %v getting the changes", resp.StatusCode))
+		log.WithError(err).WithField("method", "GetChangedConceptList").Error("Error response returned")
+		return 0, err
+	}
+
+	count, err := decodeChangesets(resp.Body, visit)
+	if err != nil {
+		log.WithError(err).WithField("method", "GetChangedConceptList").Error("Error decoding the response body")
+		return 0, bodyError(err)
+	}
+	return count, nil
+}
+
+// decodeChangesets decodes the change sets of a Graph one at a time, so that only one of them is held in memory.
+// It returns the number of change sets decoded.
+func decodeChangesets(r io.Reader, visit func(Changeset)) (int, error) {
+	return decodeGraph(r, func(dec *json.Decoder) error {
+		var changeset Changeset
+		if err := dec.Decode(&changeset); err != nil {
+			return err
+		}
+		visit(changeset)
+		return nil
+	})
+}
+
+// decodeGraph walks through the nodes of the @graph of a JSON-LD document, calling decodeNode to decode each of them
+// from the decoder. It returns the number of nodes in the graph.
+func decodeGraph(r io.Reader, decodeNode func(*json.Decoder) error) (int, error) {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return 0, err
+	}
+	count := 0
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return count, err
+		}
+		if key != "@graph" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return count, err
+			}
+			continue
+		}
+		if err := expectDelim(dec, '['); err != nil {
+			return count, err
+		}
+		for dec.More() {
+			if err := decodeNode(dec); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return count, err
+		}
+	}
+	return count, expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("invalid Smartlogic response: expected %v but got %v", delim, token)
+	}
+	return nil
+}
+
+// buildChangesAPIQueryParams returns map of type url.Values containing all query params needed to perform request to the Smartlogic API
+// that returns the changes on the model committed in the given window
+func (c *Client) buildChangesAPIQueryParams(window changeWindow, offset int) url.Values {
+	// Construct the request query params in such way that only the ids of the concepts affected by the change, together with
+	// who committed the change, when, and the subjects and predicates of the statements it added and deleted will be returned.
+	// Example: path=tchmodel:MODEL_ID/teamwork:Change/rdf:instance&properties=sem:about&filters=subject(sem:committed%3E%222020-04-05T00:00:00.990Z%22%5E%5Exsd:dateTime)
+	// URL decoded example: path=tchmodel:MODEL_ID/teamwork:Change/rdf:instance&properties=sem:about&filters=subject(sem:committed>"2020-04-05T00:00:00.990Z"^^xsd:dateTime)
+	queryParams := url.Values{}
+
+	queryParams.Add("path", fmt.Sprintf("tchmodel:%s/teamwork:Change/rdf:instance", c.model))
+	queryParams.Add("properties", changesAPIProperties)
+
+	timeFilter := fmt.Sprintf("sem:committed>\"%s\"^^xsd:dateTime", window.from.Format(slTimeFormat))
+	if !window.to.IsZero() {
+		timeFilter += fmt.Sprintf(" && sem:committed<=\"%s\"^^xsd:dateTime", window.to.Format(slTimeFormat))
+	}
+	queryParams.Add("filters", fmt.Sprintf("subject(%s)", timeFilter))
+
+	if c.changesPageSize > 0 {
+		queryParams.Add("limit", strconv.Itoa(c.changesPageSize))
+		queryParams.Add("offset", strconv.Itoa(offset))
+	}
+	return queryParams
+}
@@ -0,0 +1,187 @@
+package smartlogic
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_changeWindows(t *testing.T) {
+	now := time.Date(2020, 4, 27, 12, 0, 0, 0, time.UTC)
+	from := now.Add(-5 * time.Hour)
+
+	tests := []struct {
+		name     string
+		window   time.Duration
+		expected []changeWindow
+	}{
+		{
+			name:     "No window",
+			expected: []changeWindow{{from: from}},
+		},
+		{
+			name:   "Two hour windows",
+			window: 2 * time.Hour,
+			expected: []changeWindow{
+				{from: from, to: from.Add(2 * time.Hour)},
+				{from: from.Add(2 * time.Hour), to: from.Add(4 * time.Hour)},
+				{from: from.Add(4 * time.Hour)},
+			},
+		},
+		{
+			name:     "Window larger than the range",
+			window:   24 * time.Hour,
+			expected: []changeWindow{{from: from}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, err := NewSmartlogicTestClient(&mockHTTPClient{}, "http://base/url", "modelName", "apiKey", "conceptUriPrefix")
+			assert.NoError(t, err)
+			client.changesWindow = test.window
+			client.now = func() time.Time { return now }
+
+			assert.Equal(t, test.expected, client.changeWindows(from))
+		})
+	}
+}
+
+func TestClient_buildChangesAPIQueryParams_WindowAndPage(t *testing.T) {
+	from, _ := time.Parse(slTimeFormat, "2020-04-27T00:00:00.000Z")
+	to, _ := time.Parse(slTimeFormat, "2020-04-27T01:00:00.000Z")
+
+	client, err := NewSmartlogicTestClient(&mockHTTPClient{}, "http://base/url", "modelName", "apiKey", "conceptUriPrefix")
+	assert.NoError(t, err)
+	client.changesPageSize = 100
+
+	queryParams := client.buildChangesAPIQueryParams(changeWindow{from: from, to: to}, 200)
+	assert.Equal(t, "subject(sem:committed>\"2020-04-27T00:00:00.000Z\"^^xsd:dateTime && sem:committed<=\"2020-04-27T01:00:00.000Z\"^^xsd:dateTime)", queryParams.Get("filters"))
+	assert.Equal(t, "100", queryParams.Get("limit"))
+	assert.Equal(t, "200", queryParams.Get("offset"))
+}
+
+func TestClient_GetChangedConceptList_Pages(t *testing.T) {
+	const total = 7
+	var offsets []int
+	client := mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method == "POST" {
+			return newMockResponse(http.StatusOK, `{"access_token": "token"}`), nil
+		}
+		offset, _ := strconv.Atoi(req.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(req.URL.Query().Get("limit"))
+		offsets = append(offsets, offset)
+
+		var changesets []string
+		for i := offset; i < total && i < offset+limit; i++ {
+			changesets = append(changesets, fmt.Sprintf(`{"@id": "urn:x-change:%d", "sem:about": [{"@id": "http://www.ft.com/thing/uuid%d"}]}`, i, i))
+		}
+		return newMockResponse(http.StatusOK, `{"@graph": [`+strings.Join(changesets, ",")+`], "@context": {"sem": "http://www.smartlogic.com/2014/08/semaphore-core#"}}`), nil
+	})
+
+	sl, err := NewSmartlogicClient(client, "http://base/url", "modelName", NoAuth{}, thingURIPrefix, WithChangesPageSize(3))
+	assert.NoError(t, err)
+
+	uuids, err := sl.GetChangedConceptList(context.Background(), time.Now())
+	assert.NoError(t, err)
+	sort.Strings(uuids)
+	assert.Equal(t, []string{"uuid0", "uuid1", "uuid2", "uuid3", "uuid4", "uuid5", "uuid6"}, uuids)
+	assert.Equal(t, []int{0, 3, 6}, offsets)
+}
+
+func TestClient_GetChangedConceptList_Windows(t *testing.T) {
+	var filters []string
+	client := mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		filters = append(filters, req.URL.Query().Get("filters"))
+		uuid := fmt.Sprintf("uuid%d", len(filters))
+		return newMockResponse(http.StatusOK, `{"@graph": [{"sem:about": [{"@id": "http://www.ft.com/thing/`+uuid+`"}]}]}`), nil
+	})
+
+	sl, err := NewSmartlogicClient(client, "http://base/url", "modelName", NoAuth{}, thingURIPrefix, WithChangesWindow(time.Hour))
+	assert.NoError(t, err)
+
+	uuids, err := sl.GetChangedConceptList(context.Background(), time.Now().Add(-150*time.Minute))
+	assert.NoError(t, err)
+	sort.Strings(uuids)
+	assert.Equal(t, []string{"uuid1", "uuid2", "uuid3"}, uuids)
+	assert.Len(t, filters, 3)
+	assert.Contains(t, filters[0], "sem:committed<=")
+	assert.NotContains(t, filters[2], "sem:committed<=")
+}
+
+func TestClient_GetChangedConcepts_SameUUIDInSeveralNamespaces(t *testing.T) {
+	client := mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		return newMockResponse(http.StatusOK, `{"@graph": [
+			{"@id": "urn:x-change:1", "sem:about": [{"@id": "http://www.ft.com/thing/uuid1"}], "sem:committed": [{"@value": "2020-04-27T10:00:00Z"}],
+				"teamwork:deleted": [{"teamwork:subject": [{"@id": "http://www.ft.com/thing/uuid1"}], "teamwork:predicate": [{"@id": "rdf:type"}]}]},
+			{"@id": "urn:x-change:2", "sem:about": [{"@id": "http://www.ft.com/ontology/managedlocation/uuid1"}], "sem:committed": [{"@value": "2020-04-27T10:05:00Z"}],
+				"teamwork:added": [{"teamwork:subject": [{"@id": "http://www.ft.com/ontology/managedlocation/uuid1"}], "teamwork:predicate": [{"@id": "rdf:type"}]}]},
+			{"@id": "urn:x-change:3", "sem:about": [{"@id": "http://www.ft.com/thing/uuid1"}], "sem:committed": [{"@value": "2020-04-27T09:00:00Z"}]}
+		]}`), nil
+	})
+
+	sl, err := NewSmartlogicClient(client, "http://base/url", "modelName", NoAuth{}, thingURIPrefix)
+	assert.NoError(t, err)
+
+	changes, err := sl.GetChangedConcepts(context.Background(), time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []ChangedConcept{{
+		URI:        "http://www.ft.com/ontology/managedlocation/uuid1",
+		UUID:       "uuid1",
+		ChangeType: ChangeTypeCreated,
+		Committed:  time.Date(2020, 4, 27, 10, 5, 0, 0, time.UTC),
+		ChangeID:   "urn:x-change:2",
+		Namespace:  Namespace{Prefix: managedLocationURIPrefix, Kind: "managedlocation"},
+	}}, changes, "the concept should be returned once, with its latest change")
+}
+
+func TestDecodeChangesets(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		expectedURIs  []string
+		expectedError string
+	}{
+		{
+			name:         "Graph after other properties",
+			body:         `{"@context": {"a": ["b"]}, "@graph": [{"sem:about": [{"@id": "uri1"}, {"@id": "uri2"}]}, {"sem:about": [{"@id": "uri3"}]}]}`,
+			expectedURIs: []string{"uri1", "uri2", "uri3"},
+		},
+		{
+			name: "No graph",
+			body: `{"@context": {}}`,
+		},
+		{
+			name:          "Graph is not a list",
+			body:          `{"@graph": {}}`,
+			expectedError: "invalid Smartlogic response: expected [ but got {",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var uris []string
+			_, err := decodeChangesets(strings.NewReader(test.body), func(changeset Changeset) {
+				for _, c := range changeset.Concepts {
+					uris = append(uris, c.ID)
+				}
+			})
+			if test.expectedError != "" {
+				assert.EqualError(t, err, test.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedURIs, uris)
+		})
+	}
+
+	_, err := decodeChangesets(strings.NewReader(`{"@graph": [{"sem:about": [{"@id": "uri1"}]}`), func(Changeset) {})
+	assert.Error(t, err, "truncated responses should fail")
+}
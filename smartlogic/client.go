@@ -1,13 +1,13 @@
 package smartlogic
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"time"
 
@@ -15,72 +15,153 @@ import (
 )
 
 const (
-	slGetCredentialsURL = "https://cloud.smartlogic.com/token"
-	slTimeFormat        = "2006-01-02T15:04:05.000Z"
+	slTimeFormat = "2006-01-02T15:04:05.000Z"
 
 	maxAccessFailureCount = 5
-
-	thingURIPrefix           = "http://www.ft.com/thing/"
-	managedLocationURIPrefix = "http://www.ft.com/ontology/managedlocation/"
 )
 
 var ErrorConceptDoesNotExist = errors.New("concept does not exist")
 
-type httpClient interface {
+type HTTPClient interface {
 	Do(req *http.Request) (resp *http.Response, err error)
 }
 
 type Clienter interface {
-	GetConcept(uuid string) ([]byte, error)
-	GetChangedConceptList(changeDate time.Time) ([]string, error)
+	GetConcept(ctx context.Context, uuid string) ([]byte, error)
+	ResolveConcept(ctx context.Context, uuid string) (*Concept, Namespace, error)
+	GetConceptInNamespace(ctx context.Context, ns Namespace, uuid string) (*Concept, error)
+	GetChangedConceptList(ctx context.Context, changeDate time.Time) ([]string, error)
+	GetChangedConcepts(ctx context.Context, changeDate time.Time) ([]ChangedConcept, error)
+	ListConcepts(ctx context.Context, visit func(uuids []string) error) error
+	GetProjection(ctx context.Context, uuid string) (EffectiveProjection, error)
 	AccessToken() string
 }
 
 type Client struct {
-	baseURL            url.URL
-	model              string
-	conceptURIPrefix   string
-	apiKey             string
-	httpClient         httpClient
-	accessToken        string
-	accessFailureCount int
+	baseURL          url.URL
+	model            string
+	conceptURIPrefix string
+	auth             Authenticator
+	httpClient       HTTPClient
+	tokens           *tokenManager
+	namespaces       *NamespaceRegistry
+	changesWindow    time.Duration
+	changesPageSize  int
+	conceptsPageSize int
+	projection       Projection
+	now              func() time.Time
+}
+
+// WithNamespaces sets the namespaces in which the client looks concepts up and recognises changed concepts.
+func WithNamespaces(namespaces *NamespaceRegistry) func(*Client) {
+	return func(c *Client) {
+		c.namespaces = namespaces
+	}
+}
+
+// WithProjection sets the properties requested when getting a concept.
+func WithProjection(projection Projection) func(*Client) {
+	return func(c *Client) {
+		c.projection = projection
+	}
 }
 
-func NewSmartlogicClient(httpClient httpClient, baseURL string, model string, apiKey string, conceptURIPrefix string) (Clienter, error) {
+// NewSmartlogicClient creates a client of the Smartlogic model and generates its first access token. When generating
+// the token fails, the client is returned together with the error, as it requests a new token with its next request,
+// so the service can start while Smartlogic is unavailable. No client is returned when the base URL is invalid.
+func NewSmartlogicClient(httpClient HTTPClient, baseURL string, model string, auth Authenticator, conceptURIPrefix string, opts ...func(*Client)) (Clienter, error) {
 	u, err := url.Parse(baseURL)
 	if err != nil {
-		return &Client{}, err
+		return nil, err
 	}
 
 	client := Client{
 		baseURL:          *u,
 		model:            model,
 		conceptURIPrefix: conceptURIPrefix,
-		apiKey:           apiKey,
+		auth:             auth,
 		httpClient:       httpClient,
+		now:              time.Now,
+		conceptsPageSize: DefaultConceptsPageSize,
+		projection:       DefaultProjection(),
 	}
+	client.namespaces, _ = NewNamespaceRegistry(DefaultNamespaces()...)
+	for _, opt := range opts {
+		opt(&client)
+	}
+	client.tokens = newTokenManager(client.requestToken)
 
 	err = client.GenerateToken()
 	if err != nil {
-		return &Client{}, err
+		return &client, err
 	}
 	return &client, nil
 }
 
 func (c *Client) AccessToken() string {
-	return c.accessToken
+	return c.tokens.Current()
+}
+
+// TokenAge returns how long ago the current access token was issued.
+func (c *Client) TokenAge() time.Duration {
+	issued := c.tokens.Issued()
+	if issued.IsZero() {
+		return 0
+	}
+	return time.Since(issued)
+}
+
+// TokenExpiry returns when the current access token expires. It is zero if Smartlogic didn't tell us.
+func (c *Client) TokenExpiry() time.Time {
+	return c.tokens.Expires()
 }
 
 // GetConcept returns the json-ld Smartlogic representation of a concept with the given uuid via calling the Smartlogic API.
-func (c *Client) GetConcept(uuid string) ([]byte, error) {
+func (c *Client) GetConcept(ctx context.Context, uuid string) ([]byte, error) {
+	concept, _, err := c.ResolveConcept(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	return concept.Raw, nil
+}
+
+// ResolveConcept looks the concept with the given uuid up in each of the namespaces, starting with the one of
+// the concept URI prefix of the client, and returns it together with the namespace it was found in.
+func (c *Client) ResolveConcept(ctx context.Context, uuid string) (*Concept, Namespace, error) {
+	for _, ns := range c.namespaces.resolutionOrder(c.conceptURIPrefix) {
+		concept, err := c.GetConceptInNamespace(ctx, ns, uuid)
+		if errors.Is(err, ErrorConceptDoesNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, Namespace{}, err
+		}
+		return concept, ns, nil
+	}
+	return nil, Namespace{}, ErrorConceptDoesNotExist
+}
+
+// GetConceptInNamespace gets the concept with the given uuid in the namespace, e.g. the one of a changed concept, without
+// looking it up in the other namespaces. The concept is got with the properties of the projection. As the type of the
+// concept is only known once it is fetched, the concepts of a type with properties of its own are fetched a second time,
+// requesting them too.
+func (c *Client) GetConceptInNamespace(ctx context.Context, ns Namespace, uuid string) (*Concept, error) {
+	concept, err := c.fetchConcept(ctx, ns, uuid, c.projection.Properties)
+	if err != nil || !c.projection.hasTypeProperties(concept.Types) {
+		return concept, err
+	}
+	return c.fetchConcept(ctx, ns, uuid, c.projection.PropertiesFor(concept.Types))
+}
+
+func (c *Client) fetchConcept(ctx context.Context, ns Namespace, uuid string, properties []string) (*Concept, error) {
 	reqURL := c.baseURL
-	q := "path=" + c.buildConceptPath(uuid)
+	q := "path=" + c.buildConceptPath(ns.Prefix, uuid) + "&properties=" + encodeProperties(properties)
 	reqURL.RawQuery = q
 
-	entry := log.WithField("method", "GetConcept").WithField("uuid", uuid)
+	entry := log.WithField("method", "GetConcept").WithField("uuid", uuid).WithField("namespace", ns.Prefix)
 	entry.Debugf("Smartlogic Request URL: %v", reqURL.String())
 
-	resp, err := c.makeRequest("GET", reqURL.String())
+	resp, err := c.makeRequest(ctx, "GET", reqURL.String())
 	if err != nil {
 		entry.WithError(err).Error("Error creating the request")
 		return nil, err
@@ -88,7 +169,7 @@ func (c *Client) GetConcept(uuid string) ([]byte, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		err = fmt.Errorf("smartlogic returned status %v getting concept with uuid %v", resp.StatusCode, uuid)
+		err = responseError(resp.StatusCode, fmt.Errorf("smartlogic returned status %v getting concept with uuid %v", resp.StatusCode, uuid))
 		entry.WithError(err).Error("Error response returned")
 		return nil, err
 	}
@@ -96,126 +177,137 @@ func (c *Client) GetConcept(uuid string) ([]byte, error) {
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		entry.WithError(err).Error("Error reading the response body")
-		return nil, err
+		return nil, bodyError(err)
 	}
 	// As Smartlogic returns 200 response for non-existing concept with simple representation of the non existing concept,
-	// we additionally validate the response in order to check whether the response is for existing concept.
-	ok, err := c.isExistingConcept(body)
-	if err != nil {
-		return nil, fmt.Errorf("invalid concept representation returned for uuid %v", uuid)
-	}
-	if !ok {
-		return nil, ErrorConceptDoesNotExist
+	// parsing the response additionally checks whether the response is for existing concept.
+	concept, err := ParseConcept(body)
+	if errors.Is(err, ErrorConceptDoesNotExist) {
+		return nil, err
 	}
-	return body, nil
-}
-
-// isExistingConcept checks whether the Smartlogic json-ld concept response is for existing concept
-func (c *Client) isExistingConcept(conceptResp []byte) (bool, error) {
-	response := struct {
-		Graph []struct {
-			SemGUUID []struct {
-				Value string `json:"@value"`
-			} `json:"sem:guid"`
-		} `json:"@graph"`
-	}{}
-	err := json.Unmarshal(conceptResp, &response)
 	if err != nil {
-		return false, fmt.Errorf("failed to parse Smartlogic response: %w", err)
-	}
-	if len(response.Graph) == 0 {
-		return false, errors.New("invalid Smartlogic concept response")
+		return nil, &Error{Kind: ErrMalformedResponse, Err: fmt.Errorf("invalid concept representation returned for uuid %v", uuid)}
 	}
-	// the json-ld representation of existing concept has "sem:guid" value, as oppose to the json-ld representation of
-	// non-existing concept that only has @id property
-	if len(response.Graph[0].SemGUUID) == 0 || response.Graph[0].SemGUUID[0].Value == "" {
-		return false, nil
-	}
-	return true, nil
+	return concept, nil
 }
 
 // GetChangedConceptList returns a list of uuids of concepts that were changed since specified time.
-func (c *Client) GetChangedConceptList(changeDate time.Time) ([]string, error) {
-	reqURL := c.baseURL
-	reqURL.RawQuery = c.buildChangesAPIQueryParams(changeDate).Encode()
-
-	log.Debugf("Smartlogic Change List Request URL: %v", reqURL.String())
-	resp, err := c.makeRequest("GET", reqURL.String())
+func (c *Client) GetChangedConceptList(ctx context.Context, changeDate time.Time) ([]string, error) {
+	changes, err := c.GetChangedConcepts(ctx, changeDate)
 	if err != nil {
-		log.WithError(err).WithField("method", "GetChangedConceptList").Error("Error creating the request")
 		return nil, err
 	}
-
-	var graph Graph
-	defer resp.Body.Close()
-	err = json.NewDecoder(resp.Body).Decode(&graph)
-	if err != nil {
-		log.WithError(err).WithField("method", "GetChangedConceptList").Error("Error decoding the response body")
-		return nil, err
+	output := []string{}
+	for _, change := range changes {
+		output = append(output, change.UUID)
 	}
+	return output, nil
+}
 
-	changedURIs := map[string]bool{}
-	for _, changeset := range graph.Changesets {
-		for _, v := range changeset.Concepts {
-			changedURIs[v.URI] = true
+// GetChangedConcepts returns the latest change made to each of the concepts that were changed since specified time,
+// ordered by the time the change was committed. The changes are keyed by the UUID of the concept, as the consumers
+// are, so a concept changed under the URIs of several namespaces, e.g. when it moved, is returned once, with the URI
+// and the namespace of its latest change.
+func (c *Client) GetChangedConcepts(ctx context.Context, changeDate time.Time) ([]ChangedConcept, error) {
+	changes := map[string]*ChangedConcept{}
+	for _, window := range c.changeWindows(changeDate) {
+		offset := 0
+		for {
+			count, err := c.getChangesPage(ctx, window, offset, func(changeset Changeset) {
+				c.recordChanges(changes, changeset)
+			})
+			if err != nil {
+				return nil, err
+			}
+			if c.changesPageSize <= 0 || count < c.changesPageSize {
+				break
+			}
+			offset += count
 		}
 	}
 
-	output := []string{}
-	for k := range changedURIs {
-		if uuid, ok := getUUIDfromValidURI(k); ok {
-			output = append(output, uuid)
-		}
+	output := []ChangedConcept{}
+	for _, change := range changes {
+		output = append(output, *change)
 	}
+	sort.SliceStable(output, func(i, j int) bool {
+		if output[i].Committed.Equal(output[j].Committed) {
+			return output[i].UUID < output[j].UUID
+		}
+		return output[i].Committed.Before(output[j].Committed)
+	})
 	return output, nil
 }
 
-func getUUIDfromValidURI(uri string) (string, bool) {
-	if !strings.Contains(uri, "ConceptScheme") {
-		if strings.HasPrefix(uri, thingURIPrefix) {
-			return strings.TrimPrefix(uri, thingURIPrefix), true
+// recordChanges merges the changes of the changeset into the changes, keyed by the UUID of the concept.
+func (c *Client) recordChanges(changes map[string]*ChangedConcept, changeset Changeset) {
+	for _, about := range changeset.Concepts {
+		ns, uuid, ok := c.namespaces.Match(about.ID)
+		if !ok {
+			if !strings.Contains(about.ID, "ConceptScheme") {
+				log.WithField("method", "GetChangedConceptList").WithField("uri", about.ID).Warn("Changed concept is not in any of the configured namespaces")
+			}
+			continue
+		}
+		change := ChangedConcept{
+			URI:        about.ID,
+			UUID:       uuid,
+			ChangeType: changeset.ChangeType(about.ID),
+			Committer:  changeset.Committer(),
+			Committed:  changeset.CommittedAt(),
+			ChangeID:   changeset.ID,
+			Namespace:  ns,
 		}
-		if strings.HasPrefix(uri, managedLocationURIPrefix) {
-			return strings.TrimPrefix(uri, managedLocationURIPrefix), true
+		if existing, ok := changes[uuid]; ok {
+			existing.merge(change)
+			continue
 		}
+		changes[uuid] = &change
 	}
-	return "", false
 }
 
-func (c *Client) makeRequest(method, url string) (*http.Response, error) {
-	if c.accessFailureCount >= maxAccessFailureCount {
+// makeRequest makes a request to Smartlogic. The request is aborted when the context is done.
+func (c *Client) makeRequest(ctx context.Context, method, url string) (*http.Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, requestError(err)
+	}
+	if c.tokens.failures() >= maxAccessFailureCount {
 		// We've failed to get a valid access token multiple times in a row, so just error out.
 		log.WithField("method", "makeRequest").Error("Failed to get a valid access token")
-		return nil, errors.New("failed to get a valid access token")
+		return nil, &Error{Kind: ErrUnauthorized, StatusCode: http.StatusUnauthorized, Err: errTokenUnavailable}
 	}
 
-	req, err := http.NewRequest(method, url, nil)
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
 	if err != nil {
 		log.WithError(err).WithField("method", "makeRequest").Error("Error creating the request")
 		return nil, err
 	}
-	req.Header.Set("Authorization", "Bearer "+c.accessToken)
+
+	token, err := c.tokens.Token()
+	if err != nil {
+		// we were not able to generate new token, we will log it and still make the request, if it is rejected
+		// we will try again to generate new token
+		log.Infof("Failed to generate new Smartlogic token: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		log.WithError(err).WithField("method", "makeRequest").Error("Error making the request")
-		return resp, err
+		return resp, requestError(err)
 	}
 
-	// We're checking if we got a 401, which would be because the token had expired.  If it has, generate a new
-	// one and then make the request again.
+	// The token is refreshed ahead of its expiry, but Smartlogic may still reject it, e.g. when it was revoked.
+	// In that case drop it, so that a new one is generated, and then make the request again.
 	if resp.StatusCode == http.StatusUnauthorized {
 		resp.Body.Close()
-		c.accessFailureCount++
-		err = c.GenerateToken()
-		if err != nil {
-			// we were not able to generate new token, we will log it and try again to make the request
-			// which will try again to generate new token
-			log.Infof("Failed to generate new Smartlogic token: %v", err)
-		}
-		return c.makeRequest(method, url)
+		c.tokens.recordFailure()
+		c.tokens.Invalidate(token)
+		return c.makeRequest(ctx, method, url)
 	}
-	c.accessFailureCount = 0
+	c.tokens.resetFailures()
 	return resp, err
 }
 
@@ -228,64 +320,23 @@ type TokenResponse struct {
 	Expires     string `json:".expires"`
 }
 
-// Tokens have a limited life, so to be safe we should generate a new one for each notification received.
+// GenerateToken requests a new access token from Smartlogic. Tokens are refreshed automatically before they expire,
+// so there is normally no need to call this outside of the client initialisation.
 func (c *Client) GenerateToken() error {
-	data := url.Values{}
-	data.Set("grant_type", "apikey")
-	data.Set("key", c.apiKey)
-
-	req, err := http.NewRequest("POST", slGetCredentialsURL, bytes.NewBufferString(data.Encode()))
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	if err != nil {
-		log.WithError(err).WithField("method", "GenerateToken").Error("Error creating the request")
-		return err
-	}
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		log.WithError(err).WithField("method", "GenerateToken").Error("Error making the request")
-		return err
-	}
-
-	defer resp.Body.Close()
+	_, err := c.tokens.Refresh()
+	return err
+}
 
-	var tokenResponse TokenResponse
-	dec := json.NewDecoder(resp.Body)
-	err = dec.Decode(&tokenResponse)
-	if err != nil {
-		log.WithError(err).WithField("method", "GenerateToken").Error("Error decoding the response body")
-		return err
-	}
-	log.Debug("Setting Smartlogic access token")
-	c.accessToken = tokenResponse.AccessToken
-	return nil
+func (c *Client) requestToken() (TokenResponse, error) {
+	return c.auth.Token(c.httpClient)
 }
 
-func (c *Client) buildConceptPath(uuid string) string {
+func (c *Client) buildConceptPath(prefix string, uuid string) string {
 	/*
 		Because the API call needs to be made as part of the 'path' query parameter, we need to escape the IRI twice,
 		once to encode the IRI according to how Smartlogic needs it and once to encode it as a query parameter.
 	*/
-	concept := "<" + c.conceptURIPrefix + uuid + ">"
+	concept := "<" + prefix + uuid + ">"
 	encodedConcept := url.QueryEscape(url.QueryEscape(concept))
-
-	encodedProperties := url.QueryEscape("<http://www.ft.com/ontology/shortLabel>")
-	return "model:" + c.model + "/" + encodedConcept + "&properties=%5B%5D,skosxl:prefLabel/skosxl:literalForm,skosxl:altLabel/skosxl:literalForm," + encodedProperties + "/skosxl:literalForm"
-}
-
-// buildChangesAPIQueryParams returns map of type url.Values containing all query params needed to perform request to the Smartlogic API
-// that returns the changes on the model since specified time
-func (c *Client) buildChangesAPIQueryParams(changeDate time.Time) url.Values {
-	// Construct the request query params in such way that only the ids of the concepts affected by the change will be returned.
-	// Example: path=tchmodel:MODEL_ID/teamwork:Change/rdf:instance&properties=sem:about&filters=subject(sem:committed%3E%222020-04-05T00:00:00.990Z%22%5E%5Exsd:dateTime)
-	// URL decoded example: path=tchmodel:MODEL_ID/teamwork:Change/rdf:instance&properties=sem:about&filters=subject(sem:committed>"2020-04-05T00:00:00.990Z"^^xsd:dateTime)
-	queryParams := url.Values{}
-
-	queryParams.Add("path", fmt.Sprintf("tchmodel:%s/teamwork:Change/rdf:instance", c.model))
-	queryParams.Add("properties", "sem:about")
-
-	timeFilter := fmt.Sprintf("sem:committed>\"%s\"^^xsd:dateTime", changeDate.Format(slTimeFormat))
-	queryParams.Add("filters", fmt.Sprintf("subject(%s)", timeFilter))
-
-	return queryParams
+	return "model:" + c.model + "/" + encodedConcept
 }
@@ -1,19 +1,21 @@
 package smartlogic
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
-func NewSmartlogicTestClient(httpClient httpClient, baseURL string, model string, apiKey string, conceptURIPrefix string) (Client, error) {
+func NewSmartlogicTestClient(httpClient HTTPClient, baseURL string, model string, apiKey string, conceptURIPrefix string) (Client, error) {
 	u, err := url.Parse(baseURL)
 	if err != nil {
 		return Client{}, err
@@ -23,9 +25,14 @@ func NewSmartlogicTestClient(httpClient httpClient, baseURL string, model string
 		baseURL:          *u,
 		model:            model,
 		conceptURIPrefix: conceptURIPrefix,
-		apiKey:           apiKey,
+		auth:             APIKeyAuth{TokenURL: DefaultTokenURL, APIKey: apiKey},
 		httpClient:       httpClient,
+		now:              time.Now,
+		conceptsPageSize: DefaultConceptsPageSize,
+		projection:       DefaultProjection(),
 	}
+	client.namespaces, _ = NewNamespaceRegistry(DefaultNamespaces()...)
+	client.tokens = newTokenManager(client.requestToken)
 
 	return client, nil
 }
@@ -40,7 +47,7 @@ func TestNewSmartlogicClient_Success(t *testing.T) {
 			resp:       tokenResponseString,
 			statusCode: http.StatusOK,
 			err:        nil,
-		}, "http://base/url", "modelName", "apiKey", "conceptUriPrefix",
+		}, "http://base/url", "modelName", APIKeyAuth{TokenURL: DefaultTokenURL, APIKey: "apiKey"}, "conceptUriPrefix",
 	)
 	assert.NoError(t, err)
 	assert.EqualValues(t, tokenResponseValue, sl.AccessToken())
@@ -51,29 +58,29 @@ func TestNewSmartlogicClient_BadURL(t *testing.T) {
 	tokenResponseValue := "1234567890"
 	tokenResponseString := "{\"access_token\": \"" + tokenResponseValue + "\"}"
 
-	_, err := NewSmartlogicClient(
+	sl, err := NewSmartlogicClient(
 		&mockHTTPClient{
 			resp:       tokenResponseString,
 			statusCode: http.StatusOK,
 			err:        nil,
-		}, "http:// base/url", "modelName", "apiKey", "conceptUriPrefix",
+		}, "http:// base/url", "modelName", APIKeyAuth{TokenURL: DefaultTokenURL, APIKey: "apiKey"}, "conceptUriPrefix",
 	)
 	assert.Error(t, err)
+	assert.Nil(t, sl)
 }
 
 func TestNewSmartlogicClient_NoToken(t *testing.T) {
 
 	tokenResponseString := "{\"1\":1}"
 
-	sl, err := NewSmartlogicClient(
+	_, err := NewSmartlogicClient(
 		&mockHTTPClient{
 			resp:       tokenResponseString,
 			statusCode: http.StatusOK,
 			err:        nil,
-		}, "http://base/url", "modelName", "apiKey", "conceptUriPrefix",
+		}, "http://base/url", "modelName", APIKeyAuth{TokenURL: DefaultTokenURL, APIKey: "apiKey"}, "conceptUriPrefix",
 	)
-	assert.NoError(t, err)
-	assert.EqualValues(t, "", sl.AccessToken())
+	assert.True(t, errors.Is(err, ErrMalformedResponse))
 }
 
 func TestNewSmartlogicClient_BadResponse(t *testing.T) {
@@ -86,12 +93,34 @@ func TestNewSmartlogicClient_BadResponse(t *testing.T) {
 			resp:       tokenResponseString,
 			statusCode: http.StatusNotFound,
 			err:        responseError,
-		}, "http://base/url", "modelName", "apiKey", "conceptUriPrefix",
+		}, "http://base/url", "modelName", APIKeyAuth{TokenURL: DefaultTokenURL, APIKey: "apiKey"}, "conceptUriPrefix",
 	)
 	assert.Error(t, err)
 	assert.EqualValues(t, responseError, err)
 }
 
+func TestNewSmartlogicClient_TokenUnavailable(t *testing.T) {
+	tokenRequests := 0
+	sl, err := NewSmartlogicClient(mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/token" {
+			tokenRequests++
+			if tokenRequests == 1 {
+				return newMockResponse(http.StatusServiceUnavailable, ""), nil
+			}
+			return newMockResponse(http.StatusOK, `{"access_token": "issued-token"}`), nil
+		}
+		assert.Equal(t, "Bearer issued-token", req.Header.Get("Authorization"))
+		return newMockResponse(http.StatusOK, `{"@graph": []}`), nil
+	}), "http://base/url", "modelName", APIKeyAuth{TokenURL: "http://base/token", APIKey: "apiKey"}, "conceptUriPrefix")
+	assert.True(t, errors.Is(err, ErrUpstream))
+	assert.NotNil(t, sl, "the client should be returned when the token can't be generated")
+	assert.Empty(t, sl.AccessToken())
+
+	sl.GetConcept(context.Background(), "2d3e16e0-61cb-4322-8aff-3b01c59f4daa")
+	assert.Equal(t, 2, tokenRequests)
+	assert.Equal(t, "issued-token", sl.AccessToken(), "the client should generate the token with its next request")
+}
+
 func TestNewSmartlogicClient_BadJSON(t *testing.T) {
 
 	tokenResponseString := "{\"1\":}"
@@ -101,7 +130,7 @@ func TestNewSmartlogicClient_BadJSON(t *testing.T) {
 			resp:       tokenResponseString,
 			statusCode: http.StatusOK,
 			err:        nil,
-		}, "http://base/url", "modelName", "apiKey", "conceptUriPrefix",
+		}, "http://base/url", "modelName", APIKeyAuth{TokenURL: DefaultTokenURL, APIKey: "apiKey"}, "conceptUriPrefix",
 	)
 	assert.Error(t, err)
 	assert.IsType(t, &json.SyntaxError{}, err)
@@ -117,7 +146,7 @@ func TestClient_MakeRequest_Success(t *testing.T) {
 	)
 	assert.NoError(t, err)
 
-	resp, err := sl.makeRequest("GET", "http://a/url")
+	resp, err := sl.makeRequest(context.Background(), "GET", "http://a/url")
 	assert.NoError(t, err)
 
 	defer resp.Body.Close()
@@ -136,9 +165,9 @@ func TestClient_MakeRequest_Unauthorized(t *testing.T) {
 	)
 	assert.NoError(t, err)
 
-	_, err = sl.makeRequest("GET", "http://a/url")
-	assert.Error(t, err)
-	assert.EqualValues(t, errors.New("failed to get a valid access token"), err)
+	_, err = sl.makeRequest(context.Background(), "GET", "http://a/url")
+	assert.EqualError(t, err, "failed to get a valid access token")
+	assert.True(t, errors.Is(err, ErrUnauthorized))
 }
 
 func TestClient_MakeRequest_DoError(t *testing.T) {
@@ -151,9 +180,9 @@ func TestClient_MakeRequest_DoError(t *testing.T) {
 	)
 	assert.NoError(t, err)
 
-	_, err = sl.makeRequest("GET", "http://a/url")
-	assert.Error(t, err)
-	assert.EqualValues(t, errors.New("Errorfield"), err)
+	_, err = sl.makeRequest(context.Background(), "GET", "http://a/url")
+	assert.EqualError(t, err, "Errorfield")
+	assert.True(t, errors.Is(err, ErrUpstream))
 }
 
 func TestClient_MakeRequest_RequestError(t *testing.T) {
@@ -166,8 +195,40 @@ func TestClient_MakeRequest_RequestError(t *testing.T) {
 	)
 	assert.NoError(t, err)
 
-	_, err = sl.makeRequest("GET", "http:// a/url")
+	_, err = sl.makeRequest(context.Background(), "GET", "http:// a/url")
+	assert.Error(t, err)
+}
+
+func TestClient_MakeRequest_Cancelled(t *testing.T) {
+	var requested bool
+	client := mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		requested = true
+		return newMockResponse(http.StatusOK, "response"), nil
+	})
+	sl, err := NewSmartlogicClient(client, "http://base/url", "modelName", NoAuth{}, thingURIPrefix)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = sl.GetConcept(ctx, "test-uuid")
+	assert.Equal(t, context.Canceled, err)
+	assert.False(t, requested, "no request should be sent once the context is done")
+}
+
+func TestClient_MakeRequest_PassesContext(t *testing.T) {
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "value")
+	var value interface{}
+	client := mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		value = req.Context().Value(key{})
+		return newMockResponse(http.StatusNotFound, ""), nil
+	})
+	sl, err := NewSmartlogicClient(client, "http://base/url", "modelName", NoAuth{}, thingURIPrefix)
+	assert.NoError(t, err)
+
+	_, err = sl.GetConcept(ctx, "test-uuid")
 	assert.Error(t, err)
+	assert.Equal(t, "value", value)
 }
 
 func TestClient_GetConcept(t *testing.T) {
@@ -177,6 +238,7 @@ func TestClient_GetConcept(t *testing.T) {
 		slStatus      int
 		httpError     error
 		expectedError error
+		expectedCode  string
 	}{
 		{
 			name:          "success",
@@ -191,6 +253,7 @@ func TestClient_GetConcept(t *testing.T) {
 			slStatus:      http.StatusOK,
 			httpError:     errors.New("http request failed for some reason"),
 			expectedError: errors.New("some error to be returned, exact error is not relevant"),
+			expectedCode:  CodeUpstream,
 		},
 		{
 			name:          "smartlogic non-200 response",
@@ -198,6 +261,7 @@ func TestClient_GetConcept(t *testing.T) {
 			slStatus:      http.StatusInternalServerError,
 			httpError:     nil,
 			expectedError: errors.New("some error to be returned, exact error is not relevant"),
+			expectedCode:  CodeUpstream,
 		},
 		{
 			name:          "smartlogic non-existing concept response",
@@ -205,6 +269,7 @@ func TestClient_GetConcept(t *testing.T) {
 			slStatus:      http.StatusOK,
 			httpError:     nil,
 			expectedError: ErrorConceptDoesNotExist,
+			expectedCode:  CodeConceptNotFound,
 		},
 		{
 			name:          "smartlogic invalid response",
@@ -212,6 +277,7 @@ func TestClient_GetConcept(t *testing.T) {
 			slStatus:      http.StatusOK,
 			httpError:     nil,
 			expectedError: errors.New("some error to be returned, exact error is not relevant"),
+			expectedCode:  CodeMalformedResponse,
 		},
 	}
 
@@ -229,7 +295,7 @@ func TestClient_GetConcept(t *testing.T) {
 			)
 			assert.NoError(t, err)
 
-			concept, err := sl.GetConcept("test-uuid")
+			concept, err := sl.GetConcept(context.Background(), "test-uuid")
 			if err == nil && test.expectedError != nil {
 				t.Error("expected error getting concept")
 			}
@@ -243,6 +309,7 @@ func TestClient_GetConcept(t *testing.T) {
 			if test.expectedError == nil {
 				assert.Equal(t, concept, slResponse)
 			}
+			assert.Equal(t, test.expectedCode, ErrorCode(err))
 		})
 	}
 }
@@ -260,7 +327,7 @@ func TestClient_GetChangedConceptList_Success(t *testing.T) {
 	)
 	assert.NoError(t, err)
 
-	response, err := sl.GetChangedConceptList(time.Now())
+	response, err := sl.GetChangedConceptList(context.Background(), time.Now())
 	assert.NoError(t, err)
 
 	expectedResponse := []string{"testTypeMetadata", "fd55c1f0-6c5e-4869-aed4-6816836ffdb9"}
@@ -270,6 +337,43 @@ func TestClient_GetChangedConceptList_Success(t *testing.T) {
 	assert.EqualValues(t, expectedResponse, response)
 }
 
+func TestClient_GetChangedConcepts(t *testing.T) {
+	conceptResponse, err := ioutil.ReadFile("testdata/get-changed-concepts.json")
+	assert.NoError(t, err)
+
+	sl, err := NewSmartlogicTestClient(
+		&mockHTTPClient{
+			resp:       string(conceptResponse),
+			statusCode: http.StatusOK,
+		}, "http://base/url", "modelName", "apiKey", "conceptUriPrefix",
+	)
+	assert.NoError(t, err)
+
+	changes, err := sl.GetChangedConcepts(context.Background(), time.Now())
+	assert.NoError(t, err)
+
+	assert.Equal(t, []ChangedConcept{
+		{
+			URI:        "http://www.ft.com/thing/testTypeMetadata",
+			UUID:       "testTypeMetadata",
+			ChangeType: ChangeTypeDeleted,
+			Committer:  "derek.kettlety@ft.com",
+			Committed:  time.Date(2017, 6, 6, 14, 36, 28, 971000000, time.UTC),
+			ChangeID:   "urn:x-change:2017-06-06T14-36-28.971Zderek.kettlety@ft.com",
+			Namespace:  Namespace{Prefix: thingURIPrefix, Kind: "thing"},
+		},
+		{
+			URI:        "http://www.ft.com/thing/fd55c1f0-6c5e-4869-aed4-6816836ffdb9",
+			UUID:       "fd55c1f0-6c5e-4869-aed4-6816836ffdb9",
+			ChangeType: ChangeTypeUpdated,
+			Committer:  "derek.kettlety@ft.com",
+			Committed:  time.Date(2017, 6, 6, 14, 42, 11, 884000000, time.UTC),
+			ChangeID:   "urn:x-change:2017-06-06T14-42-11.884Zderek.kettlety@ft.com",
+			Namespace:  Namespace{Prefix: thingURIPrefix, Kind: "thing"},
+		},
+	}, changes)
+}
+
 func TestClient_GetChangedConceptList_RequestError(t *testing.T) {
 	conceptResponse, err := ioutil.ReadFile("testdata/get-changed-concepts.json")
 	assert.NoError(t, err)
@@ -285,9 +389,9 @@ func TestClient_GetChangedConceptList_RequestError(t *testing.T) {
 	)
 	assert.NoError(t, err)
 
-	response, err := sl.GetChangedConceptList(time.Now())
-	assert.Error(t, err)
-	assert.Equal(t, requestError, err)
+	response, err := sl.GetChangedConceptList(context.Background(), time.Now())
+	assert.True(t, errors.Is(err, requestError))
+	assert.True(t, errors.Is(err, ErrUpstream))
 	assert.Empty(t, response)
 }
 
@@ -303,9 +407,10 @@ func TestClient_GetChangedConceptList_BadResponseBody(t *testing.T) {
 	)
 	assert.NoError(t, err)
 
-	response, err := sl.GetChangedConceptList(time.Now())
-	assert.Error(t, err)
-	assert.IsType(t, &json.SyntaxError{}, err)
+	response, err := sl.GetChangedConceptList(context.Background(), time.Now())
+	var syntaxErr *json.SyntaxError
+	assert.True(t, errors.As(err, &syntaxErr))
+	assert.True(t, errors.Is(err, ErrMalformedResponse))
 	assert.Empty(t, response)
 }
 
@@ -316,13 +421,54 @@ func TestClient_buildChangesAPIQueryParams(t *testing.T) {
 	client, err := NewSmartlogicTestClient(&mockHTTPClient{}, "http://base/url", "modelName", "apiKey", "conceptUriPrefix")
 	assert.NoError(t, err)
 
-	queryParams := client.buildChangesAPIQueryParams(changeDate)
+	queryParams := client.buildChangesAPIQueryParams(changeWindow{from: changeDate}, 0)
 	assert.Contains(t, queryParams, "path")
 	assert.Equal(t, queryParams.Get("path"), "tchmodel:modelName/teamwork:Change/rdf:instance")
 
 	assert.Contains(t, queryParams, "properties")
-	assert.Equal(t, queryParams.Get("properties"), "sem:about")
+	assert.Equal(t, queryParams.Get("properties"), "sem:about,sem:committed,sioc:has_creator,teamwork:added/teamwork:subject,teamwork:added/teamwork:predicate,teamwork:deleted/teamwork:subject,teamwork:deleted/teamwork:predicate")
 
 	assert.Contains(t, queryParams, "filters")
 	assert.Equal(t, queryParams.Get("filters"), "subject(sem:committed>\"2020-04-27T00:00:00.000Z\"^^xsd:dateTime)")
 }
+
+func TestClient_ResolveConcept_OtherNamespace(t *testing.T) {
+	existing, err := ioutil.ReadFile("testdata/ft-concept.json")
+	assert.NoError(t, err)
+	nonExisting, err := ioutil.ReadFile("testdata/non-existing-concept.json")
+	assert.NoError(t, err)
+
+	locationPath := url.QueryEscape(url.QueryEscape("<" + managedLocationURIPrefix + "test-uuid>"))
+	client := mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		if strings.Contains(req.URL.RawQuery, locationPath) {
+			return newMockResponse(http.StatusOK, string(existing)), nil
+		}
+		return newMockResponse(http.StatusOK, string(nonExisting)), nil
+	})
+	sl, err := NewSmartlogicTestClient(client, "http://base/url", "modelName", "apiKey", thingURIPrefix)
+	assert.NoError(t, err)
+
+	concept, ns, err := sl.ResolveConcept(context.Background(), "test-uuid")
+	assert.NoError(t, err)
+	assert.Equal(t, "managedlocation", ns.Kind)
+	assert.Equal(t, existing, concept.Raw)
+}
+
+func TestClient_GetChangedConceptList_ConfiguredNamespaces(t *testing.T) {
+	conceptResponse, err := ioutil.ReadFile("testdata/get-changed-concepts.json")
+	assert.NoError(t, err)
+
+	sl, err := NewSmartlogicTestClient(
+		&mockHTTPClient{
+			resp:       string(conceptResponse),
+			statusCode: http.StatusOK,
+		}, "http://base/url", "modelName", "apiKey", "conceptUriPrefix",
+	)
+	assert.NoError(t, err)
+	sl.namespaces, err = NewNamespaceRegistry(Namespace{Prefix: managedLocationURIPrefix, Kind: "managedlocation"})
+	assert.NoError(t, err)
+
+	response, err := sl.GetChangedConceptList(context.Background(), time.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, response, "concepts outside of the configured namespaces are not returned")
+}
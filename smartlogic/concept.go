@@ -0,0 +1,203 @@
+package smartlogic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	prefLabelProperty  = "skosxl:prefLabel"
+	altLabelProperty   = "skosxl:altLabel"
+	shortLabelProperty = "http://www.ft.com/ontology/shortLabel"
+	guidProperty       = "sem:guid"
+	identifierSuffix   = "Identifier"
+)
+
+// Literal is a, possibly language tagged, value of a concept property.
+type Literal struct {
+	Value    string `json:"value"`
+	Language string `json:"language,omitempty"`
+}
+
+// Concept is the typed view of the Smartlogic JSON-LD representation of a concept.
+// The representation it was parsed from is kept as it is, so the concept can be published without any loss.
+type Concept struct {
+	URI         string
+	UUID        string
+	Types       []string
+	PrefLabels  []Literal
+	AltLabels   []Literal
+	ShortLabels []Literal
+	// Identifiers holds the values of the identifier properties, keyed by their local name, e.g. TMEIdentifier.
+	Identifiers map[string][]string
+	// Relations holds the URIs of the related resources, keyed by the local name of the property, e.g. hasSubBrand.
+	Relations map[string][]string
+	// Raw is the JSON-LD document the concept was parsed from.
+	Raw []byte
+}
+
+// jsonLDValue is a value of a JSON-LD property, which is either a literal or a reference to another resource.
+type jsonLDValue struct {
+	ID          string        `json:"@id"`
+	Value       string        `json:"@value"`
+	Language    string        `json:"@language"`
+	LiteralForm []jsonLDValue `json:"skosxl:literalForm"`
+}
+
+// ParseConcept parses the Smartlogic JSON-LD representation of a concept.
+// As Smartlogic returns a representation only with an @id for concepts which don't exist,
+// ErrorConceptDoesNotExist is returned for such representations.
+func ParseConcept(data []byte) (*Concept, error) {
+	doc := struct {
+		Graph []map[string]json.RawMessage `json:"@graph"`
+	}{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse Smartlogic response: %w", err)
+	}
+	if len(doc.Graph) == 0 {
+		return nil, errors.New("invalid Smartlogic concept response")
+	}
+
+	// the json-ld representation of existing concept has "sem:guid" value, as oppose to the json-ld representation of
+	// non-existing concept that only has @id property
+	node := doc.Graph[0]
+	guid, err := literals(node[guidProperty])
+	if err != nil {
+		return nil, err
+	}
+	if len(guid) == 0 || guid[0].Value == "" {
+		return nil, ErrorConceptDoesNotExist
+	}
+
+	concept := &Concept{
+		UUID:        guid[0].Value,
+		Identifiers: map[string][]string{},
+		Relations:   map[string][]string{},
+		Raw:         data,
+	}
+	if err := unmarshalIfPresent(node["@id"], &concept.URI); err != nil {
+		return nil, err
+	}
+	if err := unmarshalIfPresent(node["@type"], &concept.Types); err != nil {
+		return nil, err
+	}
+	if concept.PrefLabels, err = labels(node[prefLabelProperty]); err != nil {
+		return nil, err
+	}
+	if concept.AltLabels, err = labels(node[altLabelProperty]); err != nil {
+		return nil, err
+	}
+	if concept.ShortLabels, err = labels(node[shortLabelProperty]); err != nil {
+		return nil, err
+	}
+
+	for property, raw := range node {
+		if strings.HasPrefix(property, "@") || isLabelProperty(property) || property == guidProperty {
+			continue
+		}
+		var values []jsonLDValue
+		if err := json.Unmarshal(raw, &values); err != nil {
+			// not a list of values, so neither an identifier nor a relation
+			continue
+		}
+		name := localName(property)
+		for _, v := range values {
+			switch {
+			case v.ID != "" && v.Value == "":
+				concept.Relations[name] = append(concept.Relations[name], v.ID)
+			case strings.HasSuffix(name, identifierSuffix) && v.Value != "":
+				concept.Identifiers[name] = append(concept.Identifiers[name], v.Value)
+			}
+		}
+	}
+	return concept, nil
+}
+
+// MarshalJSON returns the JSON-LD representation the concept was parsed from.
+func (c *Concept) MarshalJSON() ([]byte, error) {
+	if c.Raw == nil {
+		return nil, errors.New("concept has no JSON-LD representation")
+	}
+	return c.Raw, nil
+}
+
+// PrefLabel returns the preferred label of the concept in the given language,
+// or the first preferred label if there is none in that language.
+func (c *Concept) PrefLabel(language string) string {
+	for _, l := range c.PrefLabels {
+		if l.Language == language {
+			return l.Value
+		}
+	}
+	if len(c.PrefLabels) > 0 {
+		return c.PrefLabels[0].Value
+	}
+	return ""
+}
+
+// Related returns the URIs of the resources the concept is related to via the given property.
+// The property can be given either with its full name or with its local name, e.g. hasSubBrand.
+func (c *Concept) Related(property string) []string {
+	return c.Relations[localName(property)]
+}
+
+// HasType returns whether the concept is of the given type, given either with its IRI or with its local name, e.g. Person.
+func (c *Concept) HasType(t string) bool {
+	for _, ct := range c.Types {
+		if ct == t || localName(ct) == t {
+			return true
+		}
+	}
+	return false
+}
+
+func isLabelProperty(property string) bool {
+	return property == prefLabelProperty || property == altLabelProperty || property == shortLabelProperty
+}
+
+// localName returns the part of a property name after the last "/", "#" or ":".
+func localName(property string) string {
+	if i := strings.LastIndexAny(property, "/#:"); i >= 0 && i < len(property)-1 {
+		return property[i+1:]
+	}
+	return property
+}
+
+func unmarshalIfPresent(raw json.RawMessage, v interface{}) error {
+	if raw == nil {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("failed to parse Smartlogic concept: %w", err)
+	}
+	return nil
+}
+
+func literals(raw json.RawMessage) ([]Literal, error) {
+	var values []jsonLDValue
+	if err := unmarshalIfPresent(raw, &values); err != nil {
+		return nil, err
+	}
+	var out []Literal
+	for _, v := range values {
+		out = append(out, Literal{Value: v.Value, Language: v.Language})
+	}
+	return out, nil
+}
+
+// labels returns the literal forms of SKOS-XL labels. Labels without a literal form in the representation are skipped.
+func labels(raw json.RawMessage) ([]Literal, error) {
+	var values []jsonLDValue
+	if err := unmarshalIfPresent(raw, &values); err != nil {
+		return nil, err
+	}
+	var out []Literal
+	for _, v := range values {
+		for _, form := range v.LiteralForm {
+			out = append(out, Literal{Value: form.Value, Language: form.Language})
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,120 @@
+package smartlogic
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConcept(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/get-concept.json")
+	assert.NoError(t, err)
+
+	concept, err := ParseConcept(data)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "http://www.ft.com/thing/2d3e16e0-61cb-4322-8aff-3b01c59f4daa", concept.URI)
+	assert.Equal(t, "2d3e16e0-61cb-4322-8aff-3b01c59f4daa", concept.UUID)
+	assert.Equal(t, []string{"http://www.ft.com/ontology/product/Brand"}, concept.Types)
+	assert.Equal(t, []Literal{{Value: "Lex", Language: "en"}}, concept.PrefLabels)
+	assert.Equal(t, "Lex", concept.PrefLabel("en"))
+	assert.Empty(t, concept.AltLabels)
+	assert.Equal(t, map[string][]string{
+		"TMEIdentifier": {"YzhlNzZkYTctMDJiNy00NTViLTk3NmYtNmJjYTE5NDEyM2Yw-QnJhbmRz"},
+	}, concept.Identifiers)
+	assert.Equal(t, []string{"http://www.ft.com/thing/e363dfb8-f6d9-4f2c-beba-5162b334272b"}, concept.Related("hasSubBrand"))
+	assert.Equal(t, []string{"http://www.ft.com/thing/dbb0bdae-1f0c-11e4-b0cb-b2227cce2b54"}, concept.Related("http://www.ft.com/ontology/subBrandOf"))
+	assert.NotContains(t, concept.Relations, "prefLabel")
+}
+
+func TestParseConcept_LabelsAndIdentifiers(t *testing.T) {
+	data := []byte(`{"@graph": [{
+		"@id": "http://www.ft.com/thing/test-uuid",
+		"@type": ["http://www.ft.com/ontology/person/Person"],
+		"sem:guid": [{"@value": "test-uuid"}],
+		"skosxl:prefLabel": [{"@id": "label1", "skosxl:literalForm": [{"@language": "en", "@value": "Label"}, {"@language": "fr", "@value": "Etiquette"}]}],
+		"skosxl:altLabel": [{"@id": "label2", "skosxl:literalForm": [{"@language": "en", "@value": "Alternative"}]}],
+		"http://www.ft.com/ontology/shortLabel": [{"@id": "label3", "skosxl:literalForm": [{"@value": "Short"}]}],
+		"http://www.ft.com/ontology/factsetIdentifier": [{"@value": "000C7F-E"}],
+		"http://www.ft.com/ontology/TMEIdentifier": [{"@value": "tme1"}, {"@value": "tme2"}]
+	}]}`)
+
+	concept, err := ParseConcept(data)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []Literal{{Value: "Label", Language: "en"}, {Value: "Etiquette", Language: "fr"}}, concept.PrefLabels)
+	assert.Equal(t, "Etiquette", concept.PrefLabel("fr"))
+	assert.Equal(t, "Label", concept.PrefLabel("de"))
+	assert.Equal(t, []Literal{{Value: "Alternative", Language: "en"}}, concept.AltLabels)
+	assert.Equal(t, []Literal{{Value: "Short"}}, concept.ShortLabels)
+	assert.Equal(t, []string{"000C7F-E"}, concept.Identifiers["factsetIdentifier"])
+	assert.Equal(t, []string{"tme1", "tme2"}, concept.Identifiers["TMEIdentifier"])
+	assert.Empty(t, concept.Relations)
+}
+
+func TestParseConcept_LabelWithoutLiteralForm(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/ft-concept.json")
+	assert.NoError(t, err)
+
+	concept, err := ParseConcept(data)
+	assert.NoError(t, err)
+	assert.Empty(t, concept.PrefLabels)
+	assert.Equal(t, "", concept.PrefLabel("en"))
+}
+
+func TestParseConcept_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		errorMsg string
+	}{
+		{
+			name:     "Non-existing concept",
+			file:     "testdata/non-existing-concept.json",
+			errorMsg: ErrorConceptDoesNotExist.Error(),
+		},
+		{
+			name:     "Invalid concept",
+			file:     "testdata/invalid-concept.json",
+			errorMsg: "invalid Smartlogic concept response",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := ioutil.ReadFile(test.file)
+			assert.NoError(t, err)
+
+			_, err = ParseConcept(data)
+			assert.EqualError(t, err, test.errorMsg)
+		})
+	}
+
+	_, err := ParseConcept([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestConcept_MarshalJSON_RoundTrip(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/get-concept.json")
+	assert.NoError(t, err)
+
+	concept, err := ParseConcept(data)
+	assert.NoError(t, err)
+
+	out, err := json.Marshal(concept)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(data), string(out))
+
+	_, err = json.Marshal(&Concept{UUID: "test-uuid"})
+	assert.Error(t, err)
+}
+
+func TestConcept_HasType(t *testing.T) {
+	concept := &Concept{Types: []string{"http://www.ft.com/ontology/person/Person", "skos:Concept"}}
+	assert.True(t, concept.HasType("http://www.ft.com/ontology/person/Person"))
+	assert.True(t, concept.HasType("Person"))
+	assert.True(t, concept.HasType("Concept"))
+	assert.False(t, concept.HasType("Organisation"))
+}
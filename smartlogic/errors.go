@@ -0,0 +1,117 @@
+package smartlogic
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// Kinds of the errors returned by the client, which can be tested with errors.Is.
+var (
+	ErrUnauthorized      = errors.New("smartlogic rejected the credentials")
+	ErrUpstream          = errors.New("smartlogic returned an error")
+	ErrTimeout           = errors.New("smartlogic timed out")
+	ErrMalformedResponse = errors.New("invalid Smartlogic response")
+	ErrRateLimited       = errors.New("smartlogic rate limit exceeded")
+)
+
+// Machine readable codes of the errors, see ErrorCode.
+const (
+	CodeConceptNotFound   = "concept_not_found"
+	CodeUnauthorized      = "unauthorized"
+	CodeUpstream          = "upstream_error"
+	CodeTimeout           = "timeout"
+	CodeMalformedResponse = "malformed_response"
+	CodeRateLimited       = "rate_limited"
+	CodeCircuitOpen       = "circuit_open"
+)
+
+// Error is an error talking to Smartlogic, classified by its kind.
+type Error struct {
+	// Kind is one of the ErrXxx errors of the package.
+	Kind error
+	// StatusCode is the status of the Smartlogic response, if any.
+	StatusCode int
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Kind.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// ErrorCode returns the machine readable code of the kind of the error, or an empty string when the error
+// wasn't caused by Smartlogic.
+func ErrorCode(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrorConceptDoesNotExist):
+		return CodeConceptNotFound
+	case errors.Is(err, ErrCircuitOpen):
+		return CodeCircuitOpen
+	case errors.Is(err, ErrRateLimited):
+		return CodeRateLimited
+	case errors.Is(err, ErrUnauthorized):
+		return CodeUnauthorized
+	case errors.Is(err, ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return CodeTimeout
+	case errors.Is(err, ErrMalformedResponse):
+		return CodeMalformedResponse
+	case errors.Is(err, ErrUpstream):
+		return CodeUpstream
+	}
+	return ""
+}
+
+// requestError classifies an error making a request to Smartlogic.
+func requestError(err error) error {
+	var classified *Error
+	switch {
+	case errors.As(err, &classified), errors.Is(err, ErrCircuitOpen), errors.Is(err, context.Canceled):
+		return err
+	case isTimeout(err):
+		return &Error{Kind: ErrTimeout, Err: err}
+	}
+	return &Error{Kind: ErrUpstream, Err: err}
+}
+
+// responseError classifies an error response of Smartlogic.
+func responseError(statusCode int, err error) error {
+	kind := ErrUpstream
+	switch statusCode {
+	case http.StatusTooManyRequests:
+		kind = ErrRateLimited
+	case http.StatusUnauthorized, http.StatusForbidden:
+		kind = ErrUnauthorized
+	}
+	return &Error{Kind: kind, StatusCode: statusCode, Err: err}
+}
+
+// bodyError classifies an error reading or decoding the body of a Smartlogic response, which is malformed
+// unless the request timed out or was cancelled on the way.
+func bodyError(err error) error {
+	if errors.Is(err, context.Canceled) || isTimeout(err) {
+		return requestError(err)
+	}
+	return &Error{Kind: ErrMalformedResponse, Err: err}
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,62 @@
+package smartlogic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{name: "No error"},
+		{name: "Unknown error", err: errors.New("some error")},
+		{name: "Concept not found", err: fmt.Errorf("wrapped: %w", ErrorConceptDoesNotExist), expected: CodeConceptNotFound},
+		{name: "Circuit open", err: ErrCircuitOpen, expected: CodeCircuitOpen},
+		{name: "Deadline exceeded", err: context.DeadlineExceeded, expected: CodeTimeout},
+		{name: "Network timeout", err: requestError(&url.Error{Op: "Get", URL: "http://smartlogic", Err: timeoutError{}}), expected: CodeTimeout},
+		{name: "Connection refused", err: requestError(errors.New("connection refused")), expected: CodeUpstream},
+		{name: "Server error", err: responseError(http.StatusBadGateway, errors.New("bad gateway")), expected: CodeUpstream},
+		{name: "Throttled", err: responseError(http.StatusTooManyRequests, errors.New("throttled")), expected: CodeRateLimited},
+		{name: "Forbidden", err: responseError(http.StatusForbidden, errors.New("forbidden")), expected: CodeUnauthorized},
+		{name: "Invalid body", err: bodyError(errors.New("unexpected end of JSON input")), expected: CodeMalformedResponse},
+		{name: "Body timed out", err: bodyError(context.DeadlineExceeded), expected: CodeTimeout},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, ErrorCode(test.err))
+		})
+	}
+}
+
+func TestRequestError_KeepsClassifiedErrors(t *testing.T) {
+	throttled := responseError(http.StatusTooManyRequests, errors.New("throttled"))
+	assert.Equal(t, throttled, requestError(throttled))
+	assert.Equal(t, ErrCircuitOpen, requestError(ErrCircuitOpen))
+	assert.Equal(t, context.Canceled, requestError(context.Canceled))
+}
+
+func TestError(t *testing.T) {
+	cause := errors.New("smartlogic returned status 503")
+	err := error(&Error{Kind: ErrUpstream, StatusCode: http.StatusServiceUnavailable, Err: cause})
+	assert.EqualError(t, err, "smartlogic returned status 503")
+	assert.True(t, errors.Is(err, ErrUpstream))
+	assert.True(t, errors.Is(err, cause))
+	assert.False(t, errors.Is(err, ErrTimeout))
+	assert.EqualError(t, &Error{Kind: ErrTimeout}, ErrTimeout.Error())
+}
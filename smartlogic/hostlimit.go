@@ -0,0 +1,73 @@
+package smartlogic
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// HostLimitedClient wraps a HTTPClient limiting the number of requests in flight to each host.
+// A request holds its slot until its response body is closed, so callers must always close it.
+type HostLimitedClient struct {
+	client HTTPClient
+	limit  int
+	mu     sync.Mutex
+	slots  map[string]chan struct{}
+}
+
+// NewHostLimitedClient returns a client allowing at most limit concurrent requests per host.
+// A limit lower than 1 is treated as 1.
+func NewHostLimitedClient(client HTTPClient, limit int) *HostLimitedClient {
+	if limit < 1 {
+		limit = 1
+	}
+	return &HostLimitedClient{
+		client: client,
+		limit:  limit,
+		slots:  map[string]chan struct{}{},
+	}
+}
+
+// Do makes the request once a slot of its host is free. It gives up waiting for a slot when the context of the request
+// is done.
+func (c *HostLimitedClient) Do(req *http.Request) (*http.Response, error) {
+	slots := c.slotsFor(req.URL.Host)
+	select {
+	case slots <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	release := func() { <-slots }
+
+	resp, err := c.client.Do(req)
+	if err != nil || resp == nil || resp.Body == nil {
+		release()
+		return resp, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+func (c *HostLimitedClient) slotsFor(host string) chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	slots, ok := c.slots[host]
+	if !ok {
+		slots = make(chan struct{}, c.limit)
+		c.slots[host] = slots
+	}
+	return slots
+}
+
+// releasingBody gives the slot of the request back once the response body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,111 @@
+package smartlogic
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostLimitedClient_LimitsRequestsPerHost(t *testing.T) {
+	var mu sync.Mutex
+	inFlight := map[string]int{}
+	maxInFlight := map[string]int{}
+
+	client := NewHostLimitedClient(mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		inFlight[req.URL.Host]++
+		if inFlight[req.URL.Host] > maxInFlight[req.URL.Host] {
+			maxInFlight[req.URL.Host] = inFlight[req.URL.Host]
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		inFlight[req.URL.Host]--
+		mu.Unlock()
+		return newMockResponse(http.StatusOK, "{}"), nil
+	}), 2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		for _, host := range []string{"http://first", "http://second"} {
+			wg.Add(1)
+			go func(host string) {
+				defer wg.Done()
+				req, _ := http.NewRequest("GET", host+"/path", nil)
+				resp, err := client.Do(req)
+				assert.NoError(t, err)
+				resp.Body.Close()
+			}(host)
+		}
+	}
+	wg.Wait()
+
+	assert.Equal(t, map[string]int{"first": 2, "second": 2}, maxInFlight)
+}
+
+func TestHostLimitedClient_HoldsSlotUntilBodyIsClosed(t *testing.T) {
+	client := NewHostLimitedClient(mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		return newMockResponse(http.StatusOK, "{}"), nil
+	}), 1)
+
+	req, _ := http.NewRequest("GET", "http://host/path", nil)
+	first, err := client.Do(req)
+	assert.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		second, err := client.Do(req)
+		assert.NoError(t, err)
+		second.Body.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("the second request should wait for the body of the first one to be closed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	first.Body.Close()
+	first.Body.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the second request should be made once the first body is closed")
+	}
+}
+
+func TestHostLimitedClient_CancelledWhileWaitingForSlot(t *testing.T) {
+	client := NewHostLimitedClient(mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		return newMockResponse(http.StatusOK, "{}"), nil
+	}), 1)
+
+	req, _ := http.NewRequest("GET", "http://host/path", nil)
+	first, err := client.Do(req)
+	assert.NoError(t, err)
+	defer first.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = client.Do(req.WithContext(ctx))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "the request should stop waiting for a slot once its context is done")
+}
+
+func TestHostLimitedClient_ReleasesSlotOnError(t *testing.T) {
+	client := NewHostLimitedClient(mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	}), 1)
+
+	req, _ := http.NewRequest("GET", "http://host/path", nil)
+	for i := 0; i < 3; i++ {
+		_, err := client.Do(req)
+		assert.Error(t, err)
+	}
+}
@@ -16,3 +16,17 @@ func (c mockHTTPClient) Do(req *http.Request) (resp *http.Response, err error) {
 	cb := ioutil.NopCloser(bytes.NewReader([]byte(c.resp)))
 	return &http.Response{Body: cb, StatusCode: c.statusCode}, c.err
 }
+
+type mockHTTPClientFunc func(req *http.Request) (*http.Response, error)
+
+func (f mockHTTPClientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newMockResponse(statusCode int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(body))),
+	}
+}
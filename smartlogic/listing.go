@@ -0,0 +1,95 @@
+package smartlogic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultConceptsPageSize is the number of concepts requested per page when listing the concepts of a model.
+const DefaultConceptsPageSize = 500
+
+// WithConceptsPageSize sets the number of concepts requested per page by ListConcepts.
+func WithConceptsPageSize(size int) func(*Client) {
+	return func(c *Client) {
+		if size > 0 {
+			c.conceptsPageSize = size
+		}
+	}
+}
+
+// ListConcepts pages through all the concepts of the model, passing the UUIDs of the concepts of each page to visit.
+// Listing stops at the first error returned by visit, which is then returned.
+func (c *Client) ListConcepts(ctx context.Context, visit func(uuids []string) error) error {
+	offset := 0
+	for {
+		uuids, count, err := c.getConceptsPage(ctx, offset)
+		if err != nil {
+			return err
+		}
+		if len(uuids) > 0 {
+			if err := visit(uuids); err != nil {
+				return err
+			}
+		}
+		if count < c.conceptsPageSize {
+			return nil
+		}
+		offset += count
+	}
+}
+
+// getConceptsPage returns the UUIDs of a page of the concepts of the model, together with the number of
+// resources in the page.
+func (c *Client) getConceptsPage(ctx context.Context, offset int) ([]string, int, error) {
+	reqURL := c.baseURL
+	reqURL.RawQuery = c.buildConceptsListQueryParams(offset).Encode()
+
+	entry := log.WithField("method", "ListConcepts").WithField("offset", offset)
+	entry.Debugf("Smartlogic Concepts List Request URL: %v", reqURL.String())
+	resp, err := c.makeRequest(ctx, "GET", reqURL.String())
+	if err != nil {
+		entry.WithError(err).Error("Error creating the request")
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = responseError(resp.StatusCode, fmt.Errorf("smartlogic returned status %v listing the concepts", resp.StatusCode))
+		entry.WithError(err).Error("Error response returned")
+		return nil, 0, err
+	}
+
+	var uuids []string
+	count, err := decodeGraph(resp.Body, func(dec *json.Decoder) error {
+		var node jsonLDValue
+		if err := dec.Decode(&node); err != nil {
+			return err
+		}
+		if _, uuid, ok := c.namespaces.Match(node.ID); ok {
+			uuids = append(uuids, uuid)
+		}
+		return nil
+	})
+	if err != nil {
+		entry.WithError(err).Error("Error decoding the response body")
+		return nil, 0, bodyError(err)
+	}
+	return uuids, count, nil
+}
+
+// buildConceptsListQueryParams returns the query params of the request to the Smartlogic API that returns a page
+// of the concepts of the model. Only the ids of the concepts are requested.
+func (c *Client) buildConceptsListQueryParams(offset int) url.Values {
+	queryParams := url.Values{}
+	queryParams.Add("path", fmt.Sprintf("model:%s/skos:Concept/meta:transitiveInstance", c.model))
+	queryParams.Add("properties", "sem:guid")
+	queryParams.Add("limit", strconv.Itoa(c.conceptsPageSize))
+	queryParams.Add("offset", strconv.Itoa(offset))
+	return queryParams
+}
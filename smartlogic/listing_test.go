@@ -0,0 +1,81 @@
+package smartlogic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_ListConcepts(t *testing.T) {
+	const total = 5
+	var queries []string
+	client := mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		queries = append(queries, req.URL.Query().Get("path"))
+		offset, _ := strconv.Atoi(req.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(req.URL.Query().Get("limit"))
+
+		all := []string{`{"@id": "http://www.ft.com/thing/ConceptScheme/scheme"}`}
+		for i := 0; i < total; i++ {
+			all = append(all, fmt.Sprintf(`{"@id": "http://www.ft.com/thing/uuid%d", "sem:guid": [{"@value": "uuid%d"}]}`, i, i))
+		}
+		var nodes []string
+		for i := offset; i < len(all) && i < offset+limit; i++ {
+			nodes = append(nodes, all[i])
+		}
+		return newMockResponse(http.StatusOK, `{"@graph": [`+strings.Join(nodes, ",")+`]}`), nil
+	})
+
+	sl, err := NewSmartlogicClient(client, "http://base/url", "modelName", NoAuth{}, thingURIPrefix, WithConceptsPageSize(2))
+	assert.NoError(t, err)
+
+	var pages [][]string
+	err = sl.ListConcepts(context.Background(), func(uuids []string) error {
+		pages = append(pages, uuids)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"uuid0"}, {"uuid1", "uuid2"}, {"uuid3", "uuid4"}}, pages)
+	assert.Equal(t, "model:modelName/skos:Concept/meta:transitiveInstance", queries[0])
+}
+
+func TestClient_ListConcepts_Errors(t *testing.T) {
+	visitErr := errors.New("stop")
+	tests := []struct {
+		name          string
+		statusCode    int
+		body          string
+		visit         func([]string) error
+		expectedError string
+	}{
+		{
+			name:          "Error response",
+			statusCode:    http.StatusInternalServerError,
+			body:          `{}`,
+			visit:         func([]string) error { return nil },
+			expectedError: "smartlogic returned status 500 listing the concepts",
+		},
+		{
+			name:          "Visit error",
+			statusCode:    http.StatusOK,
+			body:          `{"@graph": [{"@id": "http://www.ft.com/thing/uuid1"}]}`,
+			visit:         func([]string) error { return visitErr },
+			expectedError: "stop",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sl, err := NewSmartlogicClient(&mockHTTPClient{resp: test.body, statusCode: test.statusCode}, "http://base/url", "modelName", NoAuth{}, thingURIPrefix)
+			assert.NoError(t, err)
+
+			err = sl.ListConcepts(context.Background(), test.visit)
+			assert.EqualError(t, err, test.expectedError)
+		})
+	}
+}
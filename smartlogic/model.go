@@ -1,13 +1,113 @@
 package smartlogic
 
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Types of the changes made to a concept.
+const (
+	ChangeTypeCreated = "created"
+	ChangeTypeUpdated = "updated"
+	ChangeTypeDeleted = "deleted"
+)
+
+const (
+	rdfTypePredicate = "rdf:type"
+	userURIPrefix    = "user:"
+)
+
 type Graph struct {
 	Changesets []Changeset `json:"@graph"`
 }
 
+// Changeset is a teamwork:Change of the Smartlogic change log.
 type Changeset struct {
-	Concepts []ChangedConcept `json:"sem:about"`
+	ID        string        `json:"@id"`
+	Concepts  []jsonLDValue `json:"sem:about"`
+	Committed []jsonLDValue `json:"sem:committed"`
+	Creator   []jsonLDValue `json:"sioc:has_creator"`
+	Added     []Triple      `json:"teamwork:added"`
+	Deleted   []Triple      `json:"teamwork:deleted"`
+}
+
+// Triple is a statement added or deleted by a change.
+type Triple struct {
+	Subject   []jsonLDValue `json:"teamwork:subject"`
+	Predicate []jsonLDValue `json:"teamwork:predicate"`
 }
 
+// ChangedConcept describes the latest change made to a concept.
 type ChangedConcept struct {
-	URI string `json:"@id"`
+	URI        string    `json:"uri"`
+	UUID       string    `json:"uuid"`
+	ChangeType string    `json:"changeType"`
+	Committer  string    `json:"committer,omitempty"`
+	Committed  time.Time `json:"committed"`
+	ChangeID   string    `json:"changeId,omitempty"`
+	// Namespace is the namespace the concept URI belongs to.
+	Namespace Namespace `json:"-"`
+}
+
+// CommittedAt returns the time the change was committed, which is zero if Smartlogic didn't return it.
+func (c Changeset) CommittedAt() time.Time {
+	if len(c.Committed) == 0 {
+		return time.Time{}
+	}
+	committed, err := time.Parse(time.RFC3339Nano, c.Committed[0].Value)
+	if err != nil {
+		return time.Time{}
+	}
+	return committed
+}
+
+// Committer returns the Smartlogic user who committed the change, e.g. "jane.doe@ft.com".
+func (c Changeset) Committer() string {
+	if len(c.Creator) == 0 {
+		return ""
+	}
+	user := strings.TrimPrefix(c.Creator[0].ID, userURIPrefix)
+	if unescaped, err := url.PathUnescape(user); err == nil {
+		return unescaped
+	}
+	return user
+}
+
+// ChangeType returns whether the change created, updated or deleted the concept with the given URI.
+// Creating and deleting a concept respectively add and delete the rdf:type statement of the concept.
+func (c Changeset) ChangeType(uri string) string {
+	switch {
+	case hasTypeStatement(c.Added, uri):
+		return ChangeTypeCreated
+	case hasTypeStatement(c.Deleted, uri):
+		return ChangeTypeDeleted
+	}
+	return ChangeTypeUpdated
+}
+
+func hasTypeStatement(triples []Triple, uri string) bool {
+	for _, t := range triples {
+		if len(t.Subject) == 0 || len(t.Predicate) == 0 {
+			continue
+		}
+		if t.Subject[0].ID == uri && t.Predicate[0].ID == rdfTypePredicate {
+			return true
+		}
+	}
+	return false
+}
+
+// merge records a later change of the concept. The latest change wins, except that a concept created and then
+// updated is still reported as created.
+func (c *ChangedConcept) merge(later ChangedConcept) {
+	if later.Committed.Before(c.Committed) {
+		return
+	}
+	changeType := later.ChangeType
+	if c.ChangeType == ChangeTypeCreated && changeType == ChangeTypeUpdated {
+		changeType = ChangeTypeCreated
+	}
+	*c = later
+	c.ChangeType = changeType
 }
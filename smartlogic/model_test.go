@@ -0,0 +1,102 @@
+package smartlogic
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeset(t *testing.T) {
+	tests := []struct {
+		name              string
+		changeset         string
+		expectedType      string
+		expectedCommitter string
+		expectedCommitted time.Time
+	}{
+		{
+			name: "Created",
+			changeset: `{
+				"sem:about": [{"@id": "http://www.ft.com/thing/uuid1"}],
+				"sem:committed": [{"@type": "xsd:dateTime", "@value": "2020-04-27T10:00:00.123Z"}],
+				"sioc:has_creator": [{"@id": "user:jane.doe%40ft.com"}],
+				"teamwork:added": [
+					{"teamwork:subject": [{"@id": "http://www.ft.com/thing/uuid1"}], "teamwork:predicate": [{"@id": "sem:guid"}]},
+					{"teamwork:subject": [{"@id": "http://www.ft.com/thing/uuid1"}], "teamwork:predicate": [{"@id": "rdf:type"}]}
+				]
+			}`,
+			expectedType:      ChangeTypeCreated,
+			expectedCommitter: "jane.doe@ft.com",
+			expectedCommitted: time.Date(2020, 4, 27, 10, 0, 0, 123000000, time.UTC),
+		},
+		{
+			name: "Deleted",
+			changeset: `{
+				"sem:about": [{"@id": "http://www.ft.com/thing/uuid1"}],
+				"teamwork:deleted": [{"teamwork:subject": [{"@id": "http://www.ft.com/thing/uuid1"}], "teamwork:predicate": [{"@id": "rdf:type"}]}]
+			}`,
+			expectedType: ChangeTypeDeleted,
+		},
+		{
+			name: "Updated",
+			changeset: `{
+				"sem:about": [{"@id": "http://www.ft.com/thing/uuid1"}],
+				"teamwork:added": [{"teamwork:subject": [{"@id": "http://www.ft.com/thing/uuid2"}], "teamwork:predicate": [{"@id": "rdf:type"}]}],
+				"teamwork:deleted": [{"teamwork:subject": [{"@id": "http://www.ft.com/thing/uuid1"}], "teamwork:predicate": [{"@id": "rdfs:label"}]}]
+			}`,
+			expectedType: ChangeTypeUpdated,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var changeset Changeset
+			assert.NoError(t, json.Unmarshal([]byte(test.changeset), &changeset))
+
+			assert.Equal(t, test.expectedType, changeset.ChangeType("http://www.ft.com/thing/uuid1"))
+			assert.Equal(t, test.expectedCommitter, changeset.Committer())
+			assert.True(t, test.expectedCommitted.Equal(changeset.CommittedAt()))
+		})
+	}
+}
+
+func TestChangedConcept_merge(t *testing.T) {
+	earlier := time.Date(2020, 4, 27, 10, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Minute)
+
+	tests := []struct {
+		name     string
+		first    ChangedConcept
+		second   ChangedConcept
+		expected ChangedConcept
+	}{
+		{
+			name:     "Later change wins",
+			first:    ChangedConcept{ChangeType: ChangeTypeUpdated, Committer: "first", Committed: earlier},
+			second:   ChangedConcept{ChangeType: ChangeTypeDeleted, Committer: "second", Committed: later},
+			expected: ChangedConcept{ChangeType: ChangeTypeDeleted, Committer: "second", Committed: later},
+		},
+		{
+			name:     "Earlier change is ignored",
+			first:    ChangedConcept{ChangeType: ChangeTypeUpdated, Committer: "first", Committed: later},
+			second:   ChangedConcept{ChangeType: ChangeTypeDeleted, Committer: "second", Committed: earlier},
+			expected: ChangedConcept{ChangeType: ChangeTypeUpdated, Committer: "first", Committed: later},
+		},
+		{
+			name:     "Created and then updated",
+			first:    ChangedConcept{ChangeType: ChangeTypeCreated, Committer: "first", Committed: earlier},
+			second:   ChangedConcept{ChangeType: ChangeTypeUpdated, Committer: "second", Committed: later},
+			expected: ChangedConcept{ChangeType: ChangeTypeCreated, Committer: "second", Committed: later},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			change := test.first
+			change.merge(test.second)
+			assert.Equal(t, test.expected, change)
+		})
+	}
+}
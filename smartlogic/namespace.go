@@ -0,0 +1,101 @@
+package smartlogic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	thingURIPrefix           = "http://www.ft.com/thing/"
+	managedLocationURIPrefix = "http://www.ft.com/ontology/managedlocation/"
+)
+
+// Namespace is a URI space in which Smartlogic concepts live. The UUID of a concept is the part of its URI after the prefix.
+type Namespace struct {
+	Prefix string `json:"prefix"`
+	// Kind describes the kind of concepts in the namespace, e.g. "thing" or "managedlocation".
+	Kind string `json:"kind"`
+	// Topic is the Kafka topic the concepts of the namespace are published to. Empty means the default topic.
+	Topic string `json:"topic,omitempty"`
+}
+
+// DefaultNamespaces returns the namespaces recognised when none are configured.
+func DefaultNamespaces() []Namespace {
+	return []Namespace{
+		{Prefix: thingURIPrefix, Kind: "thing"},
+		{Prefix: managedLocationURIPrefix, Kind: "managedlocation"},
+	}
+}
+
+// NamespaceRegistry holds the namespaces concepts are looked up in.
+type NamespaceRegistry struct {
+	namespaces []Namespace
+}
+
+// NewNamespaceRegistry creates a registry of the given namespaces, which are tried in order when resolving a UUID.
+func NewNamespaceRegistry(namespaces ...Namespace) (*NamespaceRegistry, error) {
+	seen := map[string]bool{}
+	for _, ns := range namespaces {
+		if ns.Prefix == "" {
+			return nil, errors.New("namespace prefix is required")
+		}
+		if seen[ns.Prefix] {
+			return nil, fmt.Errorf("namespace %s is configured more than once", ns.Prefix)
+		}
+		seen[ns.Prefix] = true
+	}
+	return &NamespaceRegistry{namespaces: append([]Namespace(nil), namespaces...)}, nil
+}
+
+// ParseNamespaces reads a list of namespaces from its JSON representation.
+func ParseNamespaces(data string) ([]Namespace, error) {
+	var namespaces []Namespace
+	if err := json.Unmarshal([]byte(data), &namespaces); err != nil {
+		return nil, fmt.Errorf("failed to parse the namespaces configuration: %w", err)
+	}
+	return namespaces, nil
+}
+
+// Namespaces returns the namespaces in the order they are tried.
+func (r *NamespaceRegistry) Namespaces() []Namespace {
+	return append([]Namespace(nil), r.namespaces...)
+}
+
+// Match returns the namespace a concept URI belongs to, together with the UUID part of the URI.
+// When several prefixes match, the longest one wins. Concept scheme URIs never match.
+func (r *NamespaceRegistry) Match(uri string) (Namespace, string, bool) {
+	if strings.Contains(uri, "ConceptScheme") {
+		return Namespace{}, "", false
+	}
+	var match Namespace
+	found := false
+	for _, ns := range r.namespaces {
+		if strings.HasPrefix(uri, ns.Prefix) && len(ns.Prefix) > len(match.Prefix) {
+			match = ns
+			found = true
+		}
+	}
+	if !found {
+		return Namespace{}, "", false
+	}
+	uuid := strings.TrimPrefix(uri, match.Prefix)
+	if uuid == "" || strings.Contains(uuid, "/") {
+		return Namespace{}, "", false
+	}
+	return match, uuid, true
+}
+
+// resolutionOrder returns the namespaces to look a UUID up in, starting with the one of the given prefix.
+func (r *NamespaceRegistry) resolutionOrder(prefix string) []Namespace {
+	order := []Namespace{{Prefix: prefix}}
+	for _, ns := range r.namespaces {
+		if ns.Prefix == prefix {
+			order[0] = ns
+			continue
+		}
+		order = append(order, ns)
+	}
+	return order
+}
@@ -0,0 +1,70 @@
+package smartlogic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespaceRegistry_Match(t *testing.T) {
+	registry, err := NewNamespaceRegistry(
+		Namespace{Prefix: "http://www.ft.com/thing/", Kind: "thing"},
+		Namespace{Prefix: "http://www.ft.com/ontology/managedlocation/", Kind: "managedlocation", Topic: "Locations"},
+		Namespace{Prefix: "http://www.ft.com/thing/special/", Kind: "special"},
+	)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		uri          string
+		expectedKind string
+		expectedUUID string
+		expectedOK   bool
+	}{
+		{uri: "http://www.ft.com/thing/fd55c1f0-6c5e-4869-aed4-6816836ffdb9", expectedKind: "thing", expectedUUID: "fd55c1f0-6c5e-4869-aed4-6816836ffdb9", expectedOK: true},
+		{uri: "http://www.ft.com/ontology/managedlocation/822e3c99-afc6-3c55-b497-2255ac546f35", expectedKind: "managedlocation", expectedUUID: "822e3c99-afc6-3c55-b497-2255ac546f35", expectedOK: true},
+		{uri: "http://www.ft.com/thing/special/2d3e16e0", expectedKind: "special", expectedUUID: "2d3e16e0", expectedOK: true},
+		{uri: "http://www.ft.com/thing/ConceptScheme/2d3e16e0", expectedOK: false},
+		{uri: "http://www.ft.com/thing/2d3e16e0/Lex_en", expectedOK: false},
+		{uri: "http://www.ft.com/ontology/TMEIdentifier", expectedOK: false},
+	}
+	for _, test := range tests {
+		t.Run(test.uri, func(t *testing.T) {
+			ns, uuid, ok := registry.Match(test.uri)
+			assert.Equal(t, test.expectedOK, ok)
+			assert.Equal(t, test.expectedKind, ns.Kind)
+			assert.Equal(t, test.expectedUUID, uuid)
+		})
+	}
+}
+
+func TestNewNamespaceRegistry_Invalid(t *testing.T) {
+	_, err := NewNamespaceRegistry(Namespace{Prefix: ""})
+	assert.Error(t, err)
+
+	_, err = NewNamespaceRegistry(Namespace{Prefix: "http://www.ft.com/thing/"}, Namespace{Prefix: "http://www.ft.com/thing/"})
+	assert.Error(t, err)
+}
+
+func TestNamespaceRegistry_ResolutionOrder(t *testing.T) {
+	registry, err := NewNamespaceRegistry(DefaultNamespaces()...)
+	assert.NoError(t, err)
+
+	order := registry.resolutionOrder(managedLocationURIPrefix)
+	assert.Equal(t, []Namespace{
+		{Prefix: managedLocationURIPrefix, Kind: "managedlocation"},
+		{Prefix: thingURIPrefix, Kind: "thing"},
+	}, order)
+
+	order = registry.resolutionOrder("http://www.ft.com/other/")
+	assert.Len(t, order, 3)
+	assert.Equal(t, "http://www.ft.com/other/", order[0].Prefix)
+}
+
+func TestParseNamespaces(t *testing.T) {
+	namespaces, err := ParseNamespaces(`[{"prefix": "http://www.ft.com/thing/", "kind": "thing", "topic": "SmartlogicConcept"}]`)
+	assert.NoError(t, err)
+	assert.Equal(t, []Namespace{{Prefix: "http://www.ft.com/thing/", Kind: "thing", Topic: "SmartlogicConcept"}}, namespaces)
+
+	_, err = ParseNamespaces(`{"prefix"`)
+	assert.Error(t, err)
+}
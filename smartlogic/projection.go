@@ -0,0 +1,131 @@
+package smartlogic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// allDirectProperties asks Smartlogic for all the properties of a concept which have a literal or IRI value.
+const allDirectProperties = "[]"
+
+// Projection describes the properties requested from Smartlogic when getting a concept.
+type Projection struct {
+	// Properties are requested for the concepts of any type.
+	Properties []string `json:"properties"`
+	// Types holds the properties additionally requested for the concepts of a type,
+	// keyed by either the IRI or the local name of the type, e.g. "http://www.ft.com/ontology/person/Person" or "Person".
+	Types map[string][]string `json:"types,omitempty"`
+}
+
+// DefaultProjection returns the projection used when none is configured.
+func DefaultProjection() Projection {
+	return Projection{
+		Properties: []string{
+			allDirectProperties,
+			"skosxl:prefLabel/skosxl:literalForm",
+			"skosxl:altLabel/skosxl:literalForm",
+			"<http://www.ft.com/ontology/shortLabel>/skosxl:literalForm",
+		},
+	}
+}
+
+// ParseProjection reads a projection from its JSON representation. When the projection has no properties,
+// the ones of the default projection are used.
+func ParseProjection(data string) (Projection, error) {
+	var p Projection
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		return Projection{}, fmt.Errorf("failed to parse the projection configuration: %w", err)
+	}
+	if len(p.Properties) == 0 {
+		p.Properties = DefaultProjection().Properties
+	}
+	return p, p.Validate()
+}
+
+func (p Projection) Validate() error {
+	if len(p.Properties) == 0 {
+		return errors.New("a projection should have at least one property")
+	}
+	if err := validateProperties(p.Properties); err != nil {
+		return err
+	}
+	for t, properties := range p.Types {
+		if t == "" {
+			return errors.New("projection concept type is required")
+		}
+		if err := validateProperties(properties); err != nil {
+			return fmt.Errorf("invalid projection of type %s: %w", t, err)
+		}
+	}
+	return nil
+}
+
+func validateProperties(properties []string) error {
+	for _, property := range properties {
+		if strings.TrimSpace(property) == "" {
+			return errors.New("projection properties can't be empty")
+		}
+		if strings.Contains(property, ",") {
+			return fmt.Errorf("projection property %q can't contain a comma", property)
+		}
+	}
+	return nil
+}
+
+// PropertiesFor returns the properties requested for a concept of the given types, without duplicates.
+func (p Projection) PropertiesFor(types []string) []string {
+	properties := append([]string(nil), p.Properties...)
+	seen := map[string]bool{}
+	for _, property := range properties {
+		seen[property] = true
+	}
+	for _, t := range types {
+		extra, ok := p.Types[t]
+		if !ok {
+			extra = p.Types[localName(t)]
+		}
+		for _, property := range extra {
+			if !seen[property] {
+				seen[property] = true
+				properties = append(properties, property)
+			}
+		}
+	}
+	return properties
+}
+
+// hasTypeProperties returns whether any of the given types has properties of its own.
+func (p Projection) hasTypeProperties(types []string) bool {
+	return len(p.PropertiesFor(types)) > len(p.Properties)
+}
+
+// EffectiveProjection is the projection used to get a concept.
+type EffectiveProjection struct {
+	UUID       string   `json:"uuid"`
+	Namespace  string   `json:"namespace"`
+	Types      []string `json:"types"`
+	Properties []string `json:"properties"`
+}
+
+// GetProjection returns the properties requested from Smartlogic when getting the concept with the given uuid.
+func (c *Client) GetProjection(ctx context.Context, uuid string) (EffectiveProjection, error) {
+	concept, ns, err := c.ResolveConcept(ctx, uuid)
+	if err != nil {
+		return EffectiveProjection{}, err
+	}
+	return EffectiveProjection{
+		UUID:       uuid,
+		Namespace:  ns.Prefix,
+		Types:      concept.Types,
+		Properties: c.projection.PropertiesFor(concept.Types),
+	}, nil
+}
+
+// encodeProperties encodes the properties as the value of the properties query parameter of the Smartlogic API.
+func encodeProperties(properties []string) string {
+	return url.QueryEscape(strings.Join(properties, ","))
+}
@@ -0,0 +1,124 @@
+package smartlogic
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProjection(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          string
+		expected      Projection
+		expectedError string
+	}{
+		{
+			name: "Properties and types",
+			data: `{"properties": ["[]"], "types": {"Person": ["skosxl:hiddenLabel/skosxl:literalForm"]}}`,
+			expected: Projection{
+				Properties: []string{"[]"},
+				Types:      map[string][]string{"Person": {"skosxl:hiddenLabel/skosxl:literalForm"}},
+			},
+		},
+		{
+			name: "Default properties",
+			data: `{"types": {"Person": ["skosxl:hiddenLabel/skosxl:literalForm"]}}`,
+			expected: Projection{
+				Properties: DefaultProjection().Properties,
+				Types:      map[string][]string{"Person": {"skosxl:hiddenLabel/skosxl:literalForm"}},
+			},
+		},
+		{
+			name:          "Empty property",
+			data:          `{"properties": ["[]", " "]}`,
+			expectedError: "projection properties can't be empty",
+		},
+		{
+			name:          "Property with a comma",
+			data:          `{"properties": ["[]"], "types": {"Person": ["a,b"]}}`,
+			expectedError: `invalid projection of type Person: projection property "a,b" can't contain a comma`,
+		},
+		{
+			name:          "Invalid JSON",
+			data:          `{`,
+			expectedError: "failed to parse the projection configuration: unexpected end of JSON input",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			projection, err := ParseProjection(test.data)
+			if test.expectedError != "" {
+				assert.EqualError(t, err, test.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, projection)
+		})
+	}
+}
+
+func TestProjection_PropertiesFor(t *testing.T) {
+	projection := Projection{
+		Properties: []string{"[]", "skosxl:prefLabel/skosxl:literalForm"},
+		Types: map[string][]string{
+			"Person":                           {"skosxl:hiddenLabel/skosxl:literalForm", "[]"},
+			"http://www.ft.com/ontology/Brand": {"ft:strapline"},
+		},
+	}
+
+	assert.Equal(t, []string{"[]", "skosxl:prefLabel/skosxl:literalForm"}, projection.PropertiesFor(nil))
+	assert.Equal(t, []string{"[]", "skosxl:prefLabel/skosxl:literalForm", "skosxl:hiddenLabel/skosxl:literalForm"},
+		projection.PropertiesFor([]string{"http://www.ft.com/ontology/person/Person"}), "types should match by local name without duplicating properties")
+	assert.Equal(t, []string{"[]", "skosxl:prefLabel/skosxl:literalForm", "ft:strapline"},
+		projection.PropertiesFor([]string{"http://www.ft.com/ontology/Brand"}))
+	assert.Equal(t, []string{"[]", "skosxl:prefLabel/skosxl:literalForm"}, projection.PropertiesFor([]string{"Brand"}),
+		"types configured by IRI should only match that IRI")
+}
+
+func TestClient_GetProjection(t *testing.T) {
+	const personConcept = `{"@graph": [{"@id": "http://www.ft.com/thing/test-uuid", "@type": ["http://www.ft.com/ontology/person/Person"], "sem:guid": [{"@value": "test-uuid"}]}]}`
+
+	var requested []string
+	client := mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.Query().Get("properties"))
+		return newMockResponse(http.StatusOK, personConcept), nil
+	})
+	projection := Projection{
+		Properties: []string{"[]"},
+		Types:      map[string][]string{"Person": {"skosxl:hiddenLabel/skosxl:literalForm"}},
+	}
+	sl, err := NewSmartlogicClient(client, "http://base/url", "modelName", NoAuth{}, thingURIPrefix, WithProjection(projection))
+	assert.NoError(t, err)
+
+	effective, err := sl.GetProjection(context.Background(), "test-uuid")
+	assert.NoError(t, err)
+	assert.Equal(t, EffectiveProjection{
+		UUID:       "test-uuid",
+		Namespace:  thingURIPrefix,
+		Types:      []string{"http://www.ft.com/ontology/person/Person"},
+		Properties: []string{"[]", "skosxl:hiddenLabel/skosxl:literalForm"},
+	}, effective)
+	assert.Equal(t, []string{"[]", "[],skosxl:hiddenLabel/skosxl:literalForm"}, requested,
+		"concepts of a type with properties of its own should be fetched again with them")
+}
+
+func TestClient_GetConcept_DefaultProjection(t *testing.T) {
+	var rawQuery, properties string
+	client := mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		rawQuery = req.URL.RawQuery
+		properties = req.URL.Query().Get("properties")
+		return newMockResponse(http.StatusOK, `{"@graph": [{"sem:guid": [{"@value": "test-uuid"}]}]}`), nil
+	})
+	sl, err := NewSmartlogicClient(client, "http://base/url", "modelName", NoAuth{}, thingURIPrefix)
+	assert.NoError(t, err)
+
+	_, err = sl.GetConcept(context.Background(), "test-uuid")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(rawQuery, "path=model:modelName/%253Chttp%253A%252F%252Fwww.ft.com%252Fthing%252Ftest-uuid%253E&"), rawQuery)
+	assert.Equal(t, "[],skosxl:prefLabel/skosxl:literalForm,skosxl:altLabel/skosxl:literalForm,<http://www.ft.com/ontology/shortLabel>/skosxl:literalForm", properties)
+}
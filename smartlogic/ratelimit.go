@@ -0,0 +1,210 @@
+package smartlogic
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// Budget is the share of the Smartlogic request rate a request is made from.
+type Budget int
+
+const (
+	// BudgetLive is used by the editorial notifications and the API requests. It is the default.
+	BudgetLive Budget = iota
+	// BudgetBulk is used by the bulk work, like republishing a whole model. It is shared with the live budget,
+	// but capped to leave part of it for the live requests.
+	BudgetBulk
+	// BudgetHealth is used by the health checks, which don't use the live budget.
+	BudgetHealth
+)
+
+// Defaults of the rate limiter.
+const (
+	DefaultMaxRetryAfter    = time.Minute
+	DefaultRateLimitRetries = 3
+	defaultRetryAfter       = time.Second
+)
+
+// PerMinute returns the rate of the given number of requests per minute, where zero means no limit.
+func PerMinute(requests int) rate.Limit {
+	if requests <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(float64(requests) / 60)
+}
+
+type budgetKey struct{}
+
+// WithBudget returns a context making the Smartlogic requests from the given budget.
+func WithBudget(ctx context.Context, budget Budget) context.Context {
+	return context.WithValue(ctx, budgetKey{}, budget)
+}
+
+func budgetFrom(ctx context.Context) Budget {
+	if budget, ok := ctx.Value(budgetKey{}).(Budget); ok {
+		return budget
+	}
+	return BudgetLive
+}
+
+// RateLimitedClient is an HTTP client throttling the requests to Smartlogic to stay within its API quota.
+// When Smartlogic responds with 429 Too Many Requests anyway, all the requests wait until the time given by
+// its Retry-After header before the throttled request is retried.
+type RateLimitedClient struct {
+	client        HTTPClient
+	live          *rate.Limiter
+	bulk          *rate.Limiter
+	health        *rate.Limiter
+	retries       int
+	maxRetryAfter time.Duration
+	now           func() time.Time
+
+	mu          sync.Mutex
+	pausedUntil time.Time
+}
+
+// WithBulkRate caps the requests of the bulk budget, which are also counted in the live budget.
+func WithBulkRate(limit rate.Limit, burst int) func(*RateLimitedClient) {
+	return func(c *RateLimitedClient) {
+		c.bulk = rate.NewLimiter(limit, burst)
+	}
+}
+
+// WithHealthRate sets the rate of the requests of the health check budget.
+func WithHealthRate(limit rate.Limit, burst int) func(*RateLimitedClient) {
+	return func(c *RateLimitedClient) {
+		c.health = rate.NewLimiter(limit, burst)
+	}
+}
+
+// WithRateLimitRetries sets how many times a request throttled by Smartlogic is retried.
+func WithRateLimitRetries(retries int) func(*RateLimitedClient) {
+	return func(c *RateLimitedClient) {
+		if retries >= 0 {
+			c.retries = retries
+		}
+	}
+}
+
+// WithMaxRetryAfter caps how long the requests wait when Smartlogic asks to retry later.
+func WithMaxRetryAfter(maxRetryAfter time.Duration) func(*RateLimitedClient) {
+	return func(c *RateLimitedClient) {
+		if maxRetryAfter > 0 {
+			c.maxRetryAfter = maxRetryAfter
+		}
+	}
+}
+
+// NewRateLimitedClient creates a client making at most limit requests per second from the live and bulk budgets,
+// with bursts of burst requests. Unless configured, the bulk budget can use the whole rate and the health budget
+// is not limited.
+func NewRateLimitedClient(client HTTPClient, limit rate.Limit, burst int, opts ...func(*RateLimitedClient)) *RateLimitedClient {
+	c := &RateLimitedClient{
+		client:        client,
+		live:          rate.NewLimiter(limit, burst),
+		bulk:          rate.NewLimiter(rate.Inf, 1),
+		health:        rate.NewLimiter(rate.Inf, 1),
+		retries:       DefaultRateLimitRetries,
+		maxRetryAfter: DefaultMaxRetryAfter,
+		now:           time.Now,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *RateLimitedClient) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		if err := c.wait(ctx, budgetFrom(ctx)); err != nil {
+			return nil, err
+		}
+		resp, err := c.client.Do(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || attempt >= c.retries || !rewind(req) {
+			return resp, err
+		}
+		delay := c.retryAfter(resp.Header.Get("Retry-After"), attempt)
+		resp.Body.Close()
+		log.WithField("url", req.URL.Path).WithField("delay", delay).Warn("Smartlogic throttled the request, pausing the requests")
+		c.pause(delay)
+	}
+}
+
+// wait blocks until the request can be made from the budget.
+func (c *RateLimitedClient) wait(ctx context.Context, budget Budget) error {
+	if err := c.waitPause(ctx); err != nil {
+		return err
+	}
+	switch budget {
+	case BudgetHealth:
+		return c.health.Wait(ctx)
+	case BudgetBulk:
+		if err := c.bulk.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	return c.live.Wait(ctx)
+}
+
+func (c *RateLimitedClient) waitPause(ctx context.Context) error {
+	c.mu.Lock()
+	delay := c.pausedUntil.Sub(c.now())
+	c.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func (c *RateLimitedClient) pause(delay time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if until := c.now().Add(delay); until.After(c.pausedUntil) {
+		c.pausedUntil = until
+	}
+}
+
+// retryAfter returns how long to wait according to the Retry-After header, which is either a number of seconds
+// or an HTTP date. Without a valid header, the delay grows exponentially with the attempts.
+func (c *RateLimitedClient) retryAfter(header string, attempt int) time.Duration {
+	delay := defaultRetryAfter << uint(attempt)
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(header); err == nil {
+		delay = date.Sub(c.now())
+	}
+	if delay > c.maxRetryAfter {
+		return c.maxRetryAfter
+	}
+	return delay
+}
+
+// rewind prepares the request to be sent again, returning false if its body can't be read again.
+func rewind(req *http.Request) bool {
+	if req.Body == nil || req.Body == http.NoBody {
+		return true
+	}
+	if req.GetBody == nil {
+		return false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return false
+	}
+	req.Body = body
+	return true
+}
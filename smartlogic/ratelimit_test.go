@@ -0,0 +1,120 @@
+package smartlogic
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimitedClient_Budgets(t *testing.T) {
+	var mu sync.Mutex
+	var requested []string
+	client := mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		requested = append(requested, req.URL.Path)
+		return newMockResponse(http.StatusOK, ""), nil
+	})
+	limited := NewRateLimitedClient(client, rate.Every(time.Hour), 2,
+		WithBulkRate(rate.Every(time.Hour), 1),
+		WithHealthRate(rate.Every(time.Hour), 1))
+
+	do := func(budget Budget, path string) error {
+		ctx, cancel := context.WithTimeout(WithBudget(context.Background(), budget), 50*time.Millisecond)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", "http://smartlogic"+path, nil)
+		_, err := limited.Do(req)
+		return err
+	}
+
+	assert.NoError(t, do(BudgetBulk, "/bulk1"))
+	assert.Error(t, do(BudgetBulk, "/bulk2"), "the bulk budget should be capped")
+	assert.NoError(t, do(BudgetLive, "/live1"), "bulk requests shouldn't starve the live ones")
+	assert.Error(t, do(BudgetLive, "/live2"), "bulk requests should count in the live budget")
+	assert.NoError(t, do(BudgetHealth, "/health1"), "health checks shouldn't use the live budget")
+	assert.Error(t, do(BudgetHealth, "/health2"))
+	assert.Equal(t, []string{"/bulk1", "/live1", "/health1"}, requested)
+}
+
+func TestRateLimitedClient_RetryAfter(t *testing.T) {
+	var calls int
+	client := mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		if calls == 1 {
+			resp := newMockResponse(http.StatusTooManyRequests, "")
+			resp.Header.Set("Retry-After", "0")
+			return resp, nil
+		}
+		return newMockResponse(http.StatusOK, "ok"), nil
+	})
+	limited := NewRateLimitedClient(client, rate.Inf, 1)
+
+	req, _ := http.NewRequest("POST", "http://smartlogic/token", strings.NewReader("grant_type=apikey"))
+	resp, err := limited.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, calls, "throttled requests should be retried")
+}
+
+func TestRateLimitedClient_RetriesExhausted(t *testing.T) {
+	var calls int
+	client := mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		resp := newMockResponse(http.StatusTooManyRequests, "")
+		resp.Header.Set("Retry-After", "0")
+		return resp, nil
+	})
+	limited := NewRateLimitedClient(client, rate.Inf, 1, WithRateLimitRetries(2))
+
+	req, _ := http.NewRequest("GET", "http://smartlogic/url", nil)
+	resp, err := limited.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, 3, calls)
+}
+
+func TestRateLimitedClient_PausesAllRequests(t *testing.T) {
+	client := mockHTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		return newMockResponse(http.StatusOK, ""), nil
+	})
+	limited := NewRateLimitedClient(client, rate.Inf, 1)
+	limited.pause(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", "http://smartlogic/url", nil)
+	_, err := limited.Do(req)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestRateLimitedClient_retryAfter(t *testing.T) {
+	now := time.Date(2020, 4, 27, 12, 0, 0, 0, time.UTC)
+	limited := NewRateLimitedClient(&mockHTTPClient{}, rate.Inf, 1, WithMaxRetryAfter(time.Minute))
+	limited.now = func() time.Time { return now }
+
+	tests := []struct {
+		header   string
+		attempt  int
+		expected time.Duration
+	}{
+		{header: "5", expected: 5 * time.Second},
+		{header: "Mon, 27 Apr 2020 12:00:30 GMT", expected: 30 * time.Second},
+		{header: "3600", expected: time.Minute},
+		{header: "", attempt: 2, expected: 4 * time.Second},
+		{header: "soon", expected: time.Second},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, limited.retryAfter(test.header, test.attempt), test.header)
+	}
+}
+
+func TestPerMinute(t *testing.T) {
+	assert.Equal(t, rate.Inf, PerMinute(0))
+	assert.Equal(t, rate.Limit(2), PerMinute(120))
+}
@@ -0,0 +1,86 @@
+package smartlogictest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// UUIDs of some of the concepts of the default seed.
+const (
+	SeedFinancialTimesUUID = "dbb0bdae-1f0c-11e4-b0cb-b2227cce2b54"
+	SeedLexUUID            = "2d3e16e0-61cb-4322-8aff-3b01c59f4daa"
+	SeedPersonUUID         = "b1a492d9-dcfe-43f8-8072-17b4618a78fd"
+)
+
+const defaultSeed = `{
+  "@graph": [
+    {
+      "@id": "http://www.ft.com/thing/dbb0bdae-1f0c-11e4-b0cb-b2227cce2b54",
+      "@type": ["http://www.ft.com/ontology/product/Brand"],
+      "sem:guid": [{"@value": "dbb0bdae-1f0c-11e4-b0cb-b2227cce2b54"}],
+      "skosxl:prefLabel": [{
+        "@id": "http://www.ft.com/thing/dbb0bdae-1f0c-11e4-b0cb-b2227cce2b54/Financial_Times_en",
+        "skosxl:literalForm": [{"@language": "en", "@value": "Financial Times"}]
+      }],
+      "http://www.ft.com/ontology/hasSubBrand": [{"@id": "http://www.ft.com/thing/2d3e16e0-61cb-4322-8aff-3b01c59f4daa"}]
+    },
+    {
+      "@id": "http://www.ft.com/thing/2d3e16e0-61cb-4322-8aff-3b01c59f4daa",
+      "@type": ["http://www.ft.com/ontology/product/Brand"],
+      "sem:guid": [{"@value": "2d3e16e0-61cb-4322-8aff-3b01c59f4daa"}],
+      "skosxl:prefLabel": [{
+        "@id": "http://www.ft.com/thing/2d3e16e0-61cb-4322-8aff-3b01c59f4daa/Lex_en",
+        "skosxl:literalForm": [{"@language": "en", "@value": "Lex"}]
+      }],
+      "http://www.ft.com/ontology/strapline": [{"@language": "en", "@value": "FT's agenda-setting column on business and finance"}],
+      "http://www.ft.com/ontology/subBrandOf": [{"@id": "http://www.ft.com/thing/dbb0bdae-1f0c-11e4-b0cb-b2227cce2b54"}]
+    },
+    {
+      "@id": "http://www.ft.com/thing/b1a492d9-dcfe-43f8-8072-17b4618a78fd",
+      "@type": ["http://www.ft.com/ontology/person/Person"],
+      "sem:guid": [{"@value": "b1a492d9-dcfe-43f8-8072-17b4618a78fd"}],
+      "skosxl:prefLabel": [{
+        "@id": "http://www.ft.com/thing/b1a492d9-dcfe-43f8-8072-17b4618a78fd/Jane_Doe_en",
+        "skosxl:literalForm": [{"@language": "en", "@value": "Jane Doe"}]
+      }],
+      "http://www.ft.com/ontology/TMEIdentifier": [{"@value": "MjQ5NDk3-UE4="}]
+    }
+  ]
+}`
+
+// DefaultSeed returns a few concepts of the FT model: the Financial Times brand, its Lex sub-brand and a person.
+func DefaultSeed() []Node {
+	nodes, err := ParseSeed([]byte(defaultSeed))
+	if err != nil {
+		panic(err)
+	}
+	return nodes
+}
+
+// ParseSeed reads the concepts from a JSON-LD document in the format returned by Smartlogic, with the concepts
+// in its @graph. Each concept needs an @id and a sem:guid.
+func ParseSeed(data []byte) ([]Node, error) {
+	doc := struct {
+		Graph []Node `json:"@graph"`
+	}{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse the seed: %w", err)
+	}
+	for _, node := range doc.Graph {
+		if err := validateNode(node); err != nil {
+			return nil, err
+		}
+	}
+	return doc.Graph, nil
+}
+
+func validateNode(node Node) error {
+	if node.ID() == "" {
+		return errors.New("concept has no @id")
+	}
+	if node.GUID() == "" {
+		return fmt.Errorf("concept %s has no sem:guid", node.ID())
+	}
+	return nil
+}
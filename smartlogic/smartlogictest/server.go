@@ -0,0 +1,448 @@
+// Package smartlogictest provides a fake Smartlogic Semaphore server, serving a model held in memory, for tests and
+// for running the notifier locally.
+package smartlogictest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// Defaults of the fake server.
+const (
+	DefaultModel            = "FTModel"
+	DefaultConceptURIPrefix = "http://www.ft.com/thing/"
+	DefaultCommitter        = "fake.user@ft.com"
+	DefaultTokenTTL         = time.Hour
+)
+
+// Paths of the endpoints of the fake server. The Smartlogic base URL of the notifier is the server URL followed by
+// APIPath, and its token URL is the server URL followed by TokenPath.
+const (
+	TokenPath = "/token"
+	APIPath   = "/api"
+	AdminPath = "/admin/concepts"
+)
+
+const (
+	slTimeFormat   = "2006-01-02T15:04:05.000Z"
+	masterGraphURN = "urn:x-evn-master:"
+)
+
+var (
+	committedFilter = regexp.MustCompile(`sem:committed(<=|>)"([^"]+)"\^\^xsd:dateTime`)
+	jsonLDContext   = map[string]string{
+		"model":    masterGraphURN,
+		"tchmodel": "urn:x-evn-tch-union:",
+		"user":     "urn:x-tb-users:",
+		"sem":      "http://www.smartlogic.com/2014/08/semaphore-core#",
+		"skos":     "http://www.w3.org/2004/02/skos/core#",
+		"skosxl":   "http://www.w3.org/2008/05/skos-xl#",
+		"teamwork": "http://topbraid.org/teamwork#",
+		"sioc":     "http://rdfs.org/sioc/ns#",
+		"rdf":      "http://www.w3.org/1999/02/22-rdf-syntax-ns#",
+	}
+)
+
+// Server is a fake Smartlogic Semaphore server. It issues access tokens, serves the concepts of a single model and
+// the log of the changes made to them, and lets the concepts be added, edited and deleted via its admin endpoints.
+// After each change it sends a notification to the notify URL, like the Smartlogic publishing webhook.
+type Server struct {
+	model            string
+	conceptURIPrefix string
+	apiKey           string
+	clientID         string
+	clientSecret     string
+	authDisabled     bool
+	tokenTTL         time.Duration
+	notifyURL        string
+	httpClient       *http.Client
+	now              func() time.Time
+
+	store  *store
+	router *mux.Router
+
+	mu     sync.Mutex
+	tokens map[string]time.Time
+}
+
+// WithModel sets the name of the model served.
+func WithModel(model string) func(*Server) {
+	return func(s *Server) {
+		s.model = model
+	}
+}
+
+// WithConceptURIPrefix sets the prefix of the URIs of the concepts created via the admin endpoints.
+func WithConceptURIPrefix(prefix string) func(*Server) {
+	return func(s *Server) {
+		s.conceptURIPrefix = prefix
+	}
+}
+
+// WithAPIKey makes the token endpoint only accept the given API key. Any key is accepted otherwise.
+func WithAPIKey(key string) func(*Server) {
+	return func(s *Server) {
+		s.apiKey = key
+	}
+}
+
+// WithClientCredentials makes the token endpoint only accept the given OAuth2 client credentials.
+// Any credentials are accepted otherwise.
+func WithClientCredentials(clientID string, clientSecret string) func(*Server) {
+	return func(s *Server) {
+		s.clientID = clientID
+		s.clientSecret = clientSecret
+	}
+}
+
+// WithoutAuth makes the server accept the requests without an access token.
+func WithoutAuth() func(*Server) {
+	return func(s *Server) {
+		s.authDisabled = true
+	}
+}
+
+// WithTokenTTL sets how long the access tokens are valid for.
+func WithTokenTTL(ttl time.Duration) func(*Server) {
+	return func(s *Server) {
+		if ttl > 0 {
+			s.tokenTTL = ttl
+		}
+	}
+}
+
+// WithNotifyURL sets the URL of the /notify endpoint of the notifier, which is called after each change.
+func WithNotifyURL(notifyURL string) func(*Server) {
+	return func(s *Server) {
+		s.notifyURL = notifyURL
+	}
+}
+
+// WithSeed adds the concepts to the model, as if they had been there from the start.
+func WithSeed(nodes ...Node) func(*Server) {
+	return func(s *Server) {
+		s.store.seed(nodes...)
+	}
+}
+
+// NewServer creates a fake server of an empty model, unless seeded.
+func NewServer(opts ...func(*Server)) *Server {
+	s := &Server{
+		model:            DefaultModel,
+		conceptURIPrefix: DefaultConceptURIPrefix,
+		tokenTTL:         DefaultTokenTTL,
+		httpClient:       &http.Client{Timeout: 10 * time.Second},
+		now:              time.Now,
+		store:            newStore(),
+		tokens:           map[string]time.Time{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.router = mux.NewRouter()
+	s.router.HandleFunc(TokenPath, s.handleToken).Methods("POST")
+	s.router.HandleFunc(APIPath, s.authorized(s.handleAPI)).Methods("GET")
+	s.router.HandleFunc(AdminPath, s.handleListConcepts).Methods("GET")
+	s.router.HandleFunc(AdminPath+"/{uuid}", s.handleGetConcept).Methods("GET")
+	s.router.HandleFunc(AdminPath+"/{uuid}", s.handlePutConcept).Methods("PUT")
+	s.router.HandleFunc(AdminPath+"/{uuid}", s.handleDeleteConcept).Methods("DELETE")
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.router.ServeHTTP(w, req)
+}
+
+// RevokeTokens invalidates all the access tokens issued so far, so that the clients have to get new ones.
+func (s *Server) RevokeTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = map[string]time.Time{}
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	switch req.PostForm.Get("grant_type") {
+	case "apikey":
+		if s.apiKey != "" && req.PostForm.Get("key") != s.apiKey {
+			writeError(w, http.StatusUnauthorized, "invalid_client")
+			return
+		}
+	case "client_credentials":
+		id, secret, ok := req.BasicAuth()
+		if !ok || (s.clientID != "" && (id != url.QueryEscape(s.clientID) || secret != url.QueryEscape(s.clientSecret))) {
+			writeError(w, http.StatusUnauthorized, "invalid_client")
+			return
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	token := newToken()
+	issued := s.now()
+	s.mu.Lock()
+	s.tokens[token] = issued.Add(s.tokenTTL)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "bearer",
+		"expires_in":   int(s.tokenTTL.Seconds()),
+		".issued":      issued.UTC().Format(http.TimeFormat),
+		".expires":     issued.Add(s.tokenTTL).UTC().Format(http.TimeFormat),
+	})
+}
+
+// authorized rejects the requests without a valid access token.
+func (s *Server) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !s.authDisabled && !s.validToken(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")) {
+			writeError(w, http.StatusUnauthorized, "invalid_token")
+			return
+		}
+		handler(w, req)
+	}
+}
+
+func (s *Server) validToken(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires, ok := s.tokens[token]
+	return ok && s.now().Before(expires)
+}
+
+// handleAPI serves the concepts and the change log, depending on the path query parameter.
+func (s *Server) handleAPI(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	path := query.Get("path")
+	limit, offset := atoi(query.Get("limit")), atoi(query.Get("offset"))
+
+	switch {
+	case path == "model:"+s.model+"/skos:Concept/meta:transitiveInstance":
+		s.serveConceptList(w, limit, offset)
+	case path == "tchmodel:"+s.model+"/teamwork:Change/rdf:instance":
+		s.serveChanges(w, query.Get("filters"), limit, offset)
+	case strings.HasPrefix(path, "model:"+s.model+"/"):
+		iri, err := url.QueryUnescape(strings.TrimPrefix(path, "model:"+s.model+"/"))
+		if err != nil || !strings.HasPrefix(iri, "<") || !strings.HasSuffix(iri, ">") {
+			writeError(w, http.StatusBadRequest, "invalid path "+path)
+			return
+		}
+		s.serveConcept(w, strings.TrimSuffix(strings.TrimPrefix(iri, "<"), ">"))
+	default:
+		writeError(w, http.StatusNotFound, "unknown path "+path)
+	}
+}
+
+// serveConcept returns the concept with the given URI. Like Smartlogic, a concept which doesn't exist is returned
+// with just its @id.
+func (s *Server) serveConcept(w http.ResponseWriter, uri string) {
+	node, ok := s.store.get(uri)
+	if !ok {
+		node = Node{"@id": uri}
+	}
+	writeGraph(w, http.StatusOK, []Node{node})
+}
+
+func (s *Server) serveConceptList(w http.ResponseWriter, limit int, offset int) {
+	var graph []Node
+	for _, node := range page(s.store.list(), limit, offset) {
+		graph = append(graph, Node{"@id": node.ID(), "sem:guid": node["sem:guid"]})
+	}
+	writeGraph(w, http.StatusOK, graph)
+}
+
+func (s *Server) serveChanges(w http.ResponseWriter, filters string, limit int, offset int) {
+	var from, to time.Time
+	for _, match := range committedFilter.FindAllStringSubmatch(filters, -1) {
+		t, err := time.Parse(slTimeFormat, match[2])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid filter "+filters)
+			return
+		}
+		if match[1] == ">" {
+			from = t
+		} else {
+			to = t
+		}
+	}
+
+	var changesets []Node
+	for _, c := range s.store.changesBetween(from, to) {
+		changesets = append(changesets, changeset(c))
+	}
+	writeGraph(w, http.StatusOK, page(changesets, limit, offset))
+}
+
+// changeset returns the teamwork:Change of the change. As in Smartlogic, creating and deleting a concept respectively
+// add and delete its rdf:type statement.
+func changeset(c change) Node {
+	committed := c.committed.Format(slTimeFormat)
+	node := Node{
+		"@id":              "urn:x-change:" + strings.Replace(committed, ":", "-", -1) + c.committer,
+		"@type":            []string{"teamwork:Change"},
+		"sem:about":        []Node{{"@id": c.uri}},
+		"sem:committed":    []Node{{"@type": "xsd:dateTime", "@value": committed}},
+		"sioc:has_creator": []Node{{"@id": "user:" + url.QueryEscape(c.committer)}},
+	}
+	typeStatement := []Node{{
+		"teamwork:subject":   []Node{{"@id": c.uri}},
+		"teamwork:predicate": []Node{{"@id": "rdf:type"}},
+	}}
+	switch c.changeType {
+	case changeCreated:
+		node["teamwork:added"] = typeStatement
+	case changeDeleted:
+		node["teamwork:deleted"] = typeStatement
+	}
+	return node
+}
+
+func (s *Server) handleListConcepts(w http.ResponseWriter, _ *http.Request) {
+	writeGraph(w, http.StatusOK, s.store.list())
+}
+
+func (s *Server) handleGetConcept(w http.ResponseWriter, req *http.Request) {
+	node, ok := s.store.find(mux.Vars(req)["uuid"])
+	if !ok {
+		writeError(w, http.StatusNotFound, "concept not found")
+		return
+	}
+	writeGraph(w, http.StatusOK, []Node{node})
+}
+
+// handlePutConcept creates or replaces the concept with the JSON-LD node in the body. Its sem:guid is set to the UUID
+// and, unless given, its @id is the concept URI prefix followed by the UUID.
+func (s *Server) handlePutConcept(w http.ResponseWriter, req *http.Request) {
+	uuid := mux.Vars(req)["uuid"]
+	var node Node
+	if err := json.NewDecoder(req.Body).Decode(&node); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid concept: "+err.Error())
+		return
+	}
+	if node.ID() == "" {
+		node["@id"] = s.conceptURIPrefix + uuid
+		if existing, ok := s.store.find(uuid); ok {
+			node["@id"] = existing.ID()
+		}
+	}
+	node["sem:guid"] = []interface{}{map[string]interface{}{"@value": uuid}}
+
+	c := s.store.put(node, committer(req), s.now())
+	status := http.StatusOK
+	if c.changeType == changeCreated {
+		status = http.StatusCreated
+	}
+	s.notify(c)
+	writeGraph(w, status, []Node{node})
+}
+
+func (s *Server) handleDeleteConcept(w http.ResponseWriter, req *http.Request) {
+	node, ok := s.store.find(mux.Vars(req)["uuid"])
+	if !ok {
+		writeError(w, http.StatusNotFound, "concept not found")
+		return
+	}
+	c, ok := s.store.delete(node.ID(), committer(req), s.now())
+	if !ok {
+		writeError(w, http.StatusNotFound, "concept not found")
+		return
+	}
+	s.notify(c)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// notify calls the notify URL for the change, with the query parameters sent by the Smartlogic publishing webhook.
+func (s *Server) notify(c change) {
+	if s.notifyURL == "" {
+		return
+	}
+	query := url.Values{}
+	query.Set("modifiedGraphId", masterGraphURN+s.model)
+	query.Set("affectedGraphId", masterGraphURN+s.model)
+	query.Set("lastChangeDate", c.committed.Format(slTimeFormat))
+
+	entry := log.WithField("uri", c.uri).WithField("notifyURL", s.notifyURL)
+	resp, err := s.httpClient.Get(s.notifyURL + "?" + query.Encode())
+	if err != nil {
+		entry.WithError(err).Error("Failed to notify the change")
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		entry.Errorf("Notifying the change returned status %v", resp.StatusCode)
+		return
+	}
+	entry.Infof("Notified the %s change", c.changeType)
+}
+
+// committer returns the user the change is made by, given by the committer query parameter.
+func committer(req *http.Request) string {
+	if user := req.URL.Query().Get("committer"); user != "" {
+		return user
+	}
+	return DefaultCommitter
+}
+
+func page(nodes []Node, limit int, offset int) []Node {
+	if offset > len(nodes) {
+		offset = len(nodes)
+	}
+	nodes = nodes[offset:]
+	if limit > 0 && limit < len(nodes) {
+		nodes = nodes[:limit]
+	}
+	return nodes
+}
+
+func atoi(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+func newToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to generate an access token: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// writeGraph writes the nodes as the @graph of a JSON-LD document.
+func writeGraph(w http.ResponseWriter, statusCode int, graph []Node) {
+	if graph == nil {
+		graph = []Node{}
+	}
+	writeJSON(w, statusCode, map[string]interface{}{"@graph": graph, "@context": jsonLDContext})
+}
+
+func writeError(w http.ResponseWriter, statusCode int, msg string) {
+	writeJSON(w, statusCode, map[string]string{"error": msg})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithError(err).Error("Failed to encode the response")
+	}
+}
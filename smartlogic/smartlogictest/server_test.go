@@ -0,0 +1,192 @@
+package smartlogictest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/smartlogic-notifier/smartlogic"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClient(t *testing.T, srv *httptest.Server, auth smartlogic.Authenticator, opts ...func(*smartlogic.Client)) smartlogic.Clienter {
+	client, err := smartlogic.NewSmartlogicClient(http.DefaultClient, srv.URL+APIPath, DefaultModel, auth, DefaultConceptURIPrefix, opts...)
+	assert.NoError(t, err)
+	return client
+}
+
+func apiKeyAuth(srv *httptest.Server) smartlogic.Authenticator {
+	return smartlogic.APIKeyAuth{TokenURL: srv.URL + TokenPath, APIKey: "api-key"}
+}
+
+func do(t *testing.T, method string, url string, body string) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	assert.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	return resp
+}
+
+func TestServer_GetConcept(t *testing.T) {
+	srv := httptest.NewServer(NewServer(WithSeed(DefaultSeed()...), WithAPIKey("api-key")))
+	defer srv.Close()
+	client := newTestClient(t, srv, apiKeyAuth(srv))
+
+	concept, ns, err := client.ResolveConcept(context.Background(), SeedLexUUID)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultConceptURIPrefix, ns.Prefix)
+	assert.Equal(t, "Lex", concept.PrefLabel("en"))
+	assert.Equal(t, []string{DefaultConceptURIPrefix + SeedFinancialTimesUUID}, concept.Related("subBrandOf"))
+
+	_, err = client.GetConcept(context.Background(), "a4a5c1f5-1a2b-4c4e-8d5f-4b6f6c0b1e2a")
+	assert.Equal(t, smartlogic.ErrorConceptDoesNotExist, err)
+}
+
+func TestServer_Auth(t *testing.T) {
+	srv := httptest.NewServer(NewServer(WithAPIKey("api-key"), WithClientCredentials("client", "secret")))
+	defer srv.Close()
+
+	client, err := smartlogic.NewSmartlogicClient(http.DefaultClient, srv.URL+APIPath, DefaultModel,
+		smartlogic.APIKeyAuth{TokenURL: srv.URL + TokenPath, APIKey: "wrong-key"}, DefaultConceptURIPrefix)
+	assert.True(t, errors.Is(err, smartlogic.ErrUnauthorized), "invalid API keys should be rejected")
+	_, err = client.GetConcept(context.Background(), SeedLexUUID)
+	assert.True(t, errors.Is(err, smartlogic.ErrUnauthorized))
+
+	client = newTestClient(t, srv, smartlogic.ClientCredentialsAuth{TokenURL: srv.URL + TokenPath, ClientID: "client", ClientSecret: "secret"})
+	assert.NotEmpty(t, client.AccessToken())
+
+	resp := do(t, "GET", srv.URL+APIPath+"?path=model:"+DefaultModel+"/skos:Concept/meta:transitiveInstance", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "requests without a token should be rejected")
+}
+
+func TestServer_RevokeTokens(t *testing.T) {
+	fake := NewServer(WithSeed(DefaultSeed()...))
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	client := newTestClient(t, srv, apiKeyAuth(srv))
+	token := client.AccessToken()
+
+	fake.RevokeTokens()
+	_, err := client.GetConcept(context.Background(), SeedPersonUUID)
+	assert.NoError(t, err, "the client should get a new token once the old one is rejected")
+	assert.NotEqual(t, token, client.AccessToken())
+}
+
+func TestServer_ListConcepts(t *testing.T) {
+	srv := httptest.NewServer(NewServer(WithSeed(DefaultSeed()...), WithoutAuth()))
+	defer srv.Close()
+	client := newTestClient(t, srv, smartlogic.NoAuth{}, smartlogic.WithConceptsPageSize(2))
+
+	var pages [][]string
+	err := client.ListConcepts(context.Background(), func(uuids []string) error {
+		pages = append(pages, uuids)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{SeedLexUUID, SeedPersonUUID}, {SeedFinancialTimesUUID}}, pages)
+}
+
+func TestServer_Changes(t *testing.T) {
+	now := time.Date(2020, 4, 27, 12, 0, 0, 0, time.UTC)
+	fake := NewServer(WithSeed(DefaultSeed()...))
+	fake.now = func() time.Time { return now }
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	client := newTestClient(t, srv, apiKeyAuth(srv), smartlogic.WithChangesPageSize(1))
+	since := now.Add(-time.Minute)
+
+	const newUUID = "c4ea7c11-9387-4a0e-aa91-a3c077eaaeba"
+	resp := do(t, "PUT", srv.URL+AdminPath+"/"+newUUID+"?committer=jane.doe@ft.com",
+		`{"@type": ["http://www.ft.com/ontology/Topic"], "skosxl:prefLabel": [{"skosxl:literalForm": [{"@value": "Brexit"}]}]}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp = do(t, "PUT", srv.URL+AdminPath+"/"+SeedLexUUID, `{"@type": ["http://www.ft.com/ontology/product/Brand"]}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = do(t, "DELETE", srv.URL+AdminPath+"/"+SeedPersonUUID, "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = do(t, "DELETE", srv.URL+AdminPath+"/"+SeedPersonUUID, "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	changes, err := client.GetChangedConcepts(context.Background(), since)
+	assert.NoError(t, err)
+	assert.Equal(t, []smartlogic.ChangedConcept{
+		{
+			URI:        DefaultConceptURIPrefix + newUUID,
+			UUID:       newUUID,
+			ChangeType: smartlogic.ChangeTypeCreated,
+			Committer:  "jane.doe@ft.com",
+			Committed:  now,
+			ChangeID:   "urn:x-change:2020-04-27T12-00-00.000Zjane.doe@ft.com",
+			Namespace:  smartlogic.Namespace{Prefix: DefaultConceptURIPrefix, Kind: "thing"},
+		},
+		{
+			URI:        DefaultConceptURIPrefix + SeedLexUUID,
+			UUID:       SeedLexUUID,
+			ChangeType: smartlogic.ChangeTypeUpdated,
+			Committer:  DefaultCommitter,
+			Committed:  now.Add(time.Millisecond),
+			ChangeID:   "urn:x-change:2020-04-27T12-00-00.001Z" + DefaultCommitter,
+			Namespace:  smartlogic.Namespace{Prefix: DefaultConceptURIPrefix, Kind: "thing"},
+		},
+		{
+			URI:        DefaultConceptURIPrefix + SeedPersonUUID,
+			UUID:       SeedPersonUUID,
+			ChangeType: smartlogic.ChangeTypeDeleted,
+			Committer:  DefaultCommitter,
+			Committed:  now.Add(2 * time.Millisecond),
+			ChangeID:   "urn:x-change:2020-04-27T12-00-00.002Z" + DefaultCommitter,
+			Namespace:  smartlogic.Namespace{Prefix: DefaultConceptURIPrefix, Kind: "thing"},
+		},
+	}, changes)
+
+	changed, err := client.GetChangedConceptList(context.Background(), now)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{SeedLexUUID, SeedPersonUUID}, changed, "changes committed at the change date shouldn't be returned")
+
+	concept, _, err := client.ResolveConcept(context.Background(), newUUID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Brexit", concept.PrefLabel(""))
+	_, err = client.GetConcept(context.Background(), SeedPersonUUID)
+	assert.True(t, errors.Is(err, smartlogic.ErrorConceptDoesNotExist))
+}
+
+func TestServer_Notify(t *testing.T) {
+	var mu sync.Mutex
+	var notifications []url.Values
+	notifier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		notifications = append(notifications, req.URL.Query())
+	}))
+	defer notifier.Close()
+
+	now := time.Date(2020, 4, 27, 12, 0, 0, 0, time.UTC)
+	fake := NewServer(WithSeed(DefaultSeed()...), WithModel("Locations"), WithNotifyURL(notifier.URL+"/notify"))
+	fake.now = func() time.Time { return now }
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	do(t, "DELETE", srv.URL+AdminPath+"/"+SeedLexUUID, "")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []url.Values{{
+		"modifiedGraphId": {"urn:x-evn-master:Locations"},
+		"affectedGraphId": {"urn:x-evn-master:Locations"},
+		"lastChangeDate":  {"2020-04-27T12:00:00.000Z"},
+	}}, notifications)
+}
+
+func TestServer_PutConcept_InvalidBody(t *testing.T) {
+	srv := httptest.NewServer(NewServer())
+	defer srv.Close()
+
+	resp := do(t, "PUT", srv.URL+AdminPath+"/"+SeedLexUUID, `{"@type": `)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
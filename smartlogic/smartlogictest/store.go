@@ -0,0 +1,141 @@
+package smartlogictest
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Types of the changes recorded in the change log.
+const (
+	changeCreated = "created"
+	changeUpdated = "updated"
+	changeDeleted = "deleted"
+)
+
+// Node is a JSON-LD node of the model, keyed by property.
+type Node map[string]interface{}
+
+// ID returns the @id of the node.
+func (n Node) ID() string {
+	id, _ := n["@id"].(string)
+	return id
+}
+
+// GUID returns the first sem:guid of the node, which is the UUID of a concept.
+func (n Node) GUID() string {
+	values, _ := n["sem:guid"].([]interface{})
+	if len(values) == 0 {
+		return ""
+	}
+	value, _ := values[0].(map[string]interface{})
+	guid, _ := value["@value"].(string)
+	return guid
+}
+
+// change is an entry of the change log of the model.
+type change struct {
+	uri        string
+	changeType string
+	committer  string
+	committed  time.Time
+}
+
+// store holds the concepts of the model, keyed by URI, and the log of the changes made to them.
+type store struct {
+	mu       sync.Mutex
+	concepts map[string]Node
+	changes  []change
+}
+
+func newStore() *store {
+	return &store{concepts: map[string]Node{}}
+}
+
+// seed adds the concepts without recording any change, as if they had been there from the start.
+func (s *store) seed(nodes ...Node) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, node := range nodes {
+		s.concepts[node.ID()] = node
+	}
+}
+
+func (s *store) get(uri string) (Node, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	node, ok := s.concepts[uri]
+	return node, ok
+}
+
+// find returns the concept with the given UUID.
+func (s *store) find(uuid string) (Node, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, node := range s.concepts {
+		if node.GUID() == uuid {
+			return node, true
+		}
+	}
+	return nil, false
+}
+
+// list returns the concepts ordered by URI.
+func (s *store) list() []Node {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nodes := make([]Node, 0, len(s.concepts))
+	for _, node := range s.concepts {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID() < nodes[j].ID() })
+	return nodes
+}
+
+// put creates or replaces the concept and records the change, which is returned.
+func (s *store) put(node Node, committer string, now time.Time) change {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changeType := changeUpdated
+	if _, ok := s.concepts[node.ID()]; !ok {
+		changeType = changeCreated
+	}
+	s.concepts[node.ID()] = node
+	return s.record(node.ID(), changeType, committer, now)
+}
+
+// delete deletes the concept and records the change. It returns false if there is no such concept.
+func (s *store) delete(uri string, committer string, now time.Time) (change, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.concepts[uri]; !ok {
+		return change{}, false
+	}
+	delete(s.concepts, uri)
+	return s.record(uri, changeDeleted, committer, now), true
+}
+
+// record appends a change to the log. The changes are committed at increasing times, with the millisecond
+// precision of Smartlogic, so every change can be told apart by its commit time.
+func (s *store) record(uri string, changeType string, committer string, now time.Time) change {
+	committed := now.UTC().Truncate(time.Millisecond)
+	if n := len(s.changes); n > 0 && !committed.After(s.changes[n-1].committed) {
+		committed = s.changes[n-1].committed.Add(time.Millisecond)
+	}
+	c := change{uri: uri, changeType: changeType, committer: committer, committed: committed}
+	s.changes = append(s.changes, c)
+	return c
+}
+
+// changesBetween returns the changes committed after from and, unless to is zero, not after to.
+func (s *store) changesBetween(from time.Time, to time.Time) []change {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var changes []change
+	for _, c := range s.changes {
+		if c.committed.After(from) && (to.IsZero() || !c.committed.After(to)) {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
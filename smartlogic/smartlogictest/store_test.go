@@ -0,0 +1,43 @@
+package smartlogictest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_Changes(t *testing.T) {
+	now := time.Date(2020, 4, 27, 12, 0, 0, 0, time.UTC)
+	s := newStore()
+	node := Node{"@id": "http://www.ft.com/thing/uuid1"}
+
+	created := s.put(node, "jane.doe@ft.com", now)
+	updated := s.put(node, "jane.doe@ft.com", now)
+	deleted, ok := s.delete(node.ID(), "john.doe@ft.com", now.Add(time.Second))
+	assert.True(t, ok)
+	_, ok = s.delete(node.ID(), "john.doe@ft.com", now.Add(time.Second))
+	assert.False(t, ok)
+
+	assert.Equal(t, changeCreated, created.changeType)
+	assert.Equal(t, changeUpdated, updated.changeType)
+	assert.Equal(t, now.Add(time.Millisecond), updated.committed, "changes should be committed at increasing times")
+	assert.Equal(t, changeDeleted, deleted.changeType)
+
+	assert.Equal(t, []change{updated, deleted}, s.changesBetween(now, time.Time{}))
+	assert.Equal(t, []change{created, updated}, s.changesBetween(now.Add(-time.Second), now.Add(time.Millisecond)))
+}
+
+func TestParseSeed(t *testing.T) {
+	nodes, err := ParseSeed([]byte(`{"@graph": [{"@id": "http://www.ft.com/thing/uuid1", "sem:guid": [{"@value": "uuid1"}]}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "uuid1", nodes[0].GUID())
+
+	_, err = ParseSeed([]byte(`{"@graph": [{"@id": "http://www.ft.com/thing/uuid1"}]}`))
+	assert.EqualError(t, err, "concept http://www.ft.com/thing/uuid1 has no sem:guid")
+
+	_, err = ParseSeed([]byte(`{"@graph": [`))
+	assert.Error(t, err)
+
+	assert.Len(t, DefaultSeed(), 3)
+}
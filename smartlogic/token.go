@@ -0,0 +1,164 @@
+package smartlogic
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// tokenRefreshMargin is how long before the expiry of the access token we start requesting a new one,
+// so that in-flight requests don't end up using a token that expires on the way to Smartlogic.
+const tokenRefreshMargin = 30 * time.Second
+
+var errTokenUnavailable = errors.New("failed to get a valid access token")
+
+// tokenManager keeps the Smartlogic access token and refreshes it before it expires.
+// It is safe for concurrent use and makes sure that only one refresh is in flight at any time.
+type tokenManager struct {
+	fetch func() (TokenResponse, error)
+	now   func() time.Time
+
+	mu            sync.Mutex
+	token         string
+	valid         bool
+	issued        time.Time
+	expires       time.Time
+	failureCount  int
+	inflight      *tokenCall
+	refreshMargin time.Duration
+}
+
+// tokenCall represents a token refresh in progress, which other callers can wait for.
+type tokenCall struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+func newTokenManager(fetch func() (TokenResponse, error)) *tokenManager {
+	return &tokenManager{
+		fetch:         fetch,
+		now:           time.Now,
+		refreshMargin: tokenRefreshMargin,
+	}
+}
+
+// Token returns a valid access token, refreshing it first if it is missing or about to expire.
+func (m *tokenManager) Token() (string, error) {
+	m.mu.Lock()
+	if m.valid && !m.expiringLocked() {
+		token := m.token
+		m.mu.Unlock()
+		return token, nil
+	}
+	m.mu.Unlock()
+	return m.Refresh()
+}
+
+// Current returns the access token as it is, without checking its validity.
+func (m *tokenManager) Current() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.token
+}
+
+// Refresh requests a new access token. Concurrent callers share the result of a single request.
+func (m *tokenManager) Refresh() (string, error) {
+	m.mu.Lock()
+	if call := m.inflight; call != nil {
+		m.mu.Unlock()
+		<-call.done
+		return call.token, call.err
+	}
+	call := &tokenCall{done: make(chan struct{})}
+	m.inflight = call
+	m.mu.Unlock()
+
+	resp, err := m.fetch()
+
+	m.mu.Lock()
+	if err == nil {
+		m.token = resp.AccessToken
+		m.valid = true
+		m.issued, m.expires = m.validityOf(resp)
+		log.WithField("expires", m.expires).Debug("Setting Smartlogic access token")
+	}
+	call.token, call.err = m.token, err
+	m.inflight = nil
+	m.mu.Unlock()
+	close(call.done)
+
+	return call.token, call.err
+}
+
+// Invalidate marks the given token as no longer usable, e.g. after Smartlogic rejected it.
+// A token that was already replaced by a newer one is left alone.
+func (m *tokenManager) Invalidate(token string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.token == token {
+		m.token = ""
+		m.valid = false
+	}
+}
+
+// Issued returns the time when the current token was issued.
+func (m *tokenManager) Issued() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.issued
+}
+
+// Expires returns the time when the current token expires. It is zero if the expiry is unknown.
+func (m *tokenManager) Expires() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.expires
+}
+
+func (m *tokenManager) recordFailure() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failureCount++
+}
+
+func (m *tokenManager) resetFailures() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failureCount = 0
+}
+
+func (m *tokenManager) failures() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.failureCount
+}
+
+func (m *tokenManager) expiringLocked() bool {
+	if m.expires.IsZero() {
+		return false
+	}
+	return !m.now().Add(m.refreshMargin).Before(m.expires)
+}
+
+// validityOf works out when the token was issued and when it expires. The absolute ".issued" and ".expires" values
+// are preferred; if they are missing or can't be parsed, "expires_in" is used relative to the current time.
+func (m *tokenManager) validityOf(resp TokenResponse) (time.Time, time.Time) {
+	now := m.now()
+
+	issued, err := http.ParseTime(resp.Issued)
+	if err != nil {
+		issued = now
+	}
+	expires, err := http.ParseTime(resp.Expires)
+	if err != nil {
+		expires = time.Time{}
+		if resp.ExpiresIn > 0 {
+			expires = now.Add(time.Duration(resp.ExpiresIn) * time.Second)
+		}
+	}
+	return issued, expires
+}
@@ -0,0 +1,116 @@
+package smartlogic
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenManager_RefreshesBeforeExpiry(t *testing.T) {
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	var calls int32
+	m := newTokenManager(func() (TokenResponse, error) {
+		n := atomic.AddInt32(&calls, 1)
+		return TokenResponse{AccessToken: string(rune('a' + n - 1)), ExpiresIn: 120}, nil
+	})
+	m.now = func() time.Time { return now }
+
+	token, err := m.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "a", token)
+	assert.Equal(t, now.Add(2*time.Minute), m.Expires())
+
+	// still valid, no new token is requested
+	now = now.Add(time.Minute)
+	token, err = m.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "a", token)
+
+	// within the refresh margin before the expiry
+	now = now.Add(time.Minute - tokenRefreshMargin/2)
+	token, err = m.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "b", token)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+}
+
+func TestTokenManager_UsesAbsoluteExpiry(t *testing.T) {
+	m := newTokenManager(func() (TokenResponse, error) {
+		return TokenResponse{
+			AccessToken: "token",
+			ExpiresIn:   10,
+			Issued:      "Fri, 01 May 2020 12:00:00 GMT",
+			Expires:     "Fri, 01 May 2020 13:00:00 GMT",
+		}, nil
+	})
+
+	_, err := m.Refresh()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC), m.Issued().UTC())
+	assert.Equal(t, time.Date(2020, 5, 1, 13, 0, 0, 0, time.UTC), m.Expires().UTC())
+}
+
+func TestTokenManager_SingleRefreshInFlight(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	m := newTokenManager(func() (TokenResponse, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return TokenResponse{AccessToken: "token"}, nil
+	})
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 10)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], _ = m.Token()
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+	for _, token := range tokens {
+		assert.Equal(t, "token", token)
+	}
+}
+
+func TestTokenManager_Invalidate(t *testing.T) {
+	var calls int32
+	m := newTokenManager(func() (TokenResponse, error) {
+		atomic.AddInt32(&calls, 1)
+		return TokenResponse{AccessToken: "token"}, nil
+	})
+
+	_, err := m.Token()
+	assert.NoError(t, err)
+
+	// invalidating a token which is no longer the current one doesn't drop the current token
+	m.Invalidate("old-token")
+	assert.Equal(t, "token", m.Current())
+
+	m.Invalidate("token")
+	assert.Equal(t, "", m.Current())
+
+	_, err = m.Token()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+}
+
+func TestTokenManager_RefreshError(t *testing.T) {
+	refreshErr := errors.New("token endpoint is down")
+	m := newTokenManager(func() (TokenResponse, error) {
+		return TokenResponse{}, refreshErr
+	})
+
+	_, err := m.Token()
+	assert.Equal(t, refreshErr, err)
+	assert.Equal(t, "", m.Current())
+}